@@ -1,12 +1,18 @@
 package oasys
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -44,6 +50,94 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
 	return api.oasys.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 }
 
+type stakeChange struct {
+	Operator common.Address `json:"operator"`
+	From     *hexutil.Big   `json:"from"`
+	To       *hexutil.Big   `json:"to"`
+}
+
+type environmentChange struct {
+	Field string       `json:"field"`
+	From  *hexutil.Big `json:"from"`
+	To    *hexutil.Big `json:"to"`
+}
+
+type snapshotDiff struct {
+	From         hexutil.Uint64       `json:"from"`
+	To           hexutil.Uint64       `json:"to"`
+	Added        []common.Address     `json:"added"`
+	Removed      []common.Address     `json:"removed"`
+	StakeChanges []*stakeChange       `json:"stakeChanges"` // Stakes of the validators in both snapshots
+	Environment  []*environmentChange `json:"environment"`
+}
+
+// DiffSnapshots returns the changes between the snapshots at the two given
+// blocks: the validators added and removed, the stakes changed of the ones kept
+// and the environment values changed, all in ascending order.
+func (api *API) DiffSnapshots(from, to rpc.BlockNumber) (*snapshotDiff, error) {
+	snapshots := make([]*Snapshot, 2)
+	for i, number := range []rpc.BlockNumber{from, to} {
+		snap, err := api.GetSnapshot(&number)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i] = snap
+	}
+	a, b := snapshots[0], snapshots[1]
+	diff := &snapshotDiff{
+		From:         hexutil.Uint64(a.Number),
+		To:           hexutil.Uint64(b.Number),
+		Added:        []common.Address{},
+		Removed:      []common.Address{},
+		StakeChanges: []*stakeChange{},
+		Environment:  []*environmentChange{},
+	}
+	for operator, stake := range b.Validators {
+		prev, ok := a.Validators[operator]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, operator)
+		case prev.Cmp(stake) != 0:
+			diff.StakeChanges = append(diff.StakeChanges, &stakeChange{
+				Operator: operator,
+				From:     (*hexutil.Big)(new(big.Int).Set(prev)),
+				To:       (*hexutil.Big)(new(big.Int).Set(stake)),
+			})
+		}
+	}
+	for operator := range a.Validators {
+		if !b.exists(operator) {
+			diff.Removed = append(diff.Removed, operator)
+		}
+	}
+	sort.Sort(validatorsAscending(diff.Added))
+	sort.Sort(validatorsAscending(diff.Removed))
+	sort.Slice(diff.StakeChanges, func(i, j int) bool {
+		return bytes.Compare(diff.StakeChanges[i].Operator[:], diff.StakeChanges[j].Operator[:]) < 0
+	})
+
+	ae, be := a.Environment, b.Environment
+	for _, field := range []struct {
+		name     string
+		from, to *big.Int
+	}{
+		{"StartBlock", ae.StartBlock, be.StartBlock}, {"StartEpoch", ae.StartEpoch, be.StartEpoch},
+		{"BlockPeriod", ae.BlockPeriod, be.BlockPeriod}, {"EpochPeriod", ae.EpochPeriod, be.EpochPeriod},
+		{"RewardRate", ae.RewardRate, be.RewardRate}, {"CommissionRate", ae.CommissionRate, be.CommissionRate},
+		{"ValidatorThreshold", ae.ValidatorThreshold, be.ValidatorThreshold}, {"JailThreshold", ae.JailThreshold, be.JailThreshold},
+		{"JailPeriod", ae.JailPeriod, be.JailPeriod},
+	} {
+		if field.from.Cmp(field.to) != 0 {
+			diff.Environment = append(diff.Environment, &environmentChange{
+				Field: field.name,
+				From:  (*hexutil.Big)(new(big.Int).Set(field.from)),
+				To:    (*hexutil.Big)(new(big.Int).Set(field.to)),
+			})
+		}
+	}
+	return diff, nil
+}
+
 // GetSigners retrieves the list of authorized signers at the specified block.
 func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	// Retrieve the requested block number (or current if none requested)
@@ -53,20 +147,1103 @@ func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	} else {
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
-	// Ensure we have an actually valid block and return the signers from its snapshot
-	if header == nil {
+	// Ensure we have an actually valid block and return the signers from its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.oasys.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.validators(), nil
+}
+
+// GetSignersAtHash retrieves the list of authorized signers at the specified block.
+func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.oasys.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.validators(), nil
+}
+
+type security struct {
+	TotalStake         *hexutil.Big `json:"totalStake"`
+	LivenessAttack     *hexutil.Big `json:"livenessAttackStake"`      // Stake of the fewest validators controlling more than 1/3
+	LivenessValidators int          `json:"livenessAttackValidators"` // Number of those validators
+	SafetyAttack       *hexutil.Big `json:"safetyAttackStake"`        // Stake of the fewest validators controlling more than 1/2
+	SafetyValidators   int          `json:"safetyAttackValidators"`   // Number of those validators
+}
+
+// GetSecurity returns the total stake of the validators active at the given
+// block, along with the cost to attack the network: the stake of the fewest
+// validators which together control more than a third of it, enough to stall
+// the chain, and more than half of it, enough to control its contents.
+func (api *API) GetSecurity(number *rpc.BlockNumber) (*security, error) {
+	snap, err := api.GetSnapshot(number)
+	if err != nil {
+		return nil, err
+	}
+	_, stakes := snap.validatorsToTuple()
+	total := new(big.Int)
+	for _, stake := range stakes {
+		total.Add(total, stake)
+	}
+	liveness, livenessValidators := attackStake(stakes, 1, 3)
+	safety, safetyValidators := attackStake(stakes, 1, 2)
+	return &security{
+		TotalStake:         (*hexutil.Big)(total),
+		LivenessAttack:     (*hexutil.Big)(liveness),
+		LivenessValidators: livenessValidators,
+		SafetyAttack:       (*hexutil.Big)(safety),
+		SafetyValidators:   safetyValidators,
+	}, nil
+}
+
+// attackStake returns the stake of the fewest validators controlling more than
+// the given fraction of the total stake, along with their number.
+func attackStake(stakes []*big.Int, num, den int64) (*big.Int, int) {
+	sorted := make([]*big.Int, len(stakes))
+	copy(sorted, stakes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) > 0 })
+
+	total := new(big.Int)
+	for _, stake := range sorted {
+		total.Add(total, stake)
+	}
+	threshold := new(big.Int).Mul(total, big.NewInt(num))
+	controlled := new(big.Int)
+	for i, stake := range sorted {
+		controlled.Add(controlled, stake)
+		if new(big.Int).Mul(controlled, big.NewInt(den)).Cmp(threshold) > 0 {
+			return controlled, i + 1
+		}
+	}
+	return controlled, len(sorted)
+}
+
+// Proposals returns the current proposals the node tries to uphold and vote on.
+func (api *API) Proposals() map[common.Address]bool {
+	api.oasys.lock.RLock()
+	defer api.oasys.lock.RUnlock()
+
+	proposals := make(map[common.Address]bool)
+	for address, auth := range api.oasys.proposals {
+		proposals[address] = auth
+	}
+	return proposals
+}
+
+// Propose injects a new authorization proposal that the signer will attempt to
+// push through.
+func (api *API) Propose(address common.Address, auth bool) {
+	api.oasys.lock.Lock()
+	defer api.oasys.lock.Unlock()
+
+	api.oasys.proposals[address] = auth
+}
+
+// Discard drops a currently running proposal, stopping the signer from casting
+// further votes (either for or against).
+func (api *API) Discard(address common.Address) {
+	api.oasys.lock.Lock()
+	defer api.oasys.lock.Unlock()
+
+	delete(api.oasys.proposals, address)
+}
+
+// SetSlashingPaused suspends or resumes slashing during a declared network
+// emergency, logging the validators that would have been slashed instead.
+func (api *API) SetSlashingPaused(paused bool) {
+	api.oasys.SetSlashingPaused(paused)
+}
+
+// SetTunable changes a setting of the engine which doesn't affect consensus, like
+// validatorPageSize or snapshotWorkers, without a restart. The oasys namespace
+// isn't public, so this is only reachable through the authenticated endpoints.
+func (api *API) SetTunable(name string, value uint64) error {
+	return api.oasys.SetTunable(name, value)
+}
+
+type inTurnStatus struct {
+	Signer          common.Address `json:"signer"`
+	Scheduled       common.Address `json:"scheduled"`
+	InTurnDiff      bool           `json:"inTurnDifficulty"`
+	ScheduledSigner bool           `json:"scheduledSigner"`
+}
+
+// WasInTurn reports whether the canonical block at the given number was sealed
+// in-turn, both by its difficulty and by its signer against the schedule.
+func (api *API) WasInTurn(number rpc.BlockNumber) (*inTurnStatus, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else if number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have a canonical, sealed block to look at
+	if header == nil || header.Number.Uint64() == 0 {
+		return nil, errUnknownBlock
+	}
+	signer, err := ecrecover(api.oasys.config, header, api.oasys.signatures)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := api.oasys.scheduleAt(api.chain, header)
+	if err != nil {
+		return nil, err
+	}
+	scheduled := schedule[header.Number.Uint64()]
+	return &inTurnStatus{
+		Signer:          signer,
+		Scheduled:       scheduled,
+		InTurnDiff:      header.Difficulty.Cmp(diffInTurn) == 0,
+		ScheduledSigner: signer == scheduled,
+	}, nil
+}
+
+// GetJailReleaseEligible returns the validators whose jail period has elapsed as
+// of the given epoch, according to the state of the current block.
+func (api *API) GetJailReleaseEligible(epoch uint64) ([]common.Address, error) {
+	header := api.chain.CurrentHeader()
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return getJailReleaseEligible(api.oasys.ethAPI, header.Hash(), epoch)
+}
+
+type stakeBreakdown struct {
+	SelfStake      *hexutil.Big `json:"selfStake"`
+	DelegatedStake *hexutil.Big `json:"delegatedStake"`
+	TotalStake     *hexutil.Big `json:"totalStake"`
+}
+
+// GetStakeBreakdown returns the stake of the validator with the given operator in
+// the current epoch, split between its owner and the delegations. If the
+// StakeManager doesn't report the stakers of a validator, the whole stake is
+// returned as self-stake.
+func (api *API) GetStakeBreakdown(operator common.Address) (*stakeBreakdown, error) {
+	header := api.chain.CurrentHeader()
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	epoch := env.Epoch(header.Number.Uint64())
+	validators, err := getNextValidatorsPaged(api.oasys.ethAPI, header.Hash(), epoch, nil, api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	var owner common.Address
+	for i, candidate := range validators.Operators {
+		if candidate == operator {
+			owner = validators.Owners[i]
+			break
+		}
+	}
+	if owner == (common.Address{}) {
+		return nil, fmt.Errorf("%v is not a validator operator in epoch %d", operator, epoch)
+	}
+
+	total, err := getValidatorStake(api.oasys.ethAPI, header.Hash(), owner, epoch)
+	if err != nil {
+		return nil, err
+	}
+	self, ok, err := getValidatorSelfStake(api.oasys.ethAPI, header.Hash(), owner, epoch)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || self.Cmp(total) > 0 {
+		self = total
+	}
+	return &stakeBreakdown{
+		SelfStake:      (*hexutil.Big)(self),
+		DelegatedStake: (*hexutil.Big)(new(big.Int).Sub(total, self)),
+		TotalStake:     (*hexutil.Big)(total),
+	}, nil
+}
+
+type lastDistribution struct {
+	Epoch       uint64       `json:"epoch"`
+	Distributed bool         `json:"distributed"`
+	Amount      *hexutil.Big `json:"amount"`
+}
+
+// GetLastDistribution returns the rewards the validator with the given operator
+// earned in the last epoch, as minted to the StakeManager at the first block of
+// the current epoch. The engine sends no distribution transaction, so the amount
+// is the one reported by StakeManager.getTotalRewards before the mint. Jailed
+// validators and the ones skipped by the selection distributed nothing.
+func (api *API) GetLastDistribution(operator common.Address) (*lastDistribution, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	first := env.GetFirstBlock(head.Number.Uint64())
+	if first == 0 || env.Epoch(first) <= 2 {
+		return nil, fmt.Errorf("no rewards distributed before epoch 3, current epoch %d", env.Epoch(first))
+	}
+	header := api.chain.GetHeaderByNumber(first)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+
+	epoch := env.Epoch(first) - 1
+	distribution := &lastDistribution{Epoch: epoch, Amount: new(hexutil.Big)}
+	validators, err := getNextValidatorsPaged(api.oasys.ethAPI, header.ParentHash, epoch, nil, api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	var owner common.Address
+	for i, candidate := range validators.Operators {
+		if candidate == operator {
+			owner = validators.Owners[i]
+			break
+		}
+	}
+	if owner == (common.Address{}) {
+		return distribution, nil
+	}
+	jailed, err := isValidatorJailed(api.oasys.ethAPI, header.ParentHash, owner, epoch)
+	if err != nil {
+		return nil, err
+	}
+	if jailed {
+		return distribution, nil
+	}
+	rewards, err := getTotalRewards(api.oasys.ethAPI, header.ParentHash, []common.Address{owner})
+	if err != nil {
+		return nil, err
+	}
+	distribution.Distributed = rewards.Sign() > 0
+	distribution.Amount = (*hexutil.Big)(rewards)
+	return distribution, nil
+}
+
+type effectiveCommission struct {
+	Percent float64        `json:"percent"`
+	Since   hexutil.Uint64 `json:"since"`
+}
+
+// GetEffectiveCommission returns the commission rate the delegators of the given
+// validator operator pay in the current epoch, as a percentage, along with the
+// block the environment setting it took effect at. The rate is set by the
+// Environment contract for all the validators.
+func (api *API) GetEffectiveCommission(operator common.Address) (*effectiveCommission, error) {
+	header := api.chain.CurrentHeader()
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	epoch := env.Epoch(header.Number.Uint64())
+	validators, err := getNextValidatorsPaged(api.oasys.ethAPI, header.Hash(), epoch, nil, api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	if !validators.Exists(operator) {
+		return nil, fmt.Errorf("%v is not a validator operator in epoch %d", operator, epoch)
+	}
+	return &effectiveCommission{
+		Percent: env.CommissionRatePercent(),
+		Since:   hexutil.Uint64(env.StartBlock.Uint64()),
+	}, nil
+}
+
+// GetBlockPeriod returns the block period of the environment active at the given
+// block. Blocks of the first epoch use the period of the genesis configuration.
+func (api *API) GetBlockPeriod(number rpc.BlockNumber) (hexutil.Uint64, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else if number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(env.BlockPeriod.Uint64()), nil
+}
+
+type decodedEnvironment struct {
+	StartBlock         hexutil.Uint64 `json:"startBlock"`
+	StartEpoch         uint64         `json:"startEpoch"`
+	BlockPeriod        uint64         `json:"blockPeriod"`           // Seconds between blocks
+	EpochPeriod        uint64         `json:"epochPeriod"`           // Blocks per epoch
+	EpochDuration      string         `json:"epochDuration"`         // Approximate wall time of an epoch
+	RewardRate         float64        `json:"rewardRatePercent"`     // Annual staking reward rate
+	CommissionRate     float64        `json:"commissionRatePercent"` // Validator commission rate
+	ValidatorThreshold *big.Int       `json:"validatorThreshold"`    // Whole tokens staked to become a validator
+	JailThreshold      uint64         `json:"jailThreshold"`         // Missed blocks to be jailed
+	JailPeriod         uint64         `json:"jailPeriod"`            // Epochs a validator stays jailed
+}
+
+// GetEnvironment returns the environment active at the given block in human
+// units: periods in seconds and blocks, rates as percentages and the validator
+// threshold in whole tokens, rounded down.
+func (api *API) GetEnvironment(number rpc.BlockNumber) (*decodedEnvironment, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else if number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	duration := time.Duration(env.EpochPeriod.Uint64()*env.BlockPeriod.Uint64()) * time.Second
+	return &decodedEnvironment{
+		StartBlock:         hexutil.Uint64(env.StartBlock.Uint64()),
+		StartEpoch:         env.StartEpoch.Uint64(),
+		BlockPeriod:        env.BlockPeriod.Uint64(),
+		EpochPeriod:        env.EpochPeriod.Uint64(),
+		EpochDuration:      duration.String(),
+		RewardRate:         env.RewardRatePercent(),
+		CommissionRate:     env.CommissionRatePercent(),
+		ValidatorThreshold: new(big.Int).Div(env.ValidatorThreshold, ether),
+		JailThreshold:      env.JailThreshold.Uint64(),
+		JailPeriod:         env.JailPeriod.Uint64(),
+	}, nil
+}
+
+// maxEpochBoundaries is the maximum number of boundaries returned by
+// GetEpochBoundaries.
+const maxEpochBoundaries = 128
+
+// GetEpochBoundaries returns the first blocks of the epochs starting within the
+// given range, following the epoch period changes along the way. The range is
+// clamped to the current block, and may hold up to maxEpochBoundaries epochs.
+func (api *API) GetEpochBoundaries(fromBlock, toBlock uint64) ([]uint64, error) {
+	return api.epochBoundaries(fromBlock, toBlock, maxEpochBoundaries)
+}
+
+// epochBoundaries returns the first blocks of the epochs starting within the
+// given range, failing past the given number of epochs if any.
+func (api *API) epochBoundaries(fromBlock, toBlock uint64, limit int) ([]uint64, error) {
+	boundaries := []uint64{}
+	if head := api.chain.CurrentHeader(); head == nil {
+		return nil, errUnknownBlock
+	} else if toBlock > head.Number.Uint64() {
+		toBlock = head.Number.Uint64()
+	}
+	if fromBlock > toBlock {
+		return boundaries, nil
+	}
+	if fromBlock == 0 {
+		boundaries = append(boundaries, 0)
+		fromBlock = 1
+	}
+
+	// Jump from boundary to boundary, by the period of the environment in effect
+	header := api.chain.GetHeaderByNumber(fromBlock - 1)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	for number := fromBlock; number <= toBlock; {
+		boundary := env.StartBlock.Uint64()
+		if number > boundary {
+			if boundary = env.GetFirstBlock(number); boundary < number {
+				boundary += env.EpochPeriod.Uint64()
+			}
+		}
+		if boundary > toBlock {
+			break
+		}
+		if limit > 0 && len(boundaries) == limit {
+			return nil, fmt.Errorf("block range [%d, %d] exceeds %d epochs", fromBlock, toBlock, limit)
+		}
+		boundaries = append(boundaries, boundary)
+
+		if header = api.chain.GetHeaderByNumber(boundary); header == nil {
+			return nil, errUnknownBlock
+		}
+		if env, err = api.oasys.environment(api.chain, header, nil); err != nil {
+			return nil, err
+		}
+		number = boundary + 1
+	}
+	return boundaries, nil
+}
+
+type epochProgress struct {
+	Epoch           uint64         `json:"epoch"`
+	EpochStartBlock hexutil.Uint64 `json:"epochStartBlock"`
+	EpochLength     hexutil.Uint64 `json:"epochLength"`
+	CurrentBlock    hexutil.Uint64 `json:"currentBlock"`
+	BlocksRemaining hexutil.Uint64 `json:"blocksRemaining"`
+}
+
+// GetEpochProgress returns the progress of the current block through its epoch.
+// The epoch length is the period of the environment in effect at the current
+// block, so that epochs following a period change are measured correctly.
+func (api *API) GetEpochProgress() (*epochProgress, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	number := head.Number.Uint64()
+	start := env.GetFirstBlock(number)
+	length := env.EpochPeriod.Uint64()
+	return &epochProgress{
+		Epoch:           env.Epoch(number),
+		EpochStartBlock: hexutil.Uint64(start),
+		EpochLength:     hexutil.Uint64(length),
+		CurrentBlock:    hexutil.Uint64(number),
+		BlocksRemaining: hexutil.Uint64(start + length - 1 - number),
+	}, nil
+}
+
+type epochCountdown struct {
+	NextEpochBlock hexutil.Uint64 `json:"nextEpochBlock"`
+	Blocks         hexutil.Uint64 `json:"blocks"`    // Blocks to seal up to the boundary
+	Seconds        hexutil.Uint64 `json:"seconds"`   // Estimated seconds up to the boundary
+	Timestamp      hexutil.Uint64 `json:"timestamp"` // Estimated timestamp of the boundary
+}
+
+// GetTimeToNextEpoch returns the blocks and the estimated time left until the
+// first block of the next epoch. Both the epoch length and the block period are
+// the ones of the environment in effect at the current block, as a new
+// environment only takes effect from the boundary on.
+func (api *API) GetTimeToNextEpoch() (*epochCountdown, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	number := head.Number.Uint64()
+	boundary := env.GetFirstBlock(number) + env.EpochPeriod.Uint64()
+	blocks := boundary - number
+	seconds := blocks * env.BlockPeriod.Uint64()
+	return &epochCountdown{
+		NextEpochBlock: hexutil.Uint64(boundary),
+		Blocks:         hexutil.Uint64(blocks),
+		Seconds:        hexutil.Uint64(seconds),
+		Timestamp:      hexutil.Uint64(head.Time + seconds),
+	}, nil
+}
+
+// GetCheckpoint returns the validator set checkpoint taken at the given block,
+// which must be a multiple of the configured checkpoint interval.
+func (api *API) GetCheckpoint(number rpc.BlockNumber) (*Checkpoint, error) {
+	if number < 0 {
+		return nil, errUnknownBlock
+	}
+	header := api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.oasys.checkpoint(api.chain, header)
+}
+
+type epochSeed struct {
+	Epoch      uint64         `json:"epoch"`
+	FirstBlock hexutil.Uint64 `json:"firstBlock"`
+	SourceHash common.Hash    `json:"sourceHash"`
+	Seed       int64          `json:"seed"`
+}
+
+// GetEpochSeed returns the seed of the validator schedule of the given epoch,
+// derived from the hash of the block preceding its first block. The seed is only
+// available once that block is known.
+func (api *API) GetEpochSeed(epoch uint64) (*epochSeed, error) {
+	start, err := api.epochFirstBlock(epoch)
+	if err != nil {
+		return nil, err
+	}
+	result := &epochSeed{Epoch: epoch, FirstBlock: hexutil.Uint64(start)}
+	if start > 0 {
+		source := api.chain.GetHeaderByNumber(start - 1)
+		if source == nil {
+			return nil, fmt.Errorf("seed of epoch %d not available until block %d", epoch, start-1)
+		}
+		result.SourceHash = source.Hash()
+	}
+	result.Seed = scheduleSeed(api.chain, start)
+	return result, nil
+}
+
+// epochFirstBlock returns the first block of the given epoch, following the
+// environment values back from the current block to the one the epoch started
+// under. Epochs after the current one are extrapolated from its environment.
+func (api *API) epochFirstBlock(epoch uint64) (uint64, error) {
+	if epoch == 0 {
+		return 0, fmt.Errorf("invalid epoch %d", epoch)
+	}
+	header := api.chain.CurrentHeader()
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, header, nil)
+	if err != nil {
+		return 0, err
+	}
+	for epoch < env.StartEpoch.Uint64() {
+		if env.StartBlock.Sign() == 0 {
+			return 0, fmt.Errorf("invalid epoch %d", epoch)
+		}
+		if header = api.chain.GetHeaderByNumber(env.StartBlock.Uint64() - 1); header == nil {
+			return 0, errUnknownBlock
+		}
+		if env, err = api.oasys.environment(api.chain, header, nil); err != nil {
+			return 0, err
+		}
+	}
+	return env.StartBlock.Uint64() + (epoch-env.StartEpoch.Uint64())*env.EpochPeriod.Uint64(), nil
+}
+
+// epochEnvironment returns the environment value in effect during the given
+// epoch: the one its first block was produced under if already mined, else the
+// pending Environment value if it starts by then, or the current one.
+func (api *API) epochEnvironment(epoch uint64) (*environmentValue, error) {
+	start, err := api.epochFirstBlock(epoch)
+	if err != nil {
+		return nil, err
+	}
+	head := api.chain.CurrentHeader()
+	if start <= head.Number.Uint64() {
+		header := api.chain.GetHeaderByNumber(start)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		return api.oasys.environment(api.chain, header, nil)
+	}
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	current, err := api.oasys.environment(api.chain, pending, nil)
+	if err != nil {
+		return nil, err
+	}
+	next, err := getNextEnvironmentValue(api.oasys.ethAPI, head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if next.StartEpoch.Uint64() <= epoch {
+		return next, nil
+	}
+	return current, nil
+}
+
+// maxIssuanceProjection is the maximum number of epochs projected by
+// ProjectIssuance.
+const maxIssuanceProjection = 128
+
+// ProjectIssuance returns the rewards issued over the given range of epochs,
+// inclusive, to the stake of the validators in each epoch at the reward rate of
+// the environment in effect then. The stakes are all read at the current block,
+// as reported by the StakeManager for each epoch, so past epochs may differ from
+// the rewards actually paid and future epochs are projected from the stakes known
+// so far. The range may hold up to maxIssuanceProjection epochs.
+func (api *API) ProjectIssuance(fromEpoch, toEpoch uint64) (*hexutil.Big, error) {
+	if fromEpoch == 0 || fromEpoch > toEpoch {
+		return nil, fmt.Errorf("invalid epoch range [%d, %d]", fromEpoch, toEpoch)
+	}
+	if toEpoch-fromEpoch >= maxIssuanceProjection {
+		return nil, fmt.Errorf("epoch range [%d, %d] exceeds %d epochs", fromEpoch, toEpoch, maxIssuanceProjection)
+	}
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	total := new(big.Int)
+	for epoch := fromEpoch; epoch <= toEpoch; epoch++ {
+		env, err := api.epochEnvironment(epoch)
+		if err != nil {
+			return nil, err
+		}
+		start, err := api.epochFirstBlock(epoch)
+		if err != nil {
+			return nil, err
+		}
+		validators, err := getNextValidatorsPaged(api.oasys.ethAPI, head.Hash(), epoch, validatorThreshold(api.oasys.config, env, start), api.oasys.tunables.pageSize())
+		if err != nil {
+			return nil, err
+		}
+		stake := new(big.Int)
+		for _, s := range validators.Stakes {
+			stake.Add(stake, s)
+		}
+		total.Add(total, env.EpochRewards(stake))
+	}
+	return (*hexutil.Big)(total), nil
+}
+
+// maxRewardsHistory is the maximum number of epochs queried by
+// GetTotalRewardsHistory.
+const maxRewardsHistory = 128
+
+type epochRewards struct {
+	Epoch  uint64         `json:"epoch"`
+	Block  hexutil.Uint64 `json:"block"` // Block crediting the rewards of the epoch
+	Amount *hexutil.Big   `json:"amount"`
+}
+
+// GetTotalRewardsHistory returns the total rewards distributed for each epoch of
+// the given range. The engine sends no distribution transaction, leaving neither
+// receipt nor log behind, so the totals are the ones reported by
+// StakeManager.getTotalRewards before each mint, at the first block of the
+// following epoch. Epochs whose rewards aren't credited yet are left out.
+func (api *API) GetTotalRewardsHistory(fromEpoch, toEpoch uint64) ([]*epochRewards, error) {
+	if fromEpoch == 0 || fromEpoch > toEpoch {
+		return nil, fmt.Errorf("invalid epoch range [%d, %d]", fromEpoch, toEpoch)
+	}
+	if toEpoch-fromEpoch >= maxRewardsHistory {
+		return nil, fmt.Errorf("epoch range [%d, %d] exceeds %d epochs", fromEpoch, toEpoch, maxRewardsHistory)
+	}
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+
+	history := []*epochRewards{}
+	for epoch := fromEpoch; epoch <= toEpoch; epoch++ {
+		number, err := api.epochFirstBlock(epoch + 1)
+		if err != nil {
+			return nil, err
+		}
+		if number > head.Number.Uint64() {
+			break
+		}
+		rewards := &epochRewards{Epoch: epoch, Block: hexutil.Uint64(number), Amount: new(hexutil.Big)}
+
+		// No rewards are credited for the first epoch
+		if epoch > 1 {
+			header := api.chain.GetHeaderByNumber(number)
+			if header == nil {
+				return nil, errUnknownBlock
+			}
+			amount, err := getRewards(api.oasys.ethAPI, header.ParentHash)
+			if err != nil {
+				return nil, err
+			}
+			rewards.Amount = (*hexutil.Big)(amount)
+		}
+		history = append(history, rewards)
+	}
+	return history, nil
+}
+
+// GetHistoricalValidators returns the validators active during the given epoch,
+// from the snapshot at its first block. The snapshot is rebuilt from the headers
+// if it isn't persisted.
+func (api *API) GetHistoricalValidators(epoch uint64) ([]common.Address, error) {
+	start, err := api.epochFirstBlock(epoch)
+	if err != nil {
+		return nil, err
+	}
+	if head := api.chain.CurrentHeader(); start > head.Number.Uint64() {
+		return nil, fmt.Errorf("epoch %d not started until block %d", epoch, start)
+	}
+	header := api.chain.GetHeaderByNumber(start)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.oasys.snapshot(api.chain, start, header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.validators(), nil
+}
+
+// GetStandbyValidators returns the candidates the StakeManager reports at the
+// current block that stand by for the next epoch beyond the maximum number of
+// validators, in the order they would be promoted.
+func (api *API) GetStandbyValidators() ([]common.Address, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	next := env.GetFirstBlock(head.Number.Uint64()) + env.EpochPeriod.Uint64()
+	standbys, err := api.oasys.getStandbyValidators(head.Hash(), env, next)
+	if err != nil {
+		return nil, err
+	}
+	return standbys.Operators, nil
+}
+
+// GetAllowlist returns the addresses permitted by the allowlist of the
+// StakeManager at the current block. Validators outside of it are only excluded
+// from selection on chains with permissioned validators.
+func (api *API) GetAllowlist() ([]common.Address, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	return getAllowlist(api.oasys.ethAPI, head.Hash())
+}
+
+type operatorTerm struct {
+	Operator   common.Address `json:"operator"`
+	FirstEpoch uint64         `json:"firstEpoch"`
+	LastEpoch  uint64         `json:"lastEpoch"`
+}
+
+// maxOperatorHistory is the maximum number of epochs GetOperatorHistory looks
+// the validators up for.
+const maxOperatorHistory = 128
+
+// GetOperatorHistory returns the operators the given validator owner sealed
+// with within the given range of epochs, along with the epochs each of them was
+// active in, as reported by the StakeManager at every epoch boundary up to the
+// current block. The range may hold up to maxOperatorHistory epochs.
+func (api *API) GetOperatorHistory(owner common.Address, fromEpoch, toEpoch uint64) ([]*operatorTerm, error) {
+	if fromEpoch > toEpoch {
+		return nil, fmt.Errorf("invalid epoch range [%d, %d]", fromEpoch, toEpoch)
+	}
+	if toEpoch-fromEpoch >= maxOperatorHistory {
+		return nil, fmt.Errorf("epoch range [%d, %d] exceeds %d epochs", fromEpoch, toEpoch, maxOperatorHistory)
+	}
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	// Epochs are only numbered from their boundaries, which are walked uncapped
+	// as that's cheaper than looking the validators up
+	boundaries, err := api.epochBoundaries(1, head.Number.Uint64(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*operatorTerm{}
+	var last *operatorTerm
+	for _, number := range boundaries {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		env, err := api.oasys.environment(api.chain, header, nil)
+		if err != nil {
+			return nil, err
+		}
+		epoch := env.Epoch(number)
+		if epoch < fromEpoch {
+			continue
+		}
+		if epoch > toEpoch {
+			break
+		}
+		result, err := api.oasys.getNextValidators(api.chain, header.ParentHash, env, number, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var operator *common.Address
+		for i := range result.Owners {
+			if result.Owners[i] == owner {
+				operator = &result.Operators[i]
+				break
+			}
+		}
+		switch {
+		case operator == nil:
+			// Not a validator in this epoch, a later term starts afresh
+			last = nil
+		case last != nil && last.Operator == *operator:
+			last.LastEpoch = epoch
+		default:
+			last = &operatorTerm{Operator: *operator, FirstEpoch: epoch, LastEpoch: epoch}
+			history = append(history, last)
+		}
+	}
+	return history, nil
+}
+
+// GetEnvironmentHistory returns the environment values in effect within the
+// given range of blocks, in order, from the one in effect at its first block.
+// The Environment contract only exposes the value of the next epoch, so the
+// history is rebuilt from the value in effect at every epoch boundary. The range
+// is clamped to the current block, and may hold up to maxEpochBoundaries epochs.
+func (api *API) GetEnvironmentHistory(fromBlock, toBlock uint64) ([]*environmentValue, error) {
+	boundaries, err := api.GetEpochBoundaries(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	head := api.chain.CurrentHeader()
+	if fromBlock <= head.Number.Uint64() && fromBlock <= toBlock && (len(boundaries) == 0 || boundaries[0] != fromBlock) {
+		boundaries = append([]uint64{fromBlock}, boundaries...)
+	}
+
+	history := []*environmentValue{}
+	for _, number := range boundaries {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		env, err := api.oasys.environment(api.chain, header, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) > 0 && sameEnvironment(history[len(history)-1], env) {
+			continue
+		}
+		history = append(history, env)
+	}
+	return history, nil
+}
+
+// maxRewardRateSwing is the relative change of the reward rate, in percent,
+// above which an environment proposal is flagged as disruptive.
+const maxRewardRateSwing = 50
+
+type proposalCheck struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// ValidateEnvironmentProposal checks an environment value before it's proposed
+// to the Environment contract. Values the engine would refuse, or which can't
+// take effect as dated, are reported as errors. Valid values disrupting the
+// network, like large reward rate swings or period changes taking effect in the
+// middle of an epoch, are reported as warnings.
+func (api *API) ValidateEnvironmentProposal(value *environmentValue) (*proposalCheck, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	current, err := api.oasys.environment(api.chain, pending, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &proposalCheck{Errors: []string{}, Warnings: []string{}}
+	fields := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"StartBlock", value.StartBlock}, {"StartEpoch", value.StartEpoch},
+		{"BlockPeriod", value.BlockPeriod}, {"EpochPeriod", value.EpochPeriod},
+		{"RewardRate", value.RewardRate}, {"CommissionRate", value.CommissionRate},
+		{"ValidatorThreshold", value.ValidatorThreshold}, {"JailThreshold", value.JailThreshold},
+		{"JailPeriod", value.JailPeriod},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			check.Errors = append(check.Errors, fmt.Sprintf("missing %s", field.name))
+		}
+	}
+	if len(check.Errors) > 0 {
+		return check, nil
+	}
+
+	if value.BlockPeriod.Sign() <= 0 {
+		check.Errors = append(check.Errors, fmt.Sprintf("invalid block period: have %v", value.BlockPeriod))
+	}
+	if value.EpochPeriod.Sign() <= 0 {
+		check.Errors = append(check.Errors, fmt.Sprintf("invalid epoch period: have %v", value.EpochPeriod))
+	}
+	if err := value.validate(api.oasys.config); err != nil {
+		check.Errors = append(check.Errors, err.Error())
+	}
+	start := value.StartBlock.Uint64()
+	if !value.StartBlock.IsUint64() || start < pending.Number.Uint64() {
+		check.Errors = append(check.Errors, fmt.Sprintf("start block %v already passed, pending block %v", value.StartBlock, pending.Number))
+	} else if epoch := current.Epoch(start); current.IsEpoch(start) && value.StartEpoch.Cmp(new(big.Int).SetUint64(epoch)) != 0 {
+		check.Errors = append(check.Errors, fmt.Sprintf("start epoch mismatch: have %v, want %d", value.StartEpoch, epoch))
+	}
+
+	// Flag the valid changes which would disrupt the network
+	if current.RewardRate.Sign() > 0 {
+		swing := new(big.Int).Sub(value.RewardRate, current.RewardRate)
+		swing.Mul(swing.Abs(swing), big.NewInt(100))
+		if swing.Div(swing, current.RewardRate).Cmp(big.NewInt(maxRewardRateSwing)) > 0 {
+			check.Warnings = append(check.Warnings, fmt.Sprintf("reward rate changes by %v%%: from %v to %v", swing, current.RewardRate, value.RewardRate))
+		}
+	} else if value.RewardRate.Sign() > 0 {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("reward rate changes from 0 to %v", value.RewardRate))
+	}
+	periodChange := value.BlockPeriod.Cmp(current.BlockPeriod) != 0 || value.EpochPeriod.Cmp(current.EpochPeriod) != 0
+	if periodChange && value.StartBlock.IsUint64() && !current.IsEpoch(start) {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("periods change in the middle of epoch %d at block %d", current.Epoch(start), start))
+	}
+	check.Valid = len(check.Errors) == 0
+	return check, nil
+}
+
+// GetMinStakeToJoin returns the minimum stake a validator needs to be selected
+// into the active set of the next epoch, as currently staked. It's the threshold
+// of the environment in effect, unless the set is limited to MaxValidators and
+// full, in which case the lowest active stake must be outbid too.
+func (api *API) GetMinStakeToJoin() (*hexutil.Big, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
 		return nil, errUnknownBlock
 	}
-	snap, err := api.oasys.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	env, err := api.oasys.environment(api.chain, pending, nil)
 	if err != nil {
 		return nil, err
 	}
-	return snap.validators(), nil
+	minStake := new(big.Int).Set(env.ValidatorThreshold)
+
+	epoch := env.Epoch(pending.Number.Uint64()) + 1
+	start := env.GetFirstBlock(pending.Number.Uint64()) + env.EpochPeriod.Uint64()
+	limit := maxValidators(api.oasys.config, start)
+	if limit == 0 {
+		return (*hexutil.Big)(minStake), nil
+	}
+	candidates, err := getNextValidatorsPaged(api.oasys.ethAPI, head.Hash(), epoch, validatorThreshold(api.oasys.config, env, start), api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	if candidates, err = withAllowlist(api.oasys.ethAPI, api.oasys.config, start, head.Hash(), withUniqueOperators(api.oasys.config, start, candidates)); err != nil {
+		return nil, err
+	}
+	active := selectValidators(api.oasys.config, start, candidates)
+	if uint64(len(active.Operators)) < limit {
+		return (*hexutil.Big)(minStake), nil
+	}
+	lowest := active.Stakes[0]
+	for _, stake := range active.Stakes[1:] {
+		if stake.Cmp(lowest) < 0 {
+			lowest = stake
+		}
+	}
+	if outbid := new(big.Int).Add(lowest, common.Big1); outbid.Cmp(minStake) > 0 {
+		minStake = outbid
+	}
+	return (*hexutil.Big)(minStake), nil
 }
 
-// GetSignersAtHash retrieves the list of authorized signers at the specified block.
-func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
-	header := api.chain.GetHeaderByHash(hash)
+type stakePreview struct {
+	Epoch          uint64           `json:"epoch"`
+	FirstBlock     hexutil.Uint64   `json:"firstBlock"`
+	Before         []common.Address `json:"before"`
+	After          []common.Address `json:"after"`
+	BeforeSchedule []common.Address `json:"beforeSchedule"`
+	AfterSchedule  []common.Address `json:"afterSchedule"`
+}
+
+// PreviewStakeChange returns the active set and schedule of the next epoch as
+// currently staked, and as they would be with the stake of the operator changed
+// by delta, assuming the environment in effect stays the same. Schedules list
+// the scheduled validator of every block from the first of the epoch on. The
+// chain state is left untouched.
+//
+// The schedule of an epoch is seeded by the hash of the block before it, which
+// isn't sealed yet. The preview schedules fall back to the seed of the first
+// block number, like the first epoch, so they show how the blocks are shared
+// among the validators, not the order they'll actually be sealed in.
+func (api *API) PreviewStakeChange(operator common.Address, delta *hexutil.Big) (*stakePreview, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	env, err := api.oasys.environment(api.chain, pending, nil)
+	if err != nil {
+		return nil, err
+	}
+	epoch := env.Epoch(pending.Number.Uint64()) + 1
+	start := env.GetFirstBlock(pending.Number.Uint64()) + env.EpochPeriod.Uint64()
+
+	// Fetch the candidates regardless of the threshold, which the delta may cross
+	candidates, err := getNextValidatorsPaged(api.oasys.ethAPI, head.Hash(), epoch, nil, api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	if candidates, err = withAllowlist(api.oasys.ethAPI, api.oasys.config, start, head.Hash(), candidates); err != nil {
+		return nil, err
+	}
+	changed := &getNextValidatorsResult{}
+	found := false
+	for i, candidate := range candidates.Operators {
+		stake := new(big.Int).Set(candidates.Stakes[i])
+		if candidate == operator {
+			stake.Add(stake, delta.ToInt())
+			found = true
+		}
+		changed.Owners = append(changed.Owners, candidates.Owners[i])
+		changed.Operators = append(changed.Operators, candidate)
+		changed.Stakes = append(changed.Stakes, stake)
+	}
+	if !found {
+		changed.Owners = append(changed.Owners, operator)
+		changed.Operators = append(changed.Operators, operator)
+		changed.Stakes = append(changed.Stakes, new(big.Int).Set(delta.ToInt()))
+	}
+
+	preview := &stakePreview{Epoch: epoch, FirstBlock: hexutil.Uint64(start)}
+	preview.Before, preview.BeforeSchedule = api.previewSchedule(candidates, env, start)
+	preview.After, preview.AfterSchedule = api.previewSchedule(changed, env, start)
+	return preview, nil
+}
+
+// previewSchedule selects the validators among the candidates like the engine
+// would, returning them sorted along with their schedule of the epoch starting
+// at the given block. The schedule is seeded by the block number if the block
+// before it isn't known yet, see scheduleSeed.
+func (api *API) previewSchedule(candidates *getNextValidatorsResult, env *environmentValue, start uint64) ([]common.Address, []common.Address) {
+	threshold := validatorThreshold(api.oasys.config, env, start)
+	selected := &getNextValidatorsResult{}
+	for i, stake := range candidates.Stakes {
+		if threshold != nil && stake.Cmp(threshold) < 0 {
+			continue
+		}
+		selected.Owners = append(selected.Owners, candidates.Owners[i])
+		selected.Operators = append(selected.Operators, candidates.Operators[i])
+		selected.Stakes = append(selected.Stakes, stake)
+	}
+	selected = selectValidators(api.oasys.config, start, selected)
+
+	active := append([]common.Address{}, selected.Operators...)
+	sort.Sort(validatorsAscending(active))
+	if len(active) == 0 {
+		return active, []common.Address{}
+	}
+	schedule := getValidatorSchedule(api.chain, api.oasys.config, selected.Operators, selected.Stakes, env, start)
+	ordered := make([]common.Address, 0, len(schedule))
+	for number := start; number < start+env.EpochPeriod.Uint64(); number++ {
+		ordered = append(ordered, schedule[number])
+	}
+	return active, ordered
+}
+
+type slashRecord struct {
+	Block hexutil.Uint64 `json:"block"`
+	Epoch uint64         `json:"epoch"`
+}
+
+// GetLastSlash returns the latest block and epoch the given operator was slashed
+// at on the canonical chain, among the recent slashes tracked by the snapshot at
+// the head, or nil if it wasn't slashed. Blocks missed while slashing was paused
+// are included.
+func (api *API) GetLastSlash(operator common.Address) (*slashRecord, error) {
+	header := api.chain.CurrentHeader()
 	if header == nil {
 		return nil, errUnknownBlock
 	}
@@ -74,37 +1251,479 @@ func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	if err != nil {
 		return nil, err
 	}
-	return snap.validators(), nil
+	slashes := snap.Slashes[operator]
+	if len(slashes) == 0 {
+		return nil, nil
+	}
+	last := slashes[len(slashes)-1]
+	return &slashRecord{Block: hexutil.Uint64(last.Number), Epoch: last.Epoch}, nil
 }
 
-// Proposals returns the current proposals the node tries to uphold and vote on.
-func (api *API) Proposals() map[common.Address]bool {
+type slashRisk struct {
+	Operator         common.Address `json:"operator"`
+	MissedBlocks     hexutil.Uint64 `json:"missedBlocks"`
+	JailThreshold    hexutil.Uint64 `json:"jailThreshold"`
+	BlocksUntilSlash hexutil.Uint64 `json:"blocksUntilSlash"` // Further misses this epoch before the validator is jailed
+}
+
+// GetSlashRisk returns the validators which missed any of their scheduled blocks
+// in the current epoch, closest to the jail threshold first. A block is missed
+// when sealed by another validator than the scheduled one, which is slashed for
+// it unless in the first epoch.
+func (api *API) GetSlashRisk() ([]*slashRisk, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	missed, err := api.missedBlocks(head, env)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := env.JailThreshold.Uint64()
+	risks := make([]*slashRisk, 0, len(missed))
+	for operator, count := range missed {
+		risk := &slashRisk{
+			Operator:      operator,
+			MissedBlocks:  hexutil.Uint64(count),
+			JailThreshold: hexutil.Uint64(threshold),
+		}
+		if count < threshold {
+			risk.BlocksUntilSlash = hexutil.Uint64(threshold - count)
+		}
+		risks = append(risks, risk)
+	}
+	sort.Slice(risks, func(i, j int) bool {
+		if risks[i].BlocksUntilSlash != risks[j].BlocksUntilSlash {
+			return risks[i].BlocksUntilSlash < risks[j].BlocksUntilSlash
+		}
+		return bytes.Compare(risks[i].Operator[:], risks[j].Operator[:]) < 0
+	})
+	return risks, nil
+}
+
+// missedBlocks counts the blocks of the current epoch up to the given head each
+// validator was scheduled for but sealed by another one.
+func (api *API) missedBlocks(head *types.Header, env *environmentValue) (map[common.Address]uint64, error) {
+	schedule, err := api.oasys.scheduleAt(api.chain, head)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		number = head.Number.Uint64()
+		start  = env.GetFirstBlock(number)
+		missed = make(map[common.Address]uint64)
+	)
+	if start < api.oasys.config.Epoch {
+		start = api.oasys.config.Epoch
+	}
+	for n := start; n <= number; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		if header.Difficulty.Cmp(diffInTurn) == 0 {
+			continue
+		}
+		validator, err := ecrecover(api.oasys.config, header, api.oasys.signatures)
+		if err != nil {
+			return nil, err
+		}
+		if expected := schedule[n]; validator != expected {
+			missed[expected]++
+		}
+	}
+	return missed, nil
+}
+
+// GetJailPending returns the operators which missed at least the jail threshold
+// of their scheduled blocks in the current epoch, but the StakeManager doesn't
+// report as jailed for the next epoch yet. Unless the misses are rolled back by a
+// reorg, they are jailed by the next boundary.
+func (api *API) GetJailPending() ([]common.Address, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+	missed, err := api.missedBlocks(head, env)
+	if err != nil {
+		return nil, err
+	}
+
+	epoch := env.Epoch(head.Number.Uint64())
+	validators, err := getNextValidatorsPaged(api.oasys.ethAPI, head.Hash(), epoch, nil, api.oasys.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	pending := []common.Address{}
+	for i, operator := range validators.Operators {
+		if missed[operator] == 0 || missed[operator] < env.JailThreshold.Uint64() {
+			continue
+		}
+		jailed, err := isValidatorJailed(api.oasys.ethAPI, head.Hash(), validators.Owners[i], epoch+1)
+		if err != nil {
+			return nil, err
+		}
+		if !jailed {
+			pending = append(pending, operator)
+		}
+	}
+	sort.Sort(validatorsAscending(pending))
+	return pending, nil
+}
+
+type outOfTurnBlock struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Signer    common.Address `json:"signer"`
+	Scheduled common.Address `json:"scheduled"`
+}
+
+// GetOutOfTurnBlocks returns the canonical blocks of the given epoch sealed with
+// the out-of-turn difficulty, along with their actual and scheduled signers. An
+// epoch still in progress is reported up to the current block.
+func (api *API) GetOutOfTurnBlocks(epoch uint64) ([]*outOfTurnBlock, error) {
+	start, err := api.epochFirstBlock(epoch)
+	if err != nil {
+		return nil, err
+	}
+	head := api.chain.CurrentHeader()
+	if start > head.Number.Uint64() {
+		return nil, fmt.Errorf("epoch %d not started yet", epoch)
+	}
+	first := api.chain.GetHeaderByNumber(start)
+	if first == nil {
+		return nil, errUnknownBlock
+	}
+	env, err := api.oasys.environment(api.chain, first, nil)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := api.oasys.scheduleAt(api.chain, first)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start + env.EpochPeriod.Uint64() - 1
+	if end > head.Number.Uint64() {
+		end = head.Number.Uint64()
+	}
+	blocks := []*outOfTurnBlock{}
+	for n := start; n <= end; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		if n == 0 || header.Difficulty.Cmp(diffNoTurn) != 0 {
+			continue
+		}
+		signer, err := ecrecover(api.oasys.config, header, api.oasys.signatures)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &outOfTurnBlock{
+			Number:    hexutil.Uint64(n),
+			Signer:    signer,
+			Scheduled: schedule[n],
+		})
+	}
+	return blocks, nil
+}
+
+type scheduledBlock struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+// GetMySchedule returns up to count upcoming blocks the local signer is scheduled
+// to seal in-turn, with timestamps estimated from the block period. Only the
+// schedule of the epoch of the next block is known, so the result is cut at its
+// end.
+func (api *API) GetMySchedule(count uint64) ([]*scheduledBlock, error) {
 	api.oasys.lock.RLock()
-	defer api.oasys.lock.RUnlock()
+	signer := api.oasys.signer
+	api.oasys.lock.RUnlock()
+	if signer == (common.Address{}) {
+		return nil, errors.New("no signer authorized, the node is an observer")
+	}
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
 
-	proposals := make(map[common.Address]bool)
-	for address, auth := range api.oasys.proposals {
-		proposals[address] = auth
+	// The schedule and environment only depend on the number and the parent
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	env, err := api.oasys.environment(api.chain, pending, nil)
+	if err != nil {
+		return nil, err
 	}
-	return proposals
+	schedule, err := api.oasys.scheduleAt(api.chain, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []*scheduledBlock{}
+	end := env.GetFirstBlock(pending.Number.Uint64()) + env.EpochPeriod.Uint64()
+	for number := pending.Number.Uint64(); number < end && uint64(len(blocks)) < count; number++ {
+		if schedule[number] != signer {
+			continue
+		}
+		blocks = append(blocks, &scheduledBlock{
+			Number:    hexutil.Uint64(number),
+			Timestamp: hexutil.Uint64(head.Time + (number-head.Number.Uint64())*env.BlockPeriod.Uint64()),
+		})
+	}
+	return blocks, nil
 }
 
-// Propose injects a new authorization proposal that the signer will attempt to
-// push through.
-func (api *API) Propose(address common.Address, auth bool) {
-	api.oasys.lock.Lock()
-	defer api.oasys.lock.Unlock()
+// GetClockSkew returns the estimated skew in seconds of the local clock against
+// the timestamps of the recently arrived blocks. A positive skew means the local
+// clock is behind the chain.
+func (api *API) GetClockSkew() int64 {
+	return api.oasys.clock.skew()
+}
 
-	api.oasys.proposals[address] = auth
+// stateReader is implemented by chains giving access to their state, such as
+// core.BlockChain.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
 }
 
-// Discard drops a currently running proposal, stopping the signer from casting
-// further votes (either for or against).
-func (api *API) Discard(address common.Address) {
-	api.oasys.lock.Lock()
-	defer api.oasys.lock.Unlock()
+// GetSealTimingStats returns the percentiles of the seconds the given number of
+// most recently verified blocks were sealed after their slot opened, backoff
+// included. A zero window covers all the blocks remembered since the node
+// started, up to the latest sealTimingSamples.
+func (api *API) GetSealTimingStats(window uint64) *sealTimingStats {
+	if window > sealTimingSamples {
+		window = sealTimingSamples
+	}
+	return api.oasys.timing.stats(int(window))
+}
 
-	delete(api.oasys.proposals, address)
+type engineCacheStats struct {
+	Signatures   *cacheStats `json:"signatures"`
+	Snapshots    *cacheStats `json:"snapshots"`
+	Environments *cacheStats `json:"environments"`
+}
+
+// GetCacheStats returns the lookups served from and missing the caches of the
+// engine since it started: the recovered signers, the snapshots holding the
+// validator sets, and the environment values. The latter are held by the
+// snapshots and read from the Environment contract at epoch blocks only, which
+// are counted as misses, so they come with no size of their own.
+func (api *API) GetCacheStats() *engineCacheStats {
+	return &engineCacheStats{
+		Signatures:   api.oasys.signatures.stats(),
+		Snapshots:    api.oasys.recents.stats(),
+		Environments: api.oasys.environments.stats(),
+	}
+}
+
+// GetSystemTxGasEstimate returns the gas the system transactions of the given
+// block are expected to use, by simulating them on the state of its parent.
+func (api *API) GetSystemTxGasEstimate(number rpc.BlockNumber) (*systemTxGas, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else if number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil || header.Number.Uint64() == 0 {
+		return nil, errUnknownBlock
+	}
+	reader, ok := api.chain.(stateReader)
+	if !ok {
+		return nil, errors.New("chain state not available")
+	}
+	parent := api.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := reader.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	return api.oasys.estimateSystemTxGas(api.chain, statedb, header)
+}
+
+// GetLastMissedSlot returns the latest block the chain stalled at, along with
+// the scheduled validator who failed to seal it, or nil if none was missed since
+// the node started.
+func (api *API) GetLastMissedSlot() *missedSlot {
+	return api.oasys.liveness.last()
+}
+
+// GetLastRejection returns the most recent header that failed verification,
+// along with the reason, or nil if none was rejected since the node started.
+func (api *API) GetLastRejection() *rejection {
+	return api.oasys.rejected.last()
+}
+
+type selfTestCheck struct {
+	Name    string `json:"name"`
+	Pass    bool   `json:"pass"`
+	Message string `json:"message"`
+}
+
+// SelfTest checks the consensus setup of the node against the current block: the
+// system contracts deployed, the local signer part of the active validators if
+// authorized, the system contract backend reachable, the environment value valid
+// and the local clock skew within a block period.
+func (api *API) SelfTest() ([]*selfTestCheck, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	var checks []*selfTestCheck
+	check := func(name string, err error, message string) {
+		if err != nil {
+			checks = append(checks, &selfTestCheck{Name: name, Message: err.Error()})
+		} else {
+			checks = append(checks, &selfTestCheck{Name: name, Pass: true, Message: message})
+		}
+	}
+
+	// System contracts
+	err := func() error {
+		reader, ok := api.chain.(stateReader)
+		if !ok {
+			return errors.New("chain state not available")
+		}
+		statedb, err := reader.StateAt(head.Root)
+		if err != nil {
+			return err
+		}
+		for _, contract := range []struct {
+			name     string
+			contract *systemContract
+		}{
+			{"Environment", environment},
+			{"StakeManager", stakeManager},
+		} {
+			if !contract.contract.verifyCode(statedb) {
+				return fmt.Errorf("invalid contract code: %s at %v", contract.name, contract.contract.address)
+			}
+		}
+		return nil
+	}()
+	check("systemContracts", err, "Environment and StakeManager deployed")
+
+	// Local signer
+	api.oasys.lock.RLock()
+	signer := api.oasys.signer
+	api.oasys.lock.RUnlock()
+	if signer == (common.Address{}) {
+		check("signer", nil, "no signer authorized, the node is an observer")
+	} else {
+		snap, err := api.oasys.snapshot(api.chain, head.Number.Uint64(), head.Hash(), nil)
+		if err == nil && !snap.exists(signer) {
+			err = fmt.Errorf("signer %v not in the active validators", signer)
+		}
+		check("signer", err, fmt.Sprintf("signer %v in the active validators", signer))
+	}
+
+	// System contract backend
+	_, err = getValidatorOwners(api.oasys.ethAPI, head.Hash())
+	check("backend", err, "StakeManager reachable")
+
+	// Environment value
+	period := api.oasys.config.Period
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	env, err := api.oasys.environment(api.chain, pending, nil)
+	if err == nil {
+		period = env.BlockPeriod.Uint64()
+		err = env.validate(api.oasys.config)
+	}
+	check("environment", err, "environment value valid")
+
+	// Clock skew, tolerated up to a block period like the clock monitor does
+	skew := api.oasys.clock.skew()
+	err = nil
+	if skew > int64(period) || -skew > int64(period) {
+		err = fmt.Errorf("clock skewed by %v, more than the block period of %v", time.Duration(skew)*time.Second, time.Duration(period)*time.Second)
+	}
+	check("clockSkew", err, fmt.Sprintf("clock skewed by %v", time.Duration(skew)*time.Second))
+
+	return checks, nil
+}
+
+type systemTxArgs struct {
+	Validator  common.Address   `json:"validator"`
+	Blocks     hexutil.Uint64   `json:"blocks"`
+	Validators []common.Address `json:"validators"`
+}
+
+type systemTxData struct {
+	To   common.Address `json:"to"`
+	Data hexutil.Bytes  `json:"data"`
+}
+
+// DebugSystemTxData returns the call data the engine sends to the system
+// contracts for the given method, one of Environment.initialize,
+// StakeManager.initialize, StakeManager.slash (validator and blocks) and
+// StakeManager.getTotalRewards (validators).
+func (api *API) DebugSystemTxData(method string, args systemTxArgs) (*systemTxData, error) {
+	var (
+		result = new(systemTxData)
+		err    error
+	)
+	switch method {
+	case "Environment.initialize":
+		result.To = environment.address
+		result.Data, err = environmentInitializeData(api.oasys.config)
+	case "StakeManager.initialize":
+		result.To = stakeManager.address
+		result.Data, err = stakeManagerInitializeData()
+	case "StakeManager.slash":
+		result.To = stakeManager.address
+		result.Data, err = slashData(args.Validator, new(big.Int).SetUint64(uint64(args.Blocks)))
+	case "StakeManager.getTotalRewards":
+		result.To = stakeManager.address
+		result.Data, err = totalRewardsData(args.Validators)
+	default:
+		return nil, fmt.Errorf("unknown system contract method: %s", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type headerVerification struct {
+	Signer common.Address `json:"signer"`
+	Valid  bool           `json:"valid"`
+	Reason string         `json:"reason,omitempty"`
+}
+
+// VerifyHeader checks the seal of an RLP encoded header without any chain context,
+// i.e. that the signature is well-formed and was made by the header's coinbase.
+func (api *API) VerifyHeader(rlpHeader hexutil.Bytes) (*headerVerification, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(rlpHeader, header); err != nil {
+		return nil, err
+	}
+	if len(header.Extra) < extraVanity {
+		return &headerVerification{Reason: errMissingVanity.Error()}, nil
+	}
+	if len(header.Extra) < extraVanity+extraSeal {
+		return &headerVerification{Reason: errMissingSignature.Error()}, nil
+	}
+	signer, err := ecrecover(api.oasys.config, header, api.oasys.signatures)
+	if err != nil {
+		return &headerVerification{Reason: err.Error()}, nil
+	}
+	if signer != header.Coinbase {
+		return &headerVerification{Signer: signer, Reason: errCoinBaseMisMatch.Error()}, nil
+	}
+	return &headerVerification{Signer: signer, Valid: true}, nil
 }
 
 type status struct {
@@ -163,6 +1782,55 @@ type status struct {
 // 	}, nil
 // }
 
+type recoveredSigner struct {
+	Address   common.Address `json:"address"`
+	PublicKey hexutil.Bytes  `json:"publicKey"`
+	Seal      hexutil.Bytes  `json:"seal"`
+}
+
+// RecoverSigner returns the seal of the canonical block at the given number,
+// along with the address and public key of the validator recovered from it. The
+// public key is encoded as the seal scheme of the block defines it, uncompressed
+// for secp256k1.
+func (api *API) RecoverSigner(number rpc.BlockNumber) (*recoveredSigner, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else if number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil, errMissingSignature
+	}
+	seal := header.Extra[len(header.Extra)-extraSeal:]
+
+	scheme, err := sealSchemeAt(api.oasys.config, header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	recoverer, ok := scheme.(publicKeyRecoverer)
+	if !ok {
+		return nil, fmt.Errorf("seal scheme of block %d doesn't recover public keys", header.Number)
+	}
+	chainID := sealChainID(api.oasys.config, header.Number)
+	pubkey, err := recoverer.RecoverPublicKey(header, seal, chainID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := scheme.Recover(header, seal, chainID)
+	if err != nil {
+		return nil, err
+	}
+	return &recoveredSigner{
+		Address:   signer,
+		PublicKey: pubkey,
+		Seal:      common.CopyBytes(seal),
+	}, nil
+}
+
 type blockNumberOrHashOrRLP struct {
 	*rpc.BlockNumberOrHash
 	RLP hexutil.Bytes `json:"rlp,omitempty"`
@@ -0,0 +1,1374 @@
+package oasys
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestWasInTurn(t *testing.T) {
+	validator, _ := crypto.GenerateKey()
+	outsider, _ := crypto.GenerateKey()
+
+	genesis := &types.Header{
+		Number:     common.Big0,
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+common.AddressLength+extraSeal),
+	}
+	copy(genesis.Extra[extraVanity:], crypto.PubkeyToAddress(validator.PublicKey).Bytes())
+
+	// Block 1 is sealed in-turn by the only validator, block 2 out-of-turn by an outsider
+	block1 := makeSignedTestHeader(genesis, diffInTurn, validator)
+	block2 := makeSignedTestHeader(block1, diffNoTurn, outsider)
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis, block1, block2})
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 40}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	testCases := []struct {
+		number          rpc.BlockNumber
+		inTurnDiff      bool
+		scheduledSigner bool
+	}{
+		{1, true, true},
+		{2, false, false},
+		{rpc.LatestBlockNumber, false, false},
+	}
+	for _, tc := range testCases {
+		got, err := api.WasInTurn(tc.number)
+		if err != nil {
+			t.Fatalf("block %d: failed to call WasInTurn: %v", tc.number, err)
+		}
+		if got.InTurnDiff != tc.inTurnDiff {
+			t.Errorf("block %d: InTurnDiff, got %v, want %v", tc.number, got.InTurnDiff, tc.inTurnDiff)
+		}
+		if got.ScheduledSigner != tc.scheduledSigner {
+			t.Errorf("block %d: ScheduledSigner, got %v, want %v", tc.number, got.ScheduledSigner, tc.scheduledSigner)
+		}
+	}
+
+	// Genesis and unknown blocks are rejected
+	for _, number := range []rpc.BlockNumber{0, 3, rpc.PendingBlockNumber} {
+		if _, err := api.WasInTurn(number); err != errUnknownBlock {
+			t.Errorf("block %d: got %v, want %v", number, err, errUnknownBlock)
+		}
+	}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	genesis := &types.Header{Number: common.Big0, Difficulty: diffInTurn}
+
+	engine := New(params.AllOasysProtocolChanges, &params.OasysConfig{Period: 0, Epoch: 40}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{oasys: engine}
+
+	valid := makeSignedTestHeader(genesis, diffInTurn, key)
+	tampered := types.CopyHeader(valid)
+	tampered.Time++
+	truncated := types.CopyHeader(valid)
+	truncated.Extra = truncated.Extra[:extraVanity]
+
+	testCases := []struct {
+		header *types.Header
+		valid  bool
+		reason error
+	}{
+		{valid, true, nil},
+		{tampered, false, errCoinBaseMisMatch},
+		{truncated, false, errMissingSignature},
+	}
+	for i, tc := range testCases {
+		blob, err := rlp.EncodeToBytes(tc.header)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode header: %v", i, err)
+		}
+		got, err := api.VerifyHeader(blob)
+		if err != nil {
+			t.Fatalf("test %d: failed to call VerifyHeader: %v", i, err)
+		}
+		if got.Valid != tc.valid {
+			t.Errorf("test %d: valid, got %v, want %v", i, got.Valid, tc.valid)
+		}
+		if tc.reason != nil && got.Reason != tc.reason.Error() {
+			t.Errorf("test %d: reason, got %q, want %q", i, got.Reason, tc.reason)
+		}
+		if tc.valid && got.Signer != signer {
+			t.Errorf("test %d: signer, got %v, want %v", i, got.Signer, signer)
+		}
+	}
+
+	if _, err := api.VerifyHeader([]byte{0x01, 0x02}); err == nil {
+		t.Error("expected error for malformed RLP")
+	}
+}
+
+func TestGetBlockPeriod(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The period is kept at the first epoch boundary and changed at the second
+	engine := New(chain.Config(), &params.OasysConfig{Period: 3, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: validator,
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash():  func(env *environmentValue) { env.BlockPeriod = big.NewInt(3) },
+			headers[19].Hash(): func(env *environmentValue) { env.BlockPeriod = big.NewInt(6) },
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	testCases := []struct {
+		number rpc.BlockNumber
+		want   uint64
+	}{
+		{0, 3},
+		{9, 3},
+		{10, 3},
+		{19, 3},
+		{20, 6},
+		{25, 6},
+		{rpc.LatestBlockNumber, 6},
+	}
+	for _, tc := range testCases {
+		got, err := api.GetBlockPeriod(tc.number)
+		if err != nil {
+			t.Fatalf("block %d: failed to call GetBlockPeriod: %v", tc.number, err)
+		}
+		if uint64(got) != tc.want {
+			t.Errorf("block %d: period, got %v, want %v", tc.number, got, tc.want)
+		}
+	}
+
+	for _, number := range []rpc.BlockNumber{26, rpc.PendingBlockNumber} {
+		if _, err := api.GetBlockPeriod(number); err != errUnknownBlock {
+			t.Errorf("block %d: got %v, want %v", number, err, errUnknownBlock)
+		}
+	}
+}
+
+func TestGetEnvironment(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 20)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The sample environment of TestGetNextEnvironmentValue, served from block 20
+	config := &params.OasysConfig{Period: 3, Epoch: 20}
+	backend := newTestStakeManager(&environmentValue{
+		StartBlock:         common.Big0,
+		StartEpoch:         common.Big1,
+		BlockPeriod:        big.NewInt(3),
+		EpochPeriod:        big.NewInt(20),
+		RewardRate:         big.NewInt(10),
+		CommissionRate:     big.NewInt(15),
+		ValidatorThreshold: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(10_000_000)),
+		JailThreshold:      big.NewInt(500),
+		JailPeriod:         big.NewInt(2),
+	})
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	got, err := api.GetEnvironment(20)
+	if err != nil {
+		t.Fatalf("failed to call GetEnvironment: %v", err)
+	}
+	want := &decodedEnvironment{
+		StartBlock:         0,
+		StartEpoch:         1,
+		BlockPeriod:        3,
+		EpochPeriod:        20,
+		EpochDuration:      "1m0s",
+		RewardRate:         0.1,
+		CommissionRate:     0.15,
+		ValidatorThreshold: big.NewInt(10_000_000),
+		JailThreshold:      500,
+		JailPeriod:         2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("environment, got %+v, want %+v", got, want)
+	}
+
+	if _, err := api.GetEnvironment(21); err != errUnknownBlock {
+		t.Errorf("unknown block, got %v, want %v", err, errUnknownBlock)
+	}
+}
+
+func TestGetEpochBoundaries(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 45)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// Epochs are shortened from 10 to 5 blocks at block 20
+	nextValues := make(map[common.Hash]func(env *environmentValue))
+	for _, number := range []int{19, 24, 29, 34, 39, 44} {
+		nextValues[headers[number].Hash()] = func(env *environmentValue) { env.EpochPeriod = big.NewInt(5) }
+	}
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator, nextValues: nextValues}
+	api := &API{chain: chain, oasys: engine}
+
+	testCases := []struct {
+		from, to uint64
+		want     []uint64
+	}{
+		{0, 45, []uint64{0, 10, 20, 25, 30, 35, 40, 45}},
+		{1, 19, []uint64{10}},
+		{11, 19, []uint64{}},
+		{20, 20, []uint64{20}},
+		{21, 33, []uint64{25, 30}},
+		{36, 1000, []uint64{40, 45}},
+		{30, 20, []uint64{}},
+		{100, 200, []uint64{}},
+	}
+	for _, tc := range testCases {
+		got, err := api.GetEpochBoundaries(tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("[%d, %d]: failed to call GetEpochBoundaries: %v", tc.from, tc.to, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("[%d, %d]: boundaries, got %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestGetEpochSeed(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator}
+	api := &API{chain: chain, oasys: engine}
+
+	// Epoch 3 starts at block 20, seeded by block 19
+	got, err := api.GetEpochSeed(3)
+	if err != nil {
+		t.Fatalf("failed to call GetEpochSeed: %v", err)
+	}
+	if got.FirstBlock != 20 || got.SourceHash != headers[19].Hash() {
+		t.Errorf("epoch 3, got first block %v source %x, want 20 %x", got.FirstBlock, got.SourceHash, headers[19].Hash())
+	}
+
+	// The seed must drive the same draws as the chooser building the schedule
+	env, err := engine.environment(chain, headers[20], nil)
+	if err != nil {
+		t.Fatalf("failed to get environment: %v", err)
+	}
+	chooser := newWeightedRandomChooser(chain, []common.Address{validator}, []*big.Int{ether}, env, 20)
+	random := rand.New(rand.NewSource(got.Seed))
+	for i := 0; i < 10; i++ {
+		if want, have := chooser.random.Int63(), random.Int63(); want != have {
+			t.Fatalf("draw %d, got %v, want %v", i, have, want)
+		}
+	}
+
+	// The first epoch is seeded by its first block number
+	if got, err := api.GetEpochSeed(1); err != nil || got.Seed != 0 {
+		t.Errorf("epoch 1, got %v (err %v), want seed 0", got, err)
+	}
+	// Epoch 4 is seeded by block 29, which doesn't exist yet
+	for _, epoch := range []uint64{0, 4} {
+		if _, err := api.GetEpochSeed(epoch); err == nil {
+			t.Errorf("epoch %d: seed returned", epoch)
+		}
+	}
+}
+
+func TestGetOperatorHistory(t *testing.T) {
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	var (
+		owner       = common.HexToAddress("0x01")
+		oldOperator = crypto.PubkeyToAddress(oldKey.PublicKey)
+		newOperator = crypto.PubkeyToAddress(newKey.PublicKey)
+	)
+
+	// The operator key is rotated from epoch 3 (block 20)
+	headers := makeSignedTestChain(oldKey, 19)
+	for i := 20; i <= 35; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffInTurn, newKey))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: oldOperator, owner: owner, rotation: 3, rotated: newOperator}
+	api := &API{chain: chain, oasys: engine}
+
+	for _, tc := range []struct {
+		from, to uint64
+		want     []*operatorTerm
+	}{
+		{0, 10, []*operatorTerm{
+			{Operator: oldOperator, FirstEpoch: 2, LastEpoch: 2},
+			{Operator: newOperator, FirstEpoch: 3, LastEpoch: 4},
+		}},
+		{3, 3, []*operatorTerm{{Operator: newOperator, FirstEpoch: 3, LastEpoch: 3}}},
+		{5, 10, []*operatorTerm{}},
+	} {
+		got, err := api.GetOperatorHistory(owner, tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("[%d, %d]: failed to call GetOperatorHistory: %v", tc.from, tc.to, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("[%d, %d]: history, got %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	// Unknown owners have no history
+	if got, err := api.GetOperatorHistory(oldOperator, 0, 10); err != nil || len(got) != 0 {
+		t.Errorf("unknown owner, got %v (err %v), want none", got, err)
+	}
+
+	// Oversized ranges are refused
+	if _, err := api.GetOperatorHistory(owner, 0, maxOperatorHistory); err == nil {
+		t.Error("oversized range, got nil error")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// At epoch 3 (block 20), the second validator is replaced, the signer doubles
+	// its stake and the jail threshold is lowered
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	backend.register(1, []common.Address{signer, validators[0]}, stakes[:2])
+	backend.register(3, []common.Address{signer, validators[1]}, []*big.Int{new(big.Int).Mul(stakes[0], big.NewInt(2)), stakes[1]})
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	if _, err := api.DiffSnapshots(15, 15); err != nil {
+		t.Fatalf("failed to call DiffSnapshots: %v", err)
+	}
+	env.JailThreshold = big.NewInt(300)
+	got, err := api.DiffSnapshots(15, 25)
+	if err != nil {
+		t.Fatalf("failed to call DiffSnapshots: %v", err)
+	}
+	if want := []common.Address{validators[1]}; !reflect.DeepEqual(got.Added, want) {
+		t.Errorf("added, got %v, want %v", got.Added, want)
+	}
+	if want := []common.Address{validators[0]}; !reflect.DeepEqual(got.Removed, want) {
+		t.Errorf("removed, got %v, want %v", got.Removed, want)
+	}
+	if len(got.StakeChanges) != 1 || got.StakeChanges[0].Operator != signer || got.StakeChanges[0].To.ToInt().Cmp(new(big.Int).Mul(stakes[0], big.NewInt(2))) != 0 {
+		t.Errorf("stake changes, got %v, want the signer's stake doubled", got.StakeChanges)
+	}
+	if len(got.Environment) != 1 || got.Environment[0].Field != "JailThreshold" || got.Environment[0].To.ToInt().Int64() != 300 {
+		t.Errorf("environment changes, got %v, want the jail threshold lowered", got.Environment)
+	}
+
+	// Blocks unknown to the chain are rejected
+	if _, err := api.DiffSnapshots(15, 30); err != errUnknownBlock {
+		t.Errorf("unknown block, got %v, want %v", err, errUnknownBlock)
+	}
+}
+
+func TestGetHistoricalValidators(t *testing.T) {
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	var (
+		oldOperator = crypto.PubkeyToAddress(oldKey.PublicKey)
+		newOperator = crypto.PubkeyToAddress(newKey.PublicKey)
+	)
+
+	// The validator set changes from epoch 3 (block 20)
+	headers := makeSignedTestChain(oldKey, 19)
+	for i := 20; i <= 25; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffInTurn, newKey))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: oldOperator, rotation: 3, rotated: newOperator}
+	api := &API{chain: chain, oasys: engine}
+
+	for epoch, want := range map[uint64][]common.Address{
+		1: {oldOperator},
+		2: {oldOperator},
+		3: {newOperator},
+	} {
+		got, err := api.GetHistoricalValidators(epoch)
+		if err != nil {
+			t.Fatalf("epoch %d: failed to call GetHistoricalValidators: %v", epoch, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("epoch %d: validators, got %v, want %v", epoch, got, want)
+		}
+	}
+
+	// Future epochs have no validators yet
+	if _, err := api.GetHistoricalValidators(4); err == nil {
+		t.Error("future epoch: validators returned")
+	}
+}
+
+func TestGetCheckpoint(t *testing.T) {
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	var (
+		oldOperator = crypto.PubkeyToAddress(oldKey.PublicKey)
+		newOperator = crypto.PubkeyToAddress(newKey.PublicKey)
+	)
+
+	// The validator set changes from epoch 3 (block 20)
+	headers := makeSignedTestChain(oldKey, 19)
+	for i := 20; i <= 25; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffInTurn, newKey))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10, CheckpointInterval: 8}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: oldOperator, rotation: 3, rotated: newOperator}
+	api := &API{chain: chain, oasys: engine}
+
+	// Blocks 17 to 24 are sealed by both validators, with the new one active
+	got, err := api.GetCheckpoint(24)
+	if err != nil {
+		t.Fatalf("failed to call GetCheckpoint: %v", err)
+	}
+	signers := []common.Address{oldOperator, newOperator}
+	sort.Sort(validatorsAscending(signers))
+	want := &Checkpoint{
+		Number:  24,
+		Hash:    headers[24].Hash(),
+		SetHash: crypto.Keccak256Hash(newOperator.Bytes()),
+		Signers: signers,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("checkpoint, got %+v, want %+v", got, want)
+	}
+	if got, err := api.GetCheckpoint(8); err != nil || got.SetHash != crypto.Keccak256Hash(oldOperator.Bytes()) {
+		t.Errorf("first checkpoint, got %+v (err %v), want old set", got, err)
+	}
+
+	// Blocks between the intervals carry no checkpoint
+	if _, err := api.GetCheckpoint(20); err == nil {
+		t.Error("checkpoint returned off the interval")
+	}
+}
+
+func TestGetEnvironmentHistory(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: crypto.PubkeyToAddress(key.PublicKey),
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash(): func(env *environmentValue) {
+				env.StartBlock, env.StartEpoch, env.BlockPeriod = big.NewInt(10), big.NewInt(2), big.NewInt(3)
+			},
+			headers[19].Hash(): func(env *environmentValue) {
+				env.StartBlock, env.StartEpoch, env.BlockPeriod = big.NewInt(20), big.NewInt(3), big.NewInt(5)
+			},
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	type value struct{ startBlock, startEpoch, blockPeriod uint64 }
+	testCases := []struct {
+		from, to uint64
+		want     []value
+	}{
+		{0, 25, []value{{0, 1, 0}, {10, 2, 3}, {20, 3, 5}}},
+		{15, 1000, []value{{10, 2, 3}, {20, 3, 5}}},
+		{0, 19, []value{{0, 1, 0}, {10, 2, 3}}},
+		{30, 40, []value{}},
+	}
+	for _, tc := range testCases {
+		got, err := api.GetEnvironmentHistory(tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("[%d, %d]: failed to call GetEnvironmentHistory: %v", tc.from, tc.to, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("[%d, %d]: history length, got %d, want %d", tc.from, tc.to, len(got), len(tc.want))
+		}
+		for i, w := range tc.want {
+			if got[i].StartBlock.Uint64() != w.startBlock || got[i].StartEpoch.Uint64() != w.startEpoch || got[i].BlockPeriod.Uint64() != w.blockPeriod {
+				t.Errorf("[%d, %d]: value %d, got start %v epoch %v period %v, want start %d epoch %d period %d",
+					tc.from, tc.to, i, got[i].StartBlock, got[i].StartEpoch, got[i].BlockPeriod, w.startBlock, w.startEpoch, w.blockPeriod)
+			}
+		}
+	}
+}
+
+func TestGetEpochProgress(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 20)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The contract keeps reporting the shorter period at the following boundaries
+	shorten := func(env *environmentValue) {
+		env.StartBlock, env.StartEpoch, env.EpochPeriod = big.NewInt(10), big.NewInt(2), big.NewInt(4)
+	}
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: crypto.PubkeyToAddress(key.PublicKey),
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash():  shorten,
+			headers[13].Hash(): shorten,
+			headers[17].Hash(): shorten,
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	// Epochs of 4 blocks from block 10 on, block 20 being the third of epoch 4
+	got, err := api.GetEpochProgress()
+	if err != nil {
+		t.Fatalf("failed to call GetEpochProgress: %v", err)
+	}
+	want := &epochProgress{Epoch: 4, EpochStartBlock: 18, EpochLength: 4, CurrentBlock: 20, BlocksRemaining: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("progress, got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetTimeToNextEpoch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 20)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// From block 10 on, epochs are shortened to 4 blocks of 3 seconds
+	shorten := func(env *environmentValue) {
+		env.StartBlock, env.StartEpoch = big.NewInt(10), big.NewInt(2)
+		env.BlockPeriod, env.EpochPeriod = big.NewInt(3), big.NewInt(4)
+	}
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: crypto.PubkeyToAddress(key.PublicKey),
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash():  shorten,
+			headers[13].Hash(): shorten,
+			headers[17].Hash(): shorten,
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	// Block 20 is the third of the epoch starting at block 18
+	got, err := api.GetTimeToNextEpoch()
+	if err != nil {
+		t.Fatalf("failed to call GetTimeToNextEpoch: %v", err)
+	}
+	want := &epochCountdown{NextEpochBlock: 22, Blocks: 2, Seconds: 6, Timestamp: hexutil.Uint64(headers[20].Time + 6)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("countdown, got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetMinStakeToJoin(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 12)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: crypto.PubkeyToAddress(key.PublicKey),
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash(): func(env *environmentValue) { env.ValidatorThreshold = big.NewInt(2) },
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	// Joining doesn't take outbidding the active validator, only the threshold
+	got, err := api.GetMinStakeToJoin()
+	if err != nil {
+		t.Fatalf("failed to call GetMinStakeToJoin: %v", err)
+	}
+	if got.ToInt().Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("got %v, want 2", got.ToInt())
+	}
+}
+
+func TestGetMinStakeToJoinFullSet(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10, MaxValidatorsBlock: common.Big0}
+	env := getInitialEnvironment(config)
+	threshold := env.ValidatorThreshold
+	backend := newTestStakeManager(env)
+	backend.register(1, validators[:3], []*big.Int{
+		new(big.Int).Mul(threshold, big.NewInt(3)),
+		new(big.Int).Mul(threshold, big.NewInt(2)),
+		new(big.Int).Set(threshold),
+	})
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// A full set takes outbidding its lowest stake, a set with room the threshold
+	for _, tc := range []struct {
+		limit uint64
+		want  *big.Int
+	}{
+		{2, new(big.Int).Add(new(big.Int).Mul(threshold, big.NewInt(2)), common.Big1)},
+		{3, new(big.Int).Add(threshold, common.Big1)},
+		{4, threshold},
+	} {
+		engine.config.MaxValidators = tc.limit
+		got, err := api.GetMinStakeToJoin()
+		if err != nil {
+			t.Fatalf("%d validators: failed to call GetMinStakeToJoin: %v", tc.limit, err)
+		}
+		if got.ToInt().Cmp(tc.want) != 0 {
+			t.Errorf("%d validators: got %v, want %v", tc.limit, got.ToInt(), tc.want)
+		}
+	}
+}
+
+func TestPreviewStakeChange(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10, ValidatorThresholdBlock: common.Big0}
+	env := getInitialEnvironment(config)
+	below := new(big.Int).Sub(env.ValidatorThreshold, ether)
+	backend := newTestStakeManager(env)
+	backend.register(1, validators, []*big.Int{stakes[0], stakes[1], stakes[2], below})
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// Staking one more token pushes the candidate over the threshold
+	got, err := api.PreviewStakeChange(validators[3], (*hexutil.Big)(ether))
+	if err != nil {
+		t.Fatalf("failed to call PreviewStakeChange: %v", err)
+	}
+	if got.Epoch != 2 || got.FirstBlock != 10 {
+		t.Errorf("epoch, got %d from block %d, want 2 from block 10", got.Epoch, got.FirstBlock)
+	}
+	before := append([]common.Address{}, validators[:3]...)
+	sort.Sort(validatorsAscending(before))
+	after := append([]common.Address{}, validators...)
+	sort.Sort(validatorsAscending(after))
+	if !reflect.DeepEqual(got.Before, before) {
+		t.Errorf("active set before, got %v, want %v", got.Before, before)
+	}
+	if !reflect.DeepEqual(got.After, after) {
+		t.Errorf("active set after, got %v, want %v", got.After, after)
+	}
+	if len(got.BeforeSchedule) != 10 || len(got.AfterSchedule) != 10 {
+		t.Fatalf("schedule lengths, got %d and %d, want 10", len(got.BeforeSchedule), len(got.AfterSchedule))
+	}
+	for i, validator := range got.BeforeSchedule {
+		if validator == validators[3] {
+			t.Errorf("block %d scheduled to the candidate before the change", 10+i)
+		}
+	}
+}
+
+func TestGetStakeBreakdown(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, validators, stakes)
+	self := new(big.Int).Mul(big.NewInt(4_000_000), ether)
+	backend.selfStakes[validators[0]] = self
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// The stakers reported by the StakeManager split the stake
+	got, err := api.GetStakeBreakdown(validators[0])
+	if err != nil {
+		t.Fatalf("failed to call GetStakeBreakdown: %v", err)
+	}
+	delegated := new(big.Int).Sub(stakes[0], self)
+	if got.SelfStake.ToInt().Cmp(self) != 0 || got.DelegatedStake.ToInt().Cmp(delegated) != 0 || got.TotalStake.ToInt().Cmp(stakes[0]) != 0 {
+		t.Errorf("breakdown, got %v/%v/%v, want %v/%v/%v", got.SelfStake, got.DelegatedStake, got.TotalStake, self, delegated, stakes[0])
+	}
+
+	// Without stakers, the whole stake is the validator's own
+	got, err = api.GetStakeBreakdown(validators[1])
+	if err != nil {
+		t.Fatalf("failed to call GetStakeBreakdown: %v", err)
+	}
+	if got.SelfStake.ToInt().Cmp(stakes[1]) != 0 || got.DelegatedStake.ToInt().Sign() != 0 || got.TotalStake.ToInt().Cmp(stakes[1]) != 0 {
+		t.Errorf("breakdown without stakers, got %v/%v/%v, want %v/0/%v", got.SelfStake, got.DelegatedStake, got.TotalStake, stakes[1], stakes[1])
+	}
+
+	if _, err := api.GetStakeBreakdown(common.HexToAddress("0xdead")); err == nil {
+		t.Error("breakdown of an unknown operator returned")
+	}
+}
+
+func TestGetLastDistribution(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 22)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The test chain signer stays a validator, the first validator earns rewards
+	// and the second one is jailed
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, append([]common.Address{signer}, validators...), append([]*big.Int{common.Big1}, stakes...))
+	backend.rewards[validators[0]] = ether
+	backend.rewards[validators[1]] = ether
+	backend.jailed[validators[1]] = true
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	got, err := api.GetLastDistribution(validators[0])
+	if err != nil {
+		t.Fatalf("failed to call GetLastDistribution: %v", err)
+	}
+	if got.Epoch != 2 || !got.Distributed || got.Amount.ToInt().Cmp(ether) != 0 {
+		t.Errorf("distributing validator, got %+v, want epoch 2 distributing %v", got, ether)
+	}
+
+	got, err = api.GetLastDistribution(validators[1])
+	if err != nil {
+		t.Fatalf("failed to call GetLastDistribution: %v", err)
+	}
+	if got.Epoch != 2 || got.Distributed || got.Amount.ToInt().Sign() != 0 {
+		t.Errorf("jailed validator, got %+v, want epoch 2 without distribution", got)
+	}
+}
+
+func TestGetTotalRewardsHistory(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 35)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The rewards of epochs 2 and 3 are credited at blocks 20 and 30
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, append([]common.Address{signer}, validators...), append([]*big.Int{common.Big1}, stakes...))
+	backend.rewardsAt = map[common.Hash]map[common.Address]*big.Int{
+		headers[19].Hash(): {validators[0]: ether},
+		headers[29].Hash(): {validators[0]: ether, validators[1]: new(big.Int).Mul(big.NewInt(2), ether)},
+	}
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	got, err := api.GetTotalRewardsHistory(1, 5)
+	if err != nil {
+		t.Fatalf("failed to call GetTotalRewardsHistory: %v", err)
+	}
+	want := []*epochRewards{
+		{Epoch: 1, Block: 10, Amount: new(hexutil.Big)},
+		{Epoch: 2, Block: 20, Amount: (*hexutil.Big)(ether)},
+		{Epoch: 3, Block: 30, Amount: (*hexutil.Big)(new(big.Int).Mul(big.NewInt(3), ether))},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("epochs, got %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Epoch != want[i].Epoch || got[i].Block != want[i].Block || got[i].Amount.ToInt().Cmp(want[i].Amount.ToInt()) != 0 {
+			t.Errorf("epoch %d, got %+v, want %+v", want[i].Epoch, got[i], want[i])
+		}
+	}
+
+	if _, err := api.GetTotalRewardsHistory(1, maxRewardsHistory+1); err == nil {
+		t.Error("range beyond the maximum accepted")
+	}
+}
+
+func TestGetEffectiveCommission(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, validators, stakes)
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// The initial environment charges 10 basis points from genesis on
+	got, err := api.GetEffectiveCommission(validators[0])
+	if err != nil {
+		t.Fatalf("failed to call GetEffectiveCommission: %v", err)
+	}
+	if got.Percent != 0.1 || got.Since != 0 {
+		t.Errorf("commission, got %v%% since block %d, want 0.1%% since block 0", got.Percent, got.Since)
+	}
+
+	if _, err := api.GetEffectiveCommission(common.HexToAddress("0xdead")); err == nil {
+		t.Error("commission of an unknown operator returned")
+	}
+}
+
+func TestGetSecurity(t *testing.T) {
+	chain := newTestChainReader(0)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	// Five validators staking 25, 25, 20, 15 and 15 ether
+	genesis := chain.canonical[0]
+	operators := make([]common.Address, 5)
+	for i := range operators {
+		operators[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	snap := newSnapshot(engine.config, engine.signatures, nil, 0, genesis.Hash(), operators, getInitialEnvironment(engine.config))
+	for i, stake := range []int64{15, 25, 20, 25, 15} {
+		snap.Validators[operators[i]] = new(big.Int).Mul(big.NewInt(stake), ether)
+	}
+	engine.recents.Add(snap.Hash, snap)
+
+	latest := rpc.LatestBlockNumber
+	got, err := api.GetSecurity(&latest)
+	if err != nil {
+		t.Fatalf("failed to call GetSecurity: %v", err)
+	}
+	stake := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), ether) }
+	if got.TotalStake.ToInt().Cmp(stake(100)) != 0 {
+		t.Errorf("total stake, got %v, want %v", got.TotalStake, stake(100))
+	}
+	// The two largest validators hold more than a third, but exactly half only
+	if got.LivenessAttack.ToInt().Cmp(stake(50)) != 0 || got.LivenessValidators != 2 {
+		t.Errorf("liveness attack, got %v by %d validators, want %v by 2", got.LivenessAttack, got.LivenessValidators, stake(50))
+	}
+	if got.SafetyAttack.ToInt().Cmp(stake(70)) != 0 || got.SafetyValidators != 3 {
+		t.Errorf("safety attack, got %v by %d validators, want %v by 3", got.SafetyAttack, got.SafetyValidators, stake(70))
+	}
+}
+
+func TestProjectIssuance(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The reward rate doubles from the second epoch on, while half the stake leaves
+	config := &params.OasysConfig{Period: 1, Epoch: 10}
+	next := getInitialEnvironment(config)
+	next.StartBlock, next.StartEpoch, next.RewardRate = big.NewInt(10), big.NewInt(2), big.NewInt(20)
+	backend := newTestStakeManager(next)
+	backend.register(1, validators, stakes)
+	backend.register(2, validators[:2], stakes[:2])
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// Rewards of an epoch of 10 one-second blocks at the given annual rate
+	rewards := func(stake *big.Int, rate int64) *big.Int {
+		r := new(big.Int).Mul(stake, big.NewInt(rate))
+		r.Div(r, big.NewInt(10_000))
+		r.Mul(r, big.NewInt(10))
+		return r.Div(r, big.NewInt(365*24*60*60))
+	}
+	first := rewards(new(big.Int).Mul(stakes[0], big.NewInt(4)), 10)
+	second := rewards(new(big.Int).Mul(stakes[0], big.NewInt(2)), 20)
+
+	got, err := api.ProjectIssuance(1, 1)
+	if err != nil {
+		t.Fatalf("failed to project issuance: %v", err)
+	}
+	if got.ToInt().Cmp(first) != 0 {
+		t.Errorf("first epoch, got %v, want %v", got, first)
+	}
+	got, err = api.ProjectIssuance(1, 2)
+	if err != nil {
+		t.Fatalf("failed to project issuance: %v", err)
+	}
+	if want := new(big.Int).Add(first, second); got.ToInt().Cmp(want) != 0 {
+		t.Errorf("both epochs, got %v, want %v", got, want)
+	}
+	if _, err := api.ProjectIssuance(2, 1); err == nil {
+		t.Error("inverted epoch range accepted")
+	}
+	if _, err := api.ProjectIssuance(1, maxIssuanceProjection+1); err == nil {
+		t.Error("epoch range over the cap accepted")
+	}
+}
+
+func TestValidateEnvironmentProposal(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+	config := &params.OasysConfig{Period: 1, Epoch: 10}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	// A slight raise of the reward rate from the next epoch on
+	safe := getInitialEnvironment(config)
+	safe.StartBlock, safe.StartEpoch, safe.RewardRate = big.NewInt(10), big.NewInt(2), big.NewInt(12)
+	check, err := api.ValidateEnvironmentProposal(safe)
+	if err != nil {
+		t.Fatalf("failed to validate the proposal: %v", err)
+	}
+	if !check.Valid || len(check.Errors) != 0 || len(check.Warnings) != 0 {
+		t.Errorf("safe proposal, got %+v", check)
+	}
+
+	// Rates above 100% and a mismatching start epoch are refused
+	invalid := safe.Copy()
+	invalid.RewardRate, invalid.StartEpoch = big.NewInt(20_000), big.NewInt(3)
+	if check, err = api.ValidateEnvironmentProposal(invalid); err != nil {
+		t.Fatalf("failed to validate the proposal: %v", err)
+	}
+	if check.Valid || len(check.Errors) != 2 {
+		t.Errorf("out of bounds proposal, got %+v, want 2 errors", check)
+	}
+
+	// A tenfold reward rate and a longer epoch starting mid-epoch are valid, but flagged
+	disruptive := safe.Copy()
+	disruptive.StartBlock, disruptive.RewardRate, disruptive.EpochPeriod = big.NewInt(15), big.NewInt(100), big.NewInt(20)
+	if check, err = api.ValidateEnvironmentProposal(disruptive); err != nil {
+		t.Fatalf("failed to validate the proposal: %v", err)
+	}
+	if !check.Valid || len(check.Errors) != 0 || len(check.Warnings) != 2 {
+		t.Errorf("disruptive proposal, got %+v, want 2 warnings", check)
+	}
+}
+
+func TestGetLastSlash(t *testing.T) {
+	chain := newTestChainReader(0)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	// The snapshot at the head tracked two slashes of the validator
+	validator := common.HexToAddress("0x01")
+	snap := newSnapshot(engine.config, engine.signatures, nil, 0, chain.canonical[0].Hash(), []common.Address{validator}, getInitialEnvironment(engine.config))
+	snap.recordSlash(validator, common.Address{}, 12, 2)
+	snap.recordSlash(validator, common.Address{}, 25, 3)
+	engine.recents.Add(snap.Hash, snap)
+
+	got, err := api.GetLastSlash(validator)
+	if err != nil {
+		t.Fatalf("failed to get last slash: %v", err)
+	}
+	if want := (&slashRecord{Block: 25, Epoch: 3}); got == nil || *got != *want {
+		t.Errorf("last slash, got %v, want %v", got, want)
+	}
+	if got, err := api.GetLastSlash(common.HexToAddress("0x02")); got != nil || err != nil {
+		t.Errorf("never slashed, got %v (err %v), want nil", got, err)
+	}
+}
+
+func TestGetSlashRisk(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	// The test chain signer seals every block of epoch 2 out-of-turn, so all the
+	// other validators scheduled in it miss their blocks. Staking less than a
+	// token, it's never scheduled itself
+	headers := makeSignedTestChain(key, 9)
+	for i := 10; i <= 15; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffNoTurn, key))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	env := getInitialEnvironment(config)
+	env.JailThreshold = big.NewInt(5)
+	backend := newTestStakeManager(env)
+	backend.register(1, append([]common.Address{signer}, validators...), append([]*big.Int{common.Big1}, stakes...))
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	schedule, err := engine.scheduleAt(chain, headers[15])
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	resolved, err := engine.environment(chain, headers[15], nil)
+	if err != nil {
+		t.Fatalf("failed to get environment: %v", err)
+	}
+	threshold := resolved.JailThreshold.Uint64()
+	missed := make(map[common.Address]uint64)
+	for n := uint64(10); n <= 15; n++ {
+		if schedule[n] != signer {
+			missed[schedule[n]]++
+		}
+	}
+
+	got, err := api.GetSlashRisk()
+	if err != nil {
+		t.Fatalf("failed to call GetSlashRisk: %v", err)
+	}
+	if len(got) != len(missed) {
+		t.Fatalf("validators at risk, got %d, want %d", len(got), len(missed))
+	}
+	for _, risk := range got {
+		count := missed[risk.Operator]
+		if count == 0 {
+			t.Errorf("validator %x without misses reported", risk.Operator)
+			continue
+		}
+		if uint64(risk.MissedBlocks) != count || uint64(risk.JailThreshold) != threshold {
+			t.Errorf("validator %x: got %d missed of %d, want %d of %d", risk.Operator, risk.MissedBlocks, risk.JailThreshold, count, threshold)
+		}
+		want := uint64(0)
+		if count < threshold {
+			want = threshold - count
+		}
+		if uint64(risk.BlocksUntilSlash) != want {
+			t.Errorf("validator %x: blocks until slash, got %d, want %d", risk.Operator, risk.BlocksUntilSlash, want)
+		}
+	}
+}
+
+func TestGetJailPending(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	// The test chain signer seals every block of epoch 2 out-of-turn, so all the
+	// other validators scheduled in it miss their blocks. Staking less than a
+	// token, it's never scheduled itself
+	headers := makeSignedTestChain(key, 9)
+	for i := 10; i <= 15; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffNoTurn, key))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	backend.register(1, append([]common.Address{signer}, validators...), append([]*big.Int{common.Big1}, stakes...))
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	schedule, err := engine.scheduleAt(chain, headers[15])
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	missed := make(map[common.Address]uint64)
+	var most uint64
+	for n := uint64(10); n <= 15; n++ {
+		if schedule[n] == signer {
+			t.Fatalf("block %d scheduled to the signer staking less than a token", n)
+		}
+		if missed[schedule[n]]++; missed[schedule[n]] > most {
+			most = missed[schedule[n]]
+		}
+	}
+
+	// The validators missing the most blocks just reach the jail threshold
+	env.JailThreshold = new(big.Int).SetUint64(most)
+	engine = New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	want := []common.Address{}
+	for operator, count := range missed {
+		if count == most {
+			want = append(want, operator)
+		}
+	}
+	sort.Sort(validatorsAscending(want))
+
+	got, err := api.GetJailPending()
+	if err != nil {
+		t.Fatalf("failed to call GetJailPending: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pending, got %v, want %v", got, want)
+	}
+
+	// Once jailed by the StakeManager, a validator isn't pending anymore
+	backend.jailed[want[0]] = true
+	if got, err = api.GetJailPending(); err != nil {
+		t.Fatalf("failed to call GetJailPending: %v", err)
+	}
+	if !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("pending after jailing, got %v, want %v", got, want[1:])
+	}
+}
+
+func TestGetMySchedule(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 12)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: signer,
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash(): func(env *environmentValue) { env.BlockPeriod = big.NewInt(5) },
+		},
+	}
+	api := &API{chain: chain, oasys: engine}
+
+	if _, err := api.GetMySchedule(3); err == nil {
+		t.Error("expected error in observer mode")
+	}
+	engine.Authorize(signer, nil, nil)
+
+	// The sole validator seals every remaining block of epoch 2
+	head := headers[12]
+	got, err := api.GetMySchedule(3)
+	if err != nil {
+		t.Fatalf("failed to call GetMySchedule: %v", err)
+	}
+	want := []*scheduledBlock{
+		{Number: 13, Timestamp: hexutil.Uint64(head.Time + 5)},
+		{Number: 14, Timestamp: hexutil.Uint64(head.Time + 10)},
+		{Number: 15, Timestamp: hexutil.Uint64(head.Time + 15)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schedule, got %v, want %v", got, want)
+	}
+
+	// The schedule of the next epoch isn't known yet
+	if got, err := api.GetMySchedule(20); err != nil || len(got) != 7 || got[6].Number != 19 {
+		t.Errorf("schedule until the end of the epoch, got %v (err %v), want blocks 13 to 19", got, err)
+	}
+}
+
+func TestDebugSystemTxData(t *testing.T) {
+	config := &params.OasysConfig{Period: 15, Epoch: 5760}
+	api := &API{oasys: New(params.TestChainConfig, config, rawdb.NewMemoryDatabase(), nil)}
+
+	var (
+		validator  = common.HexToAddress("0x01")
+		validators = []common.Address{common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+	)
+	testCases := []struct {
+		method string
+		args   systemTxArgs
+		to     common.Address
+		want   []interface{}
+	}{
+		{"Environment.initialize", systemTxArgs{}, environment.address, []interface{}{getInitialEnvironment(config)}},
+		{"StakeManager.initialize", systemTxArgs{}, stakeManager.address, []interface{}{environment.address, common.HexToAddress(allowListAddress)}},
+		{"StakeManager.slash", systemTxArgs{Validator: validator, Blocks: 42}, stakeManager.address, []interface{}{validator, big.NewInt(42)}},
+		{"StakeManager.getTotalRewards", systemTxArgs{Validators: validators}, stakeManager.address, []interface{}{validators, common.Big1}},
+	}
+	for _, tc := range testCases {
+		got, err := api.DebugSystemTxData(tc.method, tc.args)
+		if err != nil {
+			t.Fatalf("%s: failed to call DebugSystemTxData: %v", tc.method, err)
+		}
+		if got.To != tc.to {
+			t.Errorf("%s: to, got %v, want %v", tc.method, got.To, tc.to)
+		}
+
+		contract := stakeManager
+		if tc.to == environment.address {
+			contract = environment
+		}
+		method, err := contract.abi.MethodById(got.Data)
+		if err != nil {
+			t.Fatalf("%s: failed to find method: %v", tc.method, err)
+		}
+		args, err := method.Inputs.Unpack(got.Data[4:])
+		if err != nil {
+			t.Fatalf("%s: failed to decode call data: %v", tc.method, err)
+		}
+		want, _ := method.Inputs.Pack(tc.want...)
+		have, _ := method.Inputs.Pack(args...)
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s: arguments, got %v, want %v", tc.method, args, tc.want)
+		}
+	}
+
+	if _, err := api.DebugSystemTxData("StakeManager.unknown", systemTxArgs{}); err == nil {
+		t.Error("unknown method accepted")
+	}
+}
+
+func TestGetOutOfTurnBlocks(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	outsider, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	// Block 13 of epoch 2 is sealed out-of-turn by an outsider
+	headers := makeSignedTestChain(key, 12)
+	headers = append(headers, makeSignedTestHeader(headers[12], diffNoTurn, outsider))
+	for i := 14; i <= 15; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffInTurn, key))
+	}
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator}
+	api := &API{chain: chain, oasys: engine}
+
+	got, err := api.GetOutOfTurnBlocks(2)
+	if err != nil {
+		t.Fatalf("failed to call GetOutOfTurnBlocks: %v", err)
+	}
+	want := []*outOfTurnBlock{{Number: 13, Signer: crypto.PubkeyToAddress(outsider.PublicKey), Scheduled: validator}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("epoch 2, got %v, want %v", got, want)
+	}
+
+	if got, err := api.GetOutOfTurnBlocks(1); err != nil || len(got) != 0 {
+		t.Errorf("epoch 1, got %v (err %v), want none", got, err)
+	}
+	for _, epoch := range []uint64{0, 3} {
+		if _, err := api.GetOutOfTurnBlocks(epoch); err == nil {
+			t.Errorf("epoch %d: blocks returned", epoch)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	outsider, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+
+	// Only the Environment contract is deployed at the head
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(environment.address, common.FromHex(environment.artifact.DeployedBytecode))
+	chain := &testStateChainReader{newTestChainReaderWithHeaders(headers), statedb}
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = newTestStakeManager(getInitialEnvironment(config))
+	engine.Authorize(crypto.PubkeyToAddress(outsider.PublicKey), nil, nil)
+	api := &API{chain: chain, oasys: engine}
+
+	checks, err := api.SelfTest()
+	if err != nil {
+		t.Fatalf("failed to call SelfTest: %v", err)
+	}
+	want := map[string]bool{
+		"systemContracts": false,
+		"signer":          false,
+		"backend":         true,
+		"environment":     true,
+		"clockSkew":       true,
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("checks, got %d, want %d", len(checks), len(want))
+	}
+	for _, check := range checks {
+		if pass, ok := want[check.Name]; !ok || check.Pass != pass {
+			t.Errorf("check %s, got pass %v (%s), want %v", check.Name, check.Pass, check.Message, pass)
+		}
+		if check.Name == "systemContracts" && !strings.Contains(check.Message, "StakeManager") {
+			t.Errorf("check %s, got message %q, want StakeManager reported", check.Name, check.Message)
+		}
+	}
+}
+
+// testStateChainReader is a test chain giving access to a fixed state.
+type testStateChainReader struct {
+	*testChainReader
+	statedb *state.StateDB
+}
+
+func (r *testStateChainReader) StateAt(root common.Hash) (*state.StateDB, error) {
+	return r.statedb.Copy(), nil
+}
+
+func TestRecoverSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 2)
+
+	// Block 3 carries no seal
+	headers = append(headers, &types.Header{
+		ParentHash: headers[2].Hash(),
+		Number:     big.NewInt(3),
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity),
+	})
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	got, err := api.RecoverSigner(1)
+	if err != nil {
+		t.Fatalf("failed to call RecoverSigner: %v", err)
+	}
+	pubkey, err := crypto.UnmarshalPubkey(got.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to decode public key: %v", err)
+	}
+	if derived := crypto.PubkeyToAddress(*pubkey); derived != got.Address {
+		t.Errorf("address derived from public key, got %v, want %v", derived, got.Address)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); got.Address != want {
+		t.Errorf("address, got %v, want %v", got.Address, want)
+	}
+	if !bytes.Equal(got.Seal, headers[1].Extra[len(headers[1].Extra)-extraSeal:]) {
+		t.Errorf("seal, got %x, want the extra-data suffix", got.Seal)
+	}
+
+	if _, err := api.RecoverSigner(3); err != errMissingSignature {
+		t.Errorf("unsealed block, got %v, want %v", err, errMissingSignature)
+	}
+	if _, err := api.RecoverSigner(4); err != errUnknownBlock {
+		t.Errorf("unknown block, got %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// makeSignedTestChain creates a chain of the given length on top of a genesis
+// naming the key's address as the only validator, sealed in-turn by that key.
+// The genesis is included as the first header.
+func makeSignedTestChain(key *ecdsa.PrivateKey, length int) []*types.Header {
+	genesis := &types.Header{
+		Number:     common.Big0,
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+common.AddressLength+extraSeal),
+	}
+	copy(genesis.Extra[extraVanity:], crypto.PubkeyToAddress(key.PublicKey).Bytes())
+
+	headers := []*types.Header{genesis}
+	for i := 1; i <= length; i++ {
+		headers = append(headers, makeSignedTestHeader(headers[i-1], diffInTurn, key))
+	}
+	return headers
+}
+
+// makeSignedTestHeader creates a header on top of the given parent, sealed by
+// the given key.
+func makeSignedTestHeader(parent *types.Header, difficulty *big.Int, key *ecdsa.PrivateKey) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  uncleHash,
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Difficulty: new(big.Int).Set(difficulty),
+		Time:       parent.Time + 1,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	sig, _ := crypto.Sign(sealHash(header, nil).Bytes(), key)
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+	return header
+}
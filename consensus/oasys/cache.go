@@ -0,0 +1,56 @@
+package oasys
+
+import (
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+type cacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+// lookupCounter counts the lookups served from a cache and the ones missing it.
+type lookupCounter struct {
+	hits   uint64
+	misses uint64
+}
+
+func (c *lookupCounter) hit()  { atomic.AddUint64(&c.hits, 1) }
+func (c *lookupCounter) miss() { atomic.AddUint64(&c.misses, 1) }
+
+func (c *lookupCounter) stats() *cacheStats {
+	return &cacheStats{Hits: atomic.LoadUint64(&c.hits), Misses: atomic.LoadUint64(&c.misses)}
+}
+
+// countingCache is an ARC cache counting the hits and misses of its lookups.
+type countingCache struct {
+	*lru.ARCCache
+	lookupCounter
+	capacity int
+}
+
+func newCountingCache(capacity int) *countingCache {
+	cache, _ := lru.NewARC(capacity)
+	return &countingCache{ARCCache: cache, capacity: capacity}
+}
+
+// Get looks up a key's value from the cache, counting whether it was found.
+func (c *countingCache) Get(key interface{}) (interface{}, bool) {
+	value, ok := c.ARCCache.Get(key)
+	if ok {
+		c.hit()
+	} else {
+		c.miss()
+	}
+	return value, ok
+}
+
+func (c *countingCache) stats() *cacheStats {
+	stats := c.lookupCounter.stats()
+	stats.Size, stats.Capacity = c.Len(), c.capacity
+	return stats
+}
@@ -0,0 +1,62 @@
+package oasys
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestGetCacheStats(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 15)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, []common.Address{crypto.PubkeyToAddress(key.PublicKey)}, stakes[:1])
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// Repeated lookups are served from the caches
+	check := func(name string, stats *cacheStats, hits, misses uint64) {
+		t.Helper()
+		if stats.Hits != hits || stats.Misses != misses {
+			t.Errorf("%s, got %d hits %d misses, want %d %d", name, stats.Hits, stats.Misses, hits, misses)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ecrecover(engine.config, headers[1], engine.signatures); err != nil {
+			t.Fatalf("failed to recover signer: %v", err)
+		}
+	}
+	check("signatures", api.GetCacheStats().Signatures, 1, 1)
+
+	snapshots := *api.GetCacheStats().Snapshots
+	for i := 0; i < 2; i++ {
+		if _, err := engine.snapshot(chain, 15, headers[15].Hash(), nil); err != nil {
+			t.Fatalf("failed to get snapshot: %v", err)
+		}
+	}
+	stats := api.GetCacheStats().Snapshots
+	if stats.Hits != snapshots.Hits+1 || stats.Misses <= snapshots.Misses {
+		t.Errorf("snapshots, got %d hits %d misses, want one more hit and new misses over %d %d", stats.Hits, stats.Misses, snapshots.Hits, snapshots.Misses)
+	}
+	if stats.Size == 0 || stats.Capacity != inmemorySnapshots {
+		t.Errorf("snapshots, got size %d capacity %d, want entries of %d", stats.Size, stats.Capacity, inmemorySnapshots)
+	}
+
+	// The environment is read from the contract at epoch blocks only
+	environments := *api.GetCacheStats().Environments
+	for _, header := range []*types.Header{headers[5], headers[10], headers[15]} {
+		if _, err := engine.environment(chain, header, nil); err != nil {
+			t.Fatalf("block %d: failed to get environment: %v", header.Number, err)
+		}
+	}
+	check("environments", api.GetCacheStats().Environments, environments.Hits+2, environments.Misses+1)
+}
@@ -0,0 +1,157 @@
+package oasys
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errCheckpointMismatch is returned if the header at the height of the trusted
+	// checkpoint isn't the trusted block.
+	errCheckpointMismatch = errors.New("header mismatches trusted checkpoint")
+
+	// errCheckpointValidators is returned if the validators active at the trusted
+	// checkpoint differ from the trusted ones.
+	errCheckpointValidators = errors.New("validators mismatch trusted checkpoint")
+)
+
+// Checkpoint commits to the validator set active at a block taken every
+// CheckpointInterval blocks, along with the validators who sealed the blocks
+// since the previous checkpoint, for light clients to track the set without
+// following every epoch.
+type Checkpoint struct {
+	Number  hexutil.Uint64   `json:"number"`
+	Hash    common.Hash      `json:"hash"`
+	SetHash common.Hash      `json:"setHash"` // Hash of the sorted active validators
+	Signers []common.Address `json:"signers"` // Sorted validators who sealed the blocks of the interval
+}
+
+// validatorSetHash returns the hash of the concatenated validator addresses,
+// which must be sorted.
+func validatorSetHash(validators []common.Address) common.Hash {
+	data := make([]byte, 0, len(validators)*common.AddressLength)
+	for _, validator := range validators {
+		data = append(data, validator.Bytes()...)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// checkpoint builds the checkpoint at the given header, which must be at a
+// multiple of the checkpoint interval.
+func (c *Oasys) checkpoint(chain consensus.ChainHeaderReader, header *types.Header) (*Checkpoint, error) {
+	interval := c.config.CheckpointInterval
+	number := header.Number.Uint64()
+	if interval == 0 {
+		return nil, errors.New("checkpoints disabled")
+	}
+	if number == 0 || number%interval != 0 {
+		return nil, fmt.Errorf("no checkpoint at block %d, interval is %d", number, interval)
+	}
+	snap, err := c.snapshot(chain, number, header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the signers of the interval, walking back from the checkpoint
+	seen := make(map[common.Address]bool)
+	signers := []common.Address{}
+	for current := header; current.Number.Uint64() > number-interval; {
+		signer, err := ecrecover(c.config, current, c.signatures)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[signer] {
+			seen[signer] = true
+			signers = append(signers, signer)
+		}
+		if current = chain.GetHeader(current.ParentHash, current.Number.Uint64()-1); current == nil {
+			return nil, errUnknownBlock
+		}
+	}
+	sort.Sort(validatorsAscending(signers))
+
+	return &Checkpoint{
+		Number:  hexutil.Uint64(number),
+		Hash:    header.Hash(),
+		SetHash: validatorSetHash(snap.validators()),
+		Signers: signers,
+	}, nil
+}
+
+// verifyTrustedCheckpoint checks that the header at the height of the trusted
+// checkpoint of the config, if any, is the trusted block.
+func verifyTrustedCheckpoint(config *params.OasysConfig, header *types.Header) error {
+	trusted := config.TrustedCheckpoint
+	if trusted == nil || header.Number.Uint64() != trusted.Number {
+		return nil
+	}
+	if header.Hash() != trusted.Hash {
+		return errCheckpointMismatch
+	}
+	return nil
+}
+
+// isTrustedCheckpoint reports whether the given block is the trusted checkpoint
+// of the config.
+func isTrustedCheckpoint(config *params.OasysConfig, number uint64, hash common.Hash) bool {
+	trusted := config.TrustedCheckpoint
+	return trusted != nil && number == trusted.Number && hash == trusted.Hash
+}
+
+// trustedSnapshot builds the snapshot at the trusted checkpoint from its trusted
+// validators, with the environment and stakes read from the system contracts at
+// the checkpoint, so that the snapshots past it don't need the headers before it.
+// It returns nil if they can't be read, or if the environment in effect at the
+// checkpoint isn't the next one anymore, leaving the snapshot to the chain.
+func (c *Oasys) trustedSnapshot(number uint64, hash common.Hash) *Snapshot {
+	if c.ethAPI == nil {
+		return nil
+	}
+	env, err := getNextEnvironmentValue(c.ethAPI, hash)
+	if err != nil {
+		log.Debug("No environment at the trusted checkpoint", "number", number, "hash", hash, "err", err)
+		return nil
+	}
+	if env.StartBlock.Uint64() > number {
+		return nil
+	}
+	result, err := getNextValidatorsPaged(c.ethAPI, hash, env.Epoch(number), nil, c.tunables.pageSize())
+	if err != nil {
+		log.Debug("No validators at the trusted checkpoint", "number", number, "hash", hash, "err", err)
+		return nil
+	}
+	snap := newSnapshot(c.config, c.signatures, c.ethAPI, number, hash, c.config.TrustedCheckpoint.Validators, env)
+	for i, operator := range result.Operators {
+		if _, ok := snap.Validators[operator]; ok {
+			snap.Validators[operator] = new(big.Int).Set(result.Stakes[i])
+		}
+	}
+	return snap
+}
+
+// verifyCheckpointValidators checks that the validators active at the block of
+// the trusted checkpoint of the config, if any, are the trusted ones.
+func verifyCheckpointValidators(config *params.OasysConfig, number uint64, validators []common.Address) error {
+	trusted := config.TrustedCheckpoint
+	if trusted == nil || number != trusted.Number {
+		return nil
+	}
+	got := append([]common.Address{}, validators...)
+	sort.Sort(validatorsAscending(got))
+	want := append([]common.Address{}, trusted.Validators...)
+	sort.Sort(validatorsAscending(want))
+	if validatorSetHash(got) != validatorSetHash(want) {
+		return errCheckpointValidators
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package oasys
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// clockSkewSamples is the number of recent blocks the clock skew is estimated
+// from.
+const clockSkewSamples = 16
+
+// clockSkewMonitor estimates the skew of the local clock against the chain, from
+// the timestamps of the blocks extending the local head as they arrive. A
+// positive skew means the local clock is behind the chain.
+type clockSkewMonitor struct {
+	now func() time.Time // Local clock, replaceable in tests
+
+	lock    sync.Mutex
+	samples []int64 // Ring buffer of the recent skews in seconds
+	next    int     // Index of the oldest sample once the buffer is full
+	warned  bool    // Whether the current excessive skew was already reported
+}
+
+func newClockSkewMonitor(now func() time.Time) *clockSkewMonitor {
+	return &clockSkewMonitor{now: now}
+}
+
+// observe records the skew between the timestamp of the header and the local
+// clock, warning once the estimated skew exceeds the block period.
+func (m *clockSkewMonitor) observe(header *types.Header, period uint64) {
+	sample := int64(header.Time) - m.now().Unix()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.samples) < clockSkewSamples {
+		m.samples = append(m.samples, sample)
+	} else {
+		m.samples[m.next] = sample
+		m.next = (m.next + 1) % clockSkewSamples
+	}
+	skew := m.estimate()
+	exceeded := skew > int64(period) || -skew > int64(period)
+	if exceeded && !m.warned {
+		log.Warn("Local clock is skewed against block timestamps", "skew", time.Duration(skew)*time.Second, "period", period)
+	}
+	m.warned = exceeded
+}
+
+// skew returns the estimated clock skew in seconds, or zero if no block arrived
+// yet.
+func (m *clockSkewMonitor) skew() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.estimate()
+}
+
+// estimate returns the median of the samples, so that a single late block
+// doesn't move the estimate. The caller must hold the lock.
+func (m *clockSkewMonitor) estimate() int64 {
+	if len(m.samples) == 0 {
+		return 0
+	}
+	sorted := make([]int64, len(m.samples))
+	copy(sorted, m.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// observeClockSkew samples the local clock against the header if it extends the
+// local head, as older blocks arriving during a sync carry stale timestamps.
+func (c *Oasys) observeClockSkew(chain consensus.ChainHeaderReader, header *types.Header) {
+	head := chain.CurrentHeader()
+	if head == nil || header.ParentHash != head.Hash() {
+		return
+	}
+	snap, err := c.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return
+	}
+	c.clock.observe(header, snap.Environment.BlockPeriod.Uint64())
+}
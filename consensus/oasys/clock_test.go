@@ -0,0 +1,46 @@
+package oasys
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	engine := New(params.AllOasysProtocolChanges, &params.OasysConfig{Period: 15, Epoch: 40}, rawdb.NewMemoryDatabase(), nil)
+	engine.clock = newClockSkewMonitor(func() time.Time { return now })
+	api := &API{oasys: engine}
+
+	if skew := api.GetClockSkew(); skew != 0 {
+		t.Errorf("no blocks, got %d, want 0", skew)
+	}
+
+	// Blocks arriving 20 seconds ahead of the local clock, with one late outlier
+	for i, ahead := range []int64{20, 20, -30, 20, 20} {
+		header := &types.Header{Number: big.NewInt(int64(i + 1)), Time: uint64(now.Unix() + ahead)}
+		engine.clock.observe(header, 15)
+		now = now.Add(15 * time.Second)
+	}
+	if skew := api.GetClockSkew(); skew != 20 {
+		t.Errorf("blocks ahead of the clock, got %d, want 20", skew)
+	}
+	if !engine.clock.warned {
+		t.Error("skew beyond the block period not reported")
+	}
+
+	// Once the clock catches up, the oldest samples are dropped
+	for i := 0; i < clockSkewSamples; i++ {
+		engine.clock.observe(&types.Header{Time: uint64(now.Unix() + 1)}, 15)
+	}
+	if skew := api.GetClockSkew(); skew != 1 {
+		t.Errorf("clock caught up, got %d, want 1", skew)
+	}
+	if engine.clock.warned {
+		t.Error("skew within the block period reported")
+	}
+}
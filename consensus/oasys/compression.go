@@ -0,0 +1,107 @@
+package oasys
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// errInvalidCompressedValidators is returned if the compressed validator list of
+// an epoch block can't be decoded against the validators of the previous epoch.
+var errInvalidCompressedValidators = errors.New("invalid compressed validator list on checkpoint block")
+
+// compressValidators encodes the validators, sorted ascending, against the
+// registry of the previous epoch's validators, also sorted. The encoding is a
+// bitmap with the bit of every registry member still a validator set, followed
+// by the addresses of the new validators in ascending order.
+func compressValidators(registry, validators []common.Address) []byte {
+	members := make(map[common.Address]bool, len(validators))
+	for _, validator := range validators {
+		members[validator] = true
+	}
+	data := make([]byte, (len(registry)+7)/8)
+	known := make(map[common.Address]bool, len(registry))
+	for i, validator := range registry {
+		known[validator] = true
+		if members[validator] {
+			data[i/8] |= 1 << (i % 8)
+		}
+	}
+	for _, validator := range validators {
+		if !known[validator] {
+			data = append(data, validator.Bytes()...)
+		}
+	}
+	return data
+}
+
+// decompressValidators decodes validators encoded by compressValidators against
+// the same registry, returning them sorted ascending. Only the canonical encoding
+// is accepted, so that every validator set has a single embedded form.
+func decompressValidators(registry []common.Address, data []byte) ([]common.Address, error) {
+	size := (len(registry) + 7) / 8
+	if len(data) < size || (len(data)-size)%common.AddressLength != 0 {
+		return nil, errInvalidCompressedValidators
+	}
+	known := make(map[common.Address]bool, len(registry))
+	validators := make([]common.Address, 0, len(registry)+(len(data)-size)/common.AddressLength)
+	for i, validator := range registry {
+		known[validator] = true
+		if data[i/8]&(1<<(i%8)) != 0 {
+			validators = append(validators, validator)
+		}
+	}
+	if len(registry)%8 != 0 && data[size-1]>>(len(registry)%8) != 0 {
+		return nil, errInvalidCompressedValidators
+	}
+	var last []byte
+	for added := data[size:]; len(added) > 0; added = added[common.AddressLength:] {
+		validator := common.BytesToAddress(added[:common.AddressLength])
+		if known[validator] || (last != nil && bytes.Compare(last, validator.Bytes()) >= 0) {
+			return nil, errInvalidCompressedValidators
+		}
+		validators = append(validators, validator)
+		last = validator.Bytes()
+	}
+	if len(validators) == 0 {
+		return nil, errInvalidCompressedValidators
+	}
+	sort.Sort(validatorsAscending(validators))
+	return validators, nil
+}
+
+// encodeValidators returns the validators, sorted ascending, as embedded in the
+// extra-data of the given epoch header: concatenated before the compressed
+// extra-data fork, compressed against the previous epoch's validators from it.
+func (c *Oasys) encodeValidators(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, validators []common.Address) ([]byte, error) {
+	if !c.config.IsCompressedExtra(header.Number) {
+		data := make([]byte, 0, len(validators)*common.AddressLength)
+		for _, validator := range validators {
+			data = append(data, validator.Bytes()...)
+		}
+		return data, nil
+	}
+	snap, err := c.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, parents)
+	if err != nil {
+		return nil, err
+	}
+	return compressValidators(snap.validators(), validators), nil
+}
+
+// embeddedValidators returns the validators embedded in the extra-data of the
+// given epoch header, sorted ascending.
+func (c *Oasys) embeddedValidators(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) ([]common.Address, error) {
+	data := header.Extra[extraVanity : len(header.Extra)-extraSeal]
+	if !c.config.IsCompressedExtra(header.Number) {
+		return parseValidatorBytes(data)
+	}
+	snap, err := c.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, parents)
+	if err != nil {
+		return nil, err
+	}
+	return decompressValidators(snap.validators(), data)
+}
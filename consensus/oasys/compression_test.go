@@ -0,0 +1,93 @@
+package oasys
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// sortedAddresses returns count addresses derived from the given offset, sorted.
+func sortedAddresses(offset, count int) []common.Address {
+	addresses := make([]common.Address, count)
+	for i := range addresses {
+		addresses[i] = common.BigToAddress(big.NewInt(int64(offset + i*7 + 1)))
+	}
+	sort.Sort(validatorsAscending(addresses))
+	return addresses
+}
+
+func TestCompressValidators(t *testing.T) {
+	registry := sortedAddresses(0, 10)
+	tests := []struct {
+		name       string
+		validators []common.Address
+	}{
+		{"unchanged", registry},
+		{"removed", append(append([]common.Address{}, registry[:3]...), registry[5:]...)},
+		{"added", append(append([]common.Address{}, registry...), sortedAddresses(1000, 3)...)},
+		{"replaced", append(append([]common.Address{}, registry[1:9]...), sortedAddresses(1000, 2)...)},
+		{"new set", sortedAddresses(1000, 4)},
+	}
+	for _, tt := range tests {
+		validators := append([]common.Address{}, tt.validators...)
+		sort.Sort(validatorsAscending(validators))
+
+		data := compressValidators(registry, validators)
+		got, err := decompressValidators(registry, data)
+		if err != nil {
+			t.Errorf("%s: failed to decompress: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, validators) {
+			t.Errorf("%s: round trip, got %v, want %v", tt.name, got, validators)
+		}
+	}
+
+	// Without registry, the validators are stored as is
+	validators := sortedAddresses(1000, 3)
+	if got, err := decompressValidators(nil, compressValidators(nil, validators)); err != nil || !reflect.DeepEqual(got, validators) {
+		t.Errorf("empty registry, got %v (err %v), want %v", got, err, validators)
+	}
+}
+
+func TestDecompressInvalidValidators(t *testing.T) {
+	registry := sortedAddresses(0, 10)
+	added := sortedAddresses(1000, 2)
+	valid := compressValidators(registry, append(append([]common.Address{}, registry[:5]...), added...))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated bitmap", valid[:1]},
+		{"truncated address", valid[:len(valid)-1]},
+		{"bits past the registry", append([]byte{valid[0], valid[1] | 0x80}, valid[2:]...)},
+		{"empty set", make([]byte, 2)},
+		{"registry member added", append(append([]byte{}, valid...), registry[9].Bytes()...)},
+		{"unsorted additions", append(append(append([]byte{}, valid[:2]...), added[1].Bytes()...), added[0].Bytes()...)},
+	}
+	for _, tt := range tests {
+		if _, err := decompressValidators(registry, tt.data); err != errInvalidCompressedValidators {
+			t.Errorf("%s: got %v, want %v", tt.name, err, errInvalidCompressedValidators)
+		}
+	}
+}
+
+func TestCompressedValidatorsSize(t *testing.T) {
+	// A thousand validators of which a few leave and join at the epoch
+	registry := sortedAddresses(0, 1000)
+	validators := append(append([]common.Address{}, registry[5:]...), sortedAddresses(100_000, 5)...)
+	sort.Sort(validatorsAscending(validators))
+
+	data := compressValidators(registry, validators)
+	raw := len(validators) * common.AddressLength
+	if len(data)*10 > raw {
+		t.Errorf("compressed size %d bytes, want under a tenth of %d", len(data), raw)
+	}
+	if got, err := decompressValidators(registry, data); err != nil || !reflect.DeepEqual(got, validators) {
+		t.Errorf("large set round trip failed: %v", err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"sort"
+	"strings"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
@@ -52,12 +54,29 @@ var (
 			path: "oasys-genesis-contract/artifacts/contracts/StakeManager.sol/StakeManager.json",
 		},
 	}
+	// Allowlist of the StakeManager, whose artifact isn't part of the genesis
+	// contracts, so only the view used by the engine is declared
+	allowList = &systemContract{
+		address: common.HexToAddress(allowListAddress),
+	}
+	allowListAbi = `[{"inputs":[],"name":"getAllowlist","outputs":[{"internalType":"address[]","name":"","type":"address[]"}],"stateMutability":"view","type":"function"}]`
+
 	genesisContracts = map[common.Address]bool{
 		environment.address:  true,
 		stakeManager.address: true,
 	}
+
+	// Denominator of the reward and commission rates, which are basis points
+	maxBasisPoints = big.NewInt(10_000)
+
+	// Seconds in the year the annual reward rate is prorated over
+	secondsPerYear = big.NewInt(365 * 24 * 60 * 60)
 )
 
+// Number of ABI words returned by Environment.nextValue, one per field of the
+// environmentValue
+const environmentValueWords = 9
+
 func init() {
 	// Parse the system contract ABI
 	contracts := []*systemContract{environment, stakeManager}
@@ -76,6 +95,11 @@ func init() {
 		}
 		contract.abi = &ABI
 	}
+	ABI, err := abi.JSON(strings.NewReader(allowListAbi))
+	if err != nil {
+		panic(err)
+	}
+	allowList.abi = &ABI
 }
 
 // artifact
@@ -121,9 +145,9 @@ type environmentValue struct {
 	BlockPeriod *big.Int
 	// Number of blocks in epoch
 	EpochPeriod *big.Int
-	// Annual rate of staking reward
+	// Annual rate of staking reward(by basis points, 0-10000)
 	RewardRate *big.Int
-	// Validator commission rate
+	// Validator commission rate(by basis points, 0-10000)
 	CommissionRate *big.Int
 	// Amount of tokens required to become a validator
 	ValidatorThreshold *big.Int
@@ -146,6 +170,45 @@ func (p *environmentValue) GetFirstBlock(number uint64) uint64 {
 	return p.StartBlock.Uint64() + elapsedEpoch*p.EpochPeriod.Uint64()
 }
 
+// EpochRewards returns the rewards earned over an epoch of this environment by
+// the given stake, at the annual reward rate prorated over the epoch duration.
+func (p *environmentValue) EpochRewards(stake *big.Int) *big.Int {
+	rewards := new(big.Int).Mul(stake, p.RewardRate)
+	rewards.Div(rewards, maxBasisPoints)
+	rewards.Mul(rewards, new(big.Int).Mul(p.EpochPeriod, p.BlockPeriod))
+	return rewards.Div(rewards, secondsPerYear)
+}
+
+// RewardRatePercent returns the annual staking reward rate as a percentage.
+func (p *environmentValue) RewardRatePercent() float64 {
+	return basisPointsToPercent(p.RewardRate)
+}
+
+// CommissionRatePercent returns the validator commission rate as a percentage.
+func (p *environmentValue) CommissionRatePercent() float64 {
+	return basisPointsToPercent(p.CommissionRate)
+}
+
+// validate checks that the environment value is within the accepted ranges,
+// including the epoch period bounds of the config. It's only checked before a
+// value is proposed and by the self-test: refusing a value already stored in
+// the Environment contract would halt the chain.
+func (p *environmentValue) validate(config *params.OasysConfig) error {
+	if p.RewardRate.Sign() < 0 || p.RewardRate.Cmp(maxBasisPoints) > 0 {
+		return fmt.Errorf("invalid reward rate: have %v, max %v", p.RewardRate, maxBasisPoints)
+	}
+	if p.CommissionRate.Sign() < 0 || p.CommissionRate.Cmp(maxBasisPoints) > 0 {
+		return fmt.Errorf("invalid commission rate: have %v, max %v", p.CommissionRate, maxBasisPoints)
+	}
+	if config.MinEpochPeriod > 0 && p.EpochPeriod.Cmp(new(big.Int).SetUint64(config.MinEpochPeriod)) < 0 {
+		return fmt.Errorf("invalid epoch period: have %v, min %v", p.EpochPeriod, config.MinEpochPeriod)
+	}
+	if config.MaxEpochPeriod > 0 && p.EpochPeriod.Cmp(new(big.Int).SetUint64(config.MaxEpochPeriod)) > 0 {
+		return fmt.Errorf("invalid epoch period: have %v, max %v", p.EpochPeriod, config.MaxEpochPeriod)
+	}
+	return nil
+}
+
 func (p *environmentValue) Copy() *environmentValue {
 	return &environmentValue{
 		StartBlock:         new(big.Int).Set(p.StartBlock),
@@ -160,6 +223,30 @@ func (p *environmentValue) Copy() *environmentValue {
 	}
 }
 
+// encode packs the environment value as returned by Environment.nextValue.
+func (p *environmentValue) encode() ([]byte, error) {
+	return environment.abi.Methods["nextValue"].Outputs.Pack(*p)
+}
+
+// decode unpacks an environment value returned by Environment.nextValue.
+func (p *environmentValue) decode(data []byte) error {
+	// The value is a static tuple, one word per field
+	if len(data) != environmentValueWords*32 {
+		return fmt.Errorf("%w: have %d bytes, want %d", errEnvironmentABIMismatch, len(data), environmentValueWords*32)
+	}
+	var recv struct{ Result environmentValue }
+	if err := environment.abi.UnpackIntoInterface(&recv, "nextValue", data); err != nil {
+		return err
+	}
+	*p = recv.Result
+	return nil
+}
+
+func basisPointsToPercent(value *big.Int) float64 {
+	percent, _ := new(big.Float).Quo(new(big.Float).SetInt(value), big.NewFloat(100)).Float64()
+	return percent
+}
+
 // getNextValidatorsResult
 type getNextValidatorsResult struct {
 	Owners    []common.Address
@@ -190,6 +277,161 @@ func (p *getNextValidatorsResult) Exists(validator common.Address) bool {
 	return false
 }
 
+// withBootstrapValidators falls back to the bootstrap validators of the config
+// as long as the StakeManager reports no qualifying validators. Bootstrap
+// validators are given an equal nominal stake to keep the schedule deterministic.
+func withBootstrapValidators(config *params.OasysConfig, result *getNextValidatorsResult) *getNextValidatorsResult {
+	if len(result.Operators) > 0 || len(config.BootstrapValidators) == 0 {
+		return result
+	}
+	bootstrap := &getNextValidatorsResult{}
+	for _, validator := range config.BootstrapValidators {
+		bootstrap.Owners = append(bootstrap.Owners, validator)
+		bootstrap.Operators = append(bootstrap.Operators, validator)
+		bootstrap.Stakes = append(bootstrap.Stakes, new(big.Int).Set(ether))
+	}
+	return bootstrap
+}
+
+// maxValidators returns the maximum number of validators sealing the epoch
+// starting at the given block, none before the max validators block.
+func maxValidators(config *params.OasysConfig, number uint64) uint64 {
+	if !config.IsMaxValidators(new(big.Int).SetUint64(number)) {
+		return 0
+	}
+	return config.MaxValidators
+}
+
+// splitStandbys separates the validators staking the most, up to the maximum
+// number of validators at the given block, from the standbys ranked after them.
+// Ties in stake are broken by ascending operator address. The active validators
+// keep the order of the result, the standbys are ordered by rank.
+func splitStandbys(config *params.OasysConfig, number uint64, result *getNextValidatorsResult) (*getNextValidatorsResult, *getNextValidatorsResult) {
+	limit := maxValidators(config, number)
+	if limit == 0 || uint64(len(result.Operators)) <= limit {
+		return result, &getNextValidatorsResult{}
+	}
+	ranked := make([]int, len(result.Operators))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if cmp := result.Stakes[ranked[i]].Cmp(result.Stakes[ranked[j]]); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(result.Operators[ranked[i]][:], result.Operators[ranked[j]][:]) < 0
+	})
+	selected := make(map[int]bool, limit)
+	for _, i := range ranked[:limit] {
+		selected[i] = true
+	}
+	active, standbys := &getNextValidatorsResult{}, &getNextValidatorsResult{}
+	for i := range result.Operators {
+		if selected[i] {
+			active.Owners = append(active.Owners, result.Owners[i])
+			active.Operators = append(active.Operators, result.Operators[i])
+			active.Stakes = append(active.Stakes, result.Stakes[i])
+		}
+	}
+	for _, i := range ranked[limit:] {
+		standbys.Owners = append(standbys.Owners, result.Owners[i])
+		standbys.Operators = append(standbys.Operators, result.Operators[i])
+		standbys.Stakes = append(standbys.Stakes, result.Stakes[i])
+	}
+	return active, standbys
+}
+
+// selectValidators returns the validators sealing the epoch among the ones the
+// StakeManager reports, the bootstrap validators if none qualify, limited to the
+// maximum number of validators.
+func selectValidators(config *params.OasysConfig, number uint64, result *getNextValidatorsResult) *getNextValidatorsResult {
+	active, _ := splitStandbys(config, number, withBootstrapValidators(config, result))
+	return active
+}
+
+// withSelectionFilter drops the validators rejected by the selection filter of
+// the engine, if any. See SetSelectionFilter for its caveats.
+func (c *Oasys) withSelectionFilter(result *getNextValidatorsResult) *getNextValidatorsResult {
+	c.lock.RLock()
+	filter := c.selectionFilter
+	c.lock.RUnlock()
+
+	if filter == nil {
+		return result
+	}
+	filtered := &getNextValidatorsResult{}
+	for i, operator := range result.Operators {
+		if !filter(operator) {
+			log.Debug("Validator excluded by selection filter", "operator", operator)
+			continue
+		}
+		filtered.Owners = append(filtered.Owners, result.Owners[i])
+		filtered.Operators = append(filtered.Operators, operator)
+		filtered.Stakes = append(filtered.Stakes, result.Stakes[i])
+	}
+	return filtered
+}
+
+// validatorThreshold returns the stake the validators selected at the given
+// block must reach, the validator threshold of the environment from the
+// validator threshold block on, none before.
+func validatorThreshold(config *params.OasysConfig, env *environmentValue, number uint64) *big.Int {
+	if !config.IsValidatorThreshold(new(big.Int).SetUint64(number)) {
+		return nil
+	}
+	return env.ValidatorThreshold
+}
+
+// withUniqueOperators drops the operators the StakeManager reports more than
+// once from the unique operators block on, keeping their first stake, as they
+// would be scheduled twice otherwise.
+func withUniqueOperators(config *params.OasysConfig, number uint64, result *getNextValidatorsResult) *getNextValidatorsResult {
+	if !config.IsUniqueOperators(new(big.Int).SetUint64(number)) {
+		return result
+	}
+	seen := make(map[common.Address]bool, len(result.Operators))
+	unique := &getNextValidatorsResult{}
+	for i, operator := range result.Operators {
+		if seen[operator] {
+			log.Warn("Ignoring duplicate validator operator", "number", number, "operator", operator, "owner", result.Owners[i], "stake", result.Stakes[i])
+			continue
+		}
+		seen[operator] = true
+		unique.Owners = append(unique.Owners, result.Owners[i])
+		unique.Operators = append(unique.Operators, operator)
+		unique.Stakes = append(unique.Stakes, result.Stakes[i])
+	}
+	return unique
+}
+
+// withAllowlist drops the validators whose operator isn't in the allowlist of the
+// StakeManager at the given block hash, from the permissioned validators block
+// on.
+func withAllowlist(ethAPI blockchainAPI, config *params.OasysConfig, number uint64, hash common.Hash, result *getNextValidatorsResult) (*getNextValidatorsResult, error) {
+	if !config.IsPermissionedValidators(new(big.Int).SetUint64(number)) {
+		return result, nil
+	}
+	allowed, err := getAllowlist(ethAPI, hash)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[common.Address]bool, len(allowed))
+	for _, address := range allowed {
+		members[address] = true
+	}
+	filtered := &getNextValidatorsResult{}
+	for i, operator := range result.Operators {
+		if !members[operator] {
+			log.Debug("Validator excluded by allowlist", "operator", operator)
+			continue
+		}
+		filtered.Owners = append(filtered.Owners, result.Owners[i])
+		filtered.Operators = append(filtered.Operators, operator)
+		filtered.Stakes = append(filtered.Stakes, result.Stakes[i])
+	}
+	return filtered, nil
+}
+
 func getInitialEnvironment(config *params.OasysConfig) *environmentValue {
 	return &environmentValue{
 		StartBlock:         common.Big0,
@@ -204,6 +446,16 @@ func getInitialEnvironment(config *params.OasysConfig) *environmentValue {
 	}
 }
 
+// activeEnvironment returns the next environment value if it already took
+// effect at the given block, or the current one if it's dated in the future.
+func activeEnvironment(current, next *environmentValue, number uint64) *environmentValue {
+	if next.StartBlock.Uint64() > number {
+		log.Warn("Ignoring future environment value", "number", number, "start", next.StartBlock)
+		return current
+	}
+	return next
+}
+
 // callmsg
 type callmsg struct {
 	ethereum.CallMsg
@@ -218,6 +470,20 @@ func (m callmsg) Gas() uint64          { return m.CallMsg.Gas }
 func (m callmsg) Value() *big.Int      { return m.CallMsg.Value }
 func (m callmsg) Data() []byte         { return m.CallMsg.Data }
 
+// NonceProvider retrieves the nonce to be used for the next system transaction
+// sent by the given account.
+type NonceProvider interface {
+	GetNonce(state *state.StateDB, account common.Address) uint64
+}
+
+// stateNonceProvider is the default NonceProvider, reading the account nonce
+// straight from the state database.
+type stateNonceProvider struct{}
+
+func (stateNonceProvider) GetNonce(state *state.StateDB, account common.Address) uint64 {
+	return state.GetNonce(account)
+}
+
 func (c *Oasys) IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error) {
 	if tx.To() == nil {
 		return false, nil
@@ -247,7 +513,7 @@ func (c *Oasys) initializeSystemContracts(
 	if !environment.verifyCode(state) {
 		return errors.New("invalid contract code: Environment")
 	}
-	data, err := environment.abi.Pack("initialize", getInitialEnvironment(c.config))
+	data, err := environmentInitializeData(c.config)
 	if err != nil {
 		return err
 	}
@@ -261,7 +527,7 @@ func (c *Oasys) initializeSystemContracts(
 	if !stakeManager.verifyCode(state) {
 		return errors.New("invalid contract code: StakeManager")
 	}
-	data, err = stakeManager.abi.Pack("initialize", environment.address, common.HexToAddress(allowListAddress))
+	data, err = stakeManagerInitializeData()
 	if err != nil {
 		return err
 	}
@@ -276,7 +542,9 @@ func (c *Oasys) initializeSystemContracts(
 
 func (c *Oasys) slash(
 	validator common.Address,
+	snap *Snapshot,
 	schedule map[uint64]common.Address,
+	env *environmentValue,
 	state *state.StateDB,
 	header *types.Header,
 	cx core.ChainContext,
@@ -286,26 +554,160 @@ func (c *Oasys) slash(
 	usedGas *uint64,
 	mining bool,
 ) error {
-	blocks := int64(0)
+	data, err := slashData(validator, slashBlocks(snap, validator, schedule, env, header.Number.Uint64()))
+	if err != nil {
+		return err
+	}
+	msg := getMessage(header.Coinbase, stakeManager.address, data, common.Big0)
+	return c.applyTransaction(msg, state, header, cx, txs, receipts, systemTxs, usedGas, mining)
+}
+
+// slashBlocks returns the blocks the validator is slashed for at the given block:
+// its scheduled blocks in the epoch, escalated for the slashes tracked by the
+// parent snapshot. A validator can't be scheduled beyond the length of the epoch,
+// so more blocks are clamped to it as they stem from a broken schedule.
+func slashBlocks(snap *Snapshot, validator common.Address, schedule map[uint64]common.Address, env *environmentValue, number uint64) *big.Int {
+	blocks := uint64(0)
 	for _, address := range schedule {
 		if address == validator {
 			blocks++
 		}
 	}
-	data, err := stakeManager.abi.Pack("slash", validator, big.NewInt(blocks))
-	if err != nil {
-		return err
+	if period := env.EpochPeriod.Uint64(); blocks > period {
+		log.Warn("Clamping slashed blocks to the epoch length", "number", number, "validator", validator, "blocks", blocks, "epochPeriod", period)
+		blocks = period
 	}
-	msg := getMessage(header.Coinbase, stakeManager.address, data, common.Big0)
-	return c.applyTransaction(msg, state, header, cx, txs, receipts, systemTxs, usedGas, mining)
+	blocks *= snap.slashEscalation(validator, env.Epoch(number))
+	return new(big.Int).SetUint64(blocks)
+}
+
+type systemTxGas struct {
+	Init    hexutil.Uint64 `json:"init"`
+	Slash   hexutil.Uint64 `json:"slash"`
+	Rewards hexutil.Uint64 `json:"rewards"`
+	Total   hexutil.Uint64 `json:"total"`
+}
+
+// estimateSystemTxGas simulates the system transactions of the block on the
+// state of its parent, which is modified, returning the gas they use. Rewards
+// are credited to the StakeManager balance without a transaction, so they never
+// use any gas.
+func (c *Oasys) estimateSystemTxGas(chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header) (*systemTxGas, error) {
+	estimate := &systemTxGas{}
+	if !c.config.IsOasys(header.Number) {
+		return estimate, nil
+	}
+	number := header.Number.Uint64()
+	cx := chainContext{Chain: chain, oasys: c}
+
+	if c.isFirstOasysBlock(number) {
+		for _, contract := range []struct {
+			address common.Address
+			data    func() ([]byte, error)
+		}{
+			{environment.address, func() ([]byte, error) { return environmentInitializeData(c.config) }},
+			{stakeManager.address, stakeManagerInitializeData},
+		} {
+			data, err := contract.data()
+			if err != nil {
+				return nil, err
+			}
+			gas, err := applyMessage(getMessage(header.Coinbase, contract.address, data, common.Big0), state, header, c.chainConfig, cx)
+			if err != nil {
+				return nil, err
+			}
+			estimate.Init += hexutil.Uint64(gas)
+		}
+	}
+
+	if number >= c.config.Epoch && header.Difficulty.Cmp(diffInTurn) != 0 && !c.SlashingPaused() {
+		env, err := c.environment(chain, header, nil)
+		if err != nil {
+			return nil, err
+		}
+		schedule, err := c.scheduleAt(chain, header)
+		if err != nil {
+			return nil, err
+		}
+		if expected := schedule[number]; expected != header.Coinbase {
+			snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+			if err != nil {
+				return nil, err
+			}
+			data, err := slashData(expected, slashBlocks(snap, expected, schedule, env, number))
+			if err != nil {
+				return nil, err
+			}
+			gas, err := applyMessage(getMessage(header.Coinbase, stakeManager.address, data, common.Big0), state, header, c.chainConfig, cx)
+			if err != nil {
+				return nil, err
+			}
+			estimate.Slash = hexutil.Uint64(gas)
+		}
+	}
+
+	estimate.Total = estimate.Init + estimate.Slash + estimate.Rewards
+	return estimate, nil
+}
+
+// environmentInitializeData returns the call data of Environment.initialize.
+func environmentInitializeData(config *params.OasysConfig) ([]byte, error) {
+	return environment.abi.Pack("initialize", getInitialEnvironment(config))
+}
+
+// stakeManagerInitializeData returns the call data of StakeManager.initialize.
+func stakeManagerInitializeData() ([]byte, error) {
+	return stakeManager.abi.Pack("initialize", environment.address, common.HexToAddress(allowListAddress))
+}
+
+// slashData returns the call data of StakeManager.slash.
+func slashData(validator common.Address, blocks *big.Int) ([]byte, error) {
+	return stakeManager.abi.Pack("slash", validator, blocks)
+}
+
+// totalRewardsData returns the call data of StakeManager.getTotalRewards for the
+// rewards of the last epoch.
+func totalRewardsData(validators []common.Address) ([]byte, error) {
+	return stakeManager.abi.Pack("getTotalRewards", validators, common.Big1)
 }
 
 type blockchainAPI interface {
 	Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error)
 }
 
+// fallbackBlockchainAPI reads from a list of backends, trying each in order until
+// one succeeds.
+type fallbackBlockchainAPI []blockchainAPI
+
+func (backends fallbackBlockchainAPI) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	var err error
+	for i, backend := range backends {
+		var result hexutil.Bytes
+		if result, err = backend.Call(ctx, args, blockNrOrHash, overrides); err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Debug("System contract read failed", "backend", i, "err", err)
+	}
+	return nil, err
+}
+
 // view functions
-func getNextValidators(ethAPI blockchainAPI, hash common.Hash, epoch uint64) (*getNextValidatorsResult, error) {
+
+// getNextValidators retrieves the validators of the given epoch. Only validators
+// flagged as candidates by the StakeManager are selected, and among those only
+// the ones staking at least the threshold (if any). The candidate flag takes
+// precedence, so a validator who opted out is excluded whatever its stake.
+func getNextValidators(ethAPI blockchainAPI, hash common.Hash, epoch uint64, threshold *big.Int) (*getNextValidatorsResult, error) {
+	return getNextValidatorsPaged(ethAPI, hash, epoch, threshold, defaultValidatorPageSize)
+}
+
+// getNextValidatorsPaged is getNextValidators reading the given number of
+// validators per call. All pages are read at the given block hash, so that the
+// set isn't assembled from states moving between calls.
+func getNextValidatorsPaged(ethAPI blockchainAPI, hash common.Hash, epoch uint64, threshold *big.Int, pageSize uint64) (*getNextValidatorsResult, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -314,7 +716,7 @@ func getNextValidators(ethAPI blockchainAPI, hash common.Hash, epoch uint64) (*g
 		result  getNextValidatorsResult
 		bepoch  = big.NewInt(int64(epoch))
 		cursor  = big.NewInt(0)
-		howMany = big.NewInt(200)
+		howMany = new(big.Int).SetUint64(pageSize)
 	)
 	for {
 		data, err := stakeManager.abi.Pack(method, bepoch, cursor, howMany)
@@ -350,11 +752,15 @@ func getNextValidators(ethAPI blockchainAPI, hash common.Hash, epoch uint64) (*g
 
 		cursor = recv.NewCursor
 		for i := range recv.Owners {
-			if recv.Candidates[i] {
-				result.Owners = append(result.Owners, recv.Owners[i])
-				result.Operators = append(result.Operators, recv.Operators[i])
-				result.Stakes = append(result.Stakes, recv.Stakes[i])
+			if !recv.Candidates[i] {
+				continue
+			}
+			if threshold != nil && recv.Stakes[i].Cmp(threshold) < 0 {
+				continue
 			}
+			result.Owners = append(result.Owners, recv.Owners[i])
+			result.Operators = append(result.Operators, recv.Operators[i])
+			result.Stakes = append(result.Stakes, recv.Stakes[i])
 		}
 	}
 
@@ -408,13 +814,18 @@ func getValidatorOwners(ethAPI blockchainAPI, hash common.Hash) ([]common.Addres
 }
 
 func getRewards(ethAPI blockchainAPI, hash common.Hash) (*big.Int, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	validators, err := getValidatorOwners(ethAPI, hash)
 	if err != nil {
 		return nil, err
 	}
+	return getTotalRewards(ethAPI, hash, validators)
+}
+
+// getTotalRewards retrieves the rewards of the last epoch earned by the given
+// validator owners.
+func getTotalRewards(ethAPI blockchainAPI, hash common.Hash, validators []common.Address) (*big.Int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var (
 		chunks     [][]common.Address
@@ -436,7 +847,7 @@ func getRewards(ethAPI blockchainAPI, hash common.Hash) (*big.Int, error) {
 		result = new(big.Int)
 	)
 	for _, chunk := range chunks {
-		data, err := stakeManager.abi.Pack(method, chunk, common.Big1)
+		data, err := totalRewardsData(chunk)
 		if err != nil {
 			return nil, err
 		}
@@ -465,6 +876,251 @@ func getRewards(ethAPI blockchainAPI, hash common.Hash) (*big.Int, error) {
 	return result, nil
 }
 
+// verifyRewardRecipients ensures that none of the validator owners outside of
+// the given active set earned rewards in the last epoch. Their rewards are read
+// at once, and only looked up by owner to report the one paid.
+func verifyRewardRecipients(ethAPI blockchainAPI, hash common.Hash, active []common.Address) error {
+	owners, err := getValidatorOwners(ethAPI, hash)
+	if err != nil {
+		return err
+	}
+	members := make(map[common.Address]bool, len(active))
+	for _, owner := range active {
+		members[owner] = true
+	}
+	var outsiders []common.Address
+	for _, owner := range owners {
+		if !members[owner] {
+			outsiders = append(outsiders, owner)
+		}
+	}
+	if len(outsiders) == 0 {
+		return nil
+	}
+	total, err := getTotalRewards(ethAPI, hash, outsiders)
+	if err != nil || total.Sign() == 0 {
+		return err
+	}
+	for _, owner := range outsiders {
+		rewards, err := getTotalRewards(ethAPI, hash, []common.Address{owner})
+		if err != nil {
+			return err
+		}
+		if rewards.Sign() != 0 {
+			return fmt.Errorf("%w: %v earned %v", errRewardRecipient, owner, rewards)
+		}
+	}
+	return fmt.Errorf("%w: %v earned in total", errRewardRecipient, total)
+}
+
+// validatorInfoMethod returns the StakeManager method reporting the info of a
+// validator at a given epoch. The method is overloaded, so it is looked up by
+// its raw name and arguments rather than by the name the ABI parser assigned.
+func validatorInfoMethod() (*abi.Method, error) {
+	for _, method := range stakeManager.abi.Methods {
+		if method.RawName == "getValidatorInfo" && len(method.Inputs) == 2 {
+			method := method
+			return &method, nil
+		}
+	}
+	return nil, errors.New("StakeManager has no getValidatorInfo(address,uint256) method")
+}
+
+// getValidatorInfo returns the outputs of StakeManager.getValidatorInfo for the
+// validator owner at the given epoch, by output name.
+func getValidatorInfo(ethAPI blockchainAPI, hash common.Hash, validator common.Address, epoch uint64) (map[string]interface{}, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	method, err := validatorInfoMethod()
+	if err != nil {
+		return nil, err
+	}
+	data, err := stakeManager.abi.Pack(method.Name, validator, new(big.Int).SetUint64(epoch))
+	if err != nil {
+		return nil, err
+	}
+
+	hexData := (hexutil.Bytes)(data)
+	rbytes, err := ethAPI.Call(
+		ctx,
+		ethapi.TransactionArgs{
+			To:   &stakeManager.address,
+			Data: &hexData,
+		},
+		rpc.BlockNumberOrHashWithHash(hash, false),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]interface{})
+	if err := method.Outputs.UnpackIntoMap(info, rbytes); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func isValidatorJailed(ethAPI blockchainAPI, hash common.Hash, validator common.Address, epoch uint64) (bool, error) {
+	info, err := getValidatorInfo(ethAPI, hash, validator, epoch)
+	if err != nil {
+		return false, err
+	}
+	value, ok := info["jailed"]
+	if !ok {
+		return false, errors.New("getValidatorInfo has no jailed output")
+	}
+	jailed, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected jailed value: %v", value)
+	}
+	return jailed, nil
+}
+
+// getValidatorStake returns the total stake of the validator owner at the given
+// epoch, including the delegations.
+func getValidatorStake(ethAPI blockchainAPI, hash common.Hash, validator common.Address, epoch uint64) (*big.Int, error) {
+	info, err := getValidatorInfo(ethAPI, hash, validator, epoch)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := info["stakes"]
+	if !ok {
+		return nil, errors.New("getValidatorInfo has no stakes output")
+	}
+	stake, ok := value.(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected stakes value: %v", value)
+	}
+	return stake, nil
+}
+
+// getValidatorSelfStake returns the stake of the validator owner on its own
+// validator at the given epoch, paging through the stakers reported by
+// StakeManager.getValidatorStakes. It returns false if the StakeManager doesn't
+// report any staker of the validator.
+func getValidatorSelfStake(ethAPI blockchainAPI, hash common.Hash, validator common.Address, epoch uint64) (*big.Int, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	method, ok := stakeManager.abi.Methods["getValidatorStakes"]
+	if !ok || len(method.Inputs) != 4 || len(method.Outputs) != 3 {
+		return nil, false, nil
+	}
+	var (
+		self     = new(big.Int)
+		reported bool
+		bepoch   = new(big.Int).SetUint64(epoch)
+		cursor   = big.NewInt(0)
+		howMany  = big.NewInt(200)
+	)
+	for {
+		data, err := stakeManager.abi.Pack(method.Name, validator, bepoch, cursor, howMany)
+		if err != nil {
+			return nil, false, err
+		}
+
+		hexData := (hexutil.Bytes)(data)
+		rbytes, err := ethAPI.Call(
+			ctx,
+			ethapi.TransactionArgs{
+				To:   &stakeManager.address,
+				Data: &hexData,
+			},
+			rpc.BlockNumberOrHashWithHash(hash, false),
+			nil)
+		if err != nil {
+			return nil, false, err
+		}
+
+		values, err := method.Outputs.Unpack(rbytes)
+		if err != nil {
+			return nil, false, err
+		}
+		stakers, ok1 := values[0].([]common.Address)
+		stakes, ok2 := values[1].([]*big.Int)
+		newCursor, ok3 := values[2].(*big.Int)
+		if !ok1 || !ok2 || !ok3 || len(stakers) != len(stakes) {
+			return nil, false, fmt.Errorf("unexpected %s result", method.Sig)
+		}
+		if len(stakers) == 0 {
+			break
+		}
+		reported = true
+		for i, staker := range stakers {
+			if staker == validator {
+				self.Add(self, stakes[i])
+			}
+		}
+		cursor = newCursor
+	}
+	return self, reported, nil
+}
+
+// getJailReleaseEligible returns the validators whose jail period has elapsed
+// as of the given epoch, i.e. which were jailed in the previous epoch but are
+// not anymore.
+func getJailReleaseEligible(ethAPI blockchainAPI, hash common.Hash, epoch uint64) ([]common.Address, error) {
+	if epoch <= 1 {
+		return []common.Address{}, nil
+	}
+	validators, err := getValidatorOwners(ethAPI, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	eligible := make([]common.Address, 0)
+	for _, validator := range validators {
+		jailed, err := isValidatorJailed(ethAPI, hash, validator, epoch-1)
+		if err != nil {
+			return nil, err
+		}
+		if !jailed {
+			continue
+		}
+		if jailed, err = isValidatorJailed(ethAPI, hash, validator, epoch); err != nil {
+			return nil, err
+		}
+		if !jailed {
+			eligible = append(eligible, validator)
+		}
+	}
+	return eligible, nil
+}
+
+// getAllowlist retrieves the addresses permitted by the allowlist of the
+// StakeManager.
+func getAllowlist(ethAPI blockchainAPI, hash common.Hash) ([]common.Address, error) {
+	method := "getAllowlist"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data, err := allowList.abi.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+
+	hexData := (hexutil.Bytes)(data)
+	rbytes, err := ethAPI.Call(
+		ctx,
+		ethapi.TransactionArgs{
+			To:   &allowList.address,
+			Data: &hexData,
+		},
+		rpc.BlockNumberOrHashWithHash(hash, false),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []common.Address
+	if err := allowList.abi.UnpackIntoInterface(&allowed, method, rbytes); err != nil {
+		return nil, err
+	}
+	return allowed, nil
+}
+
 func getNextEnvironmentValue(ethAPI blockchainAPI, hash common.Hash) (*environmentValue, error) {
 	method := "nextValue"
 
@@ -489,12 +1145,11 @@ func getNextEnvironmentValue(ethAPI blockchainAPI, hash common.Hash) (*environme
 		return nil, err
 	}
 
-	var recv struct{ Result environmentValue }
-	if err := environment.abi.UnpackIntoInterface(&recv, method, rbytes); err != nil {
+	value := new(environmentValue)
+	if err := value.decode(rbytes); err != nil {
 		return nil, err
 	}
-
-	return &recv.Result, nil
+	return value, nil
 }
 
 func (c *Oasys) applyTransaction(
@@ -508,7 +1163,7 @@ func (c *Oasys) applyTransaction(
 	usedGas *uint64,
 	mining bool,
 ) (err error) {
-	nonce := state.GetNonce(msg.From())
+	nonce := c.nonces.GetNonce(state, msg.From())
 	expectedTx := types.NewTransaction(nonce, *msg.To(), msg.Value(), msg.Gas(), msg.GasPrice(), msg.Data())
 	expectedHash := c.txSigner.Hash(expectedTx)
 
@@ -522,6 +1177,9 @@ func (c *Oasys) applyTransaction(
 			return errors.New("supposed to get a actual transaction, but get none")
 		}
 		actualTx := (*systemTxs)[0]
+		if actualTx.GasPrice().Sign() != 0 {
+			return errSystemTxFee
+		}
 		if !bytes.Equal(c.txSigner.Hash(actualTx).Bytes(), expectedHash.Bytes()) {
 			return fmt.Errorf("expected tx hash %v, get %v, nonce %d, to %s, value %s, gas %d, gasPrice %s, data %s", expectedHash.String(), actualTx.Hash().String(),
 				expectedTx.Nonce(),
@@ -582,6 +1240,12 @@ func applyMessage(
 	chainConfig *params.ChainConfig,
 	chain core.ChainContext,
 ) (uint64, error) {
+	// System transactions are applied by a bare EVM call instead of a state
+	// transition, so no gas is bought or refunded and the coinbase earns no fee
+	// from them. Their gas only counts against the block gas limit.
+	if msg.GasPrice().Sign() != 0 {
+		return 0, errSystemTxFee
+	}
 	context := core.NewEVMBlockContext(header, chain, nil)
 	vmenv := vm.NewEVM(context, vm.TxContext{Origin: msg.From(), GasPrice: big.NewInt(0)}, state, chainConfig, vm.Config{})
 	ret, returnGas, err := vmenv.Call(
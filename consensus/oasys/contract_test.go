@@ -1,19 +1,25 @@
 package oasys
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
@@ -95,6 +101,207 @@ func TestInitializeSystemContracts(t *testing.T) {
 	}
 }
 
+func TestNonceProvider(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+	nonces := &testNonceProvider{offset: 10}
+	env.engine.SetNonceProvider(nonces)
+
+	header := &types.Header{
+		Number:     big.NewInt(50),
+		Coinbase:   accounts[0].Address,
+		Difficulty: diffInTurn,
+	}
+	cx := env.chain
+	txs := make([]*types.Transaction, 0)
+	receipts := make([]*types.Receipt, 0)
+	systemTxs := make([]*types.Transaction, 0)
+	usedGas := uint64(0)
+	mining := true
+
+	err = env.engine.initializeSystemContracts(env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
+	if err != nil {
+		t.Fatalf("failed to call initializeSystemContracts method: %v", err)
+	}
+	if nonces.calls != 2 {
+		t.Errorf("nonce provider calls, got %v, want 2", nonces.calls)
+	}
+	for i, want := range []uint64{10, 21} {
+		if txs[i].Nonce() != want {
+			t.Errorf("txs[%d].Nonce, got %v, want %v", i, txs[i].Nonce(), want)
+		}
+	}
+	if env.statedb.GetNonce(env.engine.signer) != 22 {
+		t.Errorf("account nonce value, got %v, want 22", env.statedb.GetNonce(env.engine.signer))
+	}
+}
+
+func TestSystemTxFees(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// Block 1 carries the system contract initialization transactions
+	block, err := env.generateBlock(*wallets[0], *accounts[0], true)
+	if err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+	if len(block.Transactions()) != 2 || block.GasUsed() == 0 {
+		t.Fatalf("system transactions, got %v using %v gas", len(block.Transactions()), block.GasUsed())
+	}
+
+	// No block reward is given, so the coinbase balance must stay as is
+	parent, err := env.chain.StateAt(env.chain.Genesis().Root())
+	if err != nil {
+		t.Fatalf("failed to get genesis state: %v", err)
+	}
+	statedb, err := env.chain.StateAt(block.Root())
+	if err != nil {
+		t.Fatalf("failed to get block state: %v", err)
+	}
+	before, after := parent.GetBalance(block.Coinbase()), statedb.GetBalance(block.Coinbase())
+	if after.Cmp(before) != 0 {
+		t.Errorf("coinbase balance, got %v, want %v", after, before)
+	}
+
+	// A system transaction paying for its gas is refused
+	data, _ := stakeManager.abi.Pack("slash", accounts[0].Address, common.Big1)
+	msg := getMessage(block.Coinbase(), stakeManager.address, data, common.Big0)
+	msg.CallMsg.GasPrice = common.Big1
+	if _, err := applyMessage(msg, statedb, block.Header(), env.chain.Config(), env.chain); err != errSystemTxFee {
+		t.Errorf("system transaction with gas price, got %v, want %v", err, errSystemTxFee)
+	}
+}
+
+func TestSystemTxGasPrice(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// The system transactions assembled by the signer pay no gas price
+	block, err := env.generateBlock(*wallets[0], *accounts[0], true)
+	if err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+	for i, tx := range block.Transactions() {
+		if tx.GasPrice().Sign() != 0 {
+			t.Errorf("system transaction %d: gas price, got %v, want 0", i, tx.GasPrice())
+		}
+	}
+
+	// A carried system transaction paying a gas price is refused on import
+	statedb, err := env.chain.StateAt(block.Root())
+	if err != nil {
+		t.Fatalf("failed to get block state: %v", err)
+	}
+	data, _ := stakeManager.abi.Pack("slash", accounts[0].Address, common.Big1)
+	msg := getMessage(block.Coinbase(), stakeManager.address, data, common.Big0)
+	carried := types.NewTransaction(statedb.GetNonce(msg.From()), *msg.To(), msg.Value(), msg.Gas(), common.Big1, msg.Data())
+
+	var (
+		txs       []*types.Transaction
+		receipts  []*types.Receipt
+		systemTxs = []*types.Transaction{carried}
+		usedGas   uint64
+	)
+	err = env.engine.applyTransaction(msg, statedb, block.Header(), env.chain, &txs, &receipts, &systemTxs, &usedGas, false)
+	if err != errSystemTxFee {
+		t.Errorf("system transaction with gas price, got %v, want %v", err, errSystemTxFee)
+	}
+}
+
+func TestRewardTxOffBoundary(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+	if _, err := env.generateBlock(*wallets[0], *accounts[0], true); err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+
+	// Block 2 is no epoch boundary, yet carries a reward transaction to the
+	// StakeManager paying out the total rewards
+	parent := env.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     big.NewInt(2),
+		GasLimit:   parent.GasLimit(),
+		Coinbase:   accounts[0].Address,
+		BaseFee:    misc.CalcBaseFee(env.chain.Config(), parent.Header()),
+	}
+	if err := env.engine.Prepare(env.chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	statedb, err := env.chain.StateAt(parent.Root())
+	if err != nil {
+		t.Fatalf("failed to get parent state: %v", err)
+	}
+	data, _ := totalRewardsData([]common.Address{accounts[0].Address})
+	msg := getMessage(header.Coinbase, stakeManager.address, data, common.Big0)
+	reward := types.NewTransaction(statedb.GetNonce(msg.From()), *msg.To(), msg.Value(), msg.Gas(), msg.GasPrice(), msg.Data())
+
+	var (
+		txs       []*types.Transaction
+		receipts  []*types.Receipt
+		systemTxs = []*types.Transaction{reward}
+		usedGas   uint64
+	)
+	if err := env.engine.Finalize(env.chain, header, statedb, &txs, nil, &receipts, &systemTxs, &usedGas); err != errUnexpectedSystemTx {
+		t.Errorf("reward transaction off an epoch boundary, got %v, want %v", err, errUnexpectedSystemTx)
+	}
+}
+
+func TestSystemTxGasEstimate(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// Block 1 carries the system contract initialization transactions only
+	block, err := env.generateBlock(*wallets[0], *accounts[0], true)
+	if err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+	api := &API{chain: env.chain, oasys: env.engine}
+	got, err := api.GetSystemTxGasEstimate(1)
+	if err != nil {
+		t.Fatalf("failed to call GetSystemTxGasEstimate: %v", err)
+	}
+	want := &systemTxGas{Init: hexutil.Uint64(block.GasUsed()), Total: hexutil.Uint64(block.GasUsed())}
+	if *got != *want {
+		t.Errorf("estimate, got %+v, want %+v", got, want)
+	}
+}
+
 func TestSlash(t *testing.T) {
 	wallets, accounts, err := makeWallets(1)
 	if err != nil {
@@ -120,7 +327,8 @@ func TestSlash(t *testing.T) {
 	usedGas := uint64(0)
 	mining := true
 
-	err = env.engine.slash(validator, schedule, env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
+	snap := newSnapshot(env.engine.config, nil, nil, 49, common.Hash{}, nil, getInitialEnvironment(env.engine.config))
+	err = env.engine.slash(validator, snap, schedule, getInitialEnvironment(env.engine.config), env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
 	if err != nil {
 		t.Fatalf("failed to call slash method: %v", err)
 	}
@@ -155,6 +363,200 @@ func TestSlash(t *testing.T) {
 	if env.statedb.GetNonce(env.engine.signer) != 1 {
 		t.Errorf("account nonce value, got %v, want 1", env.statedb.GetNonce(env.engine.signer))
 	}
+	api := &API{chain: env.chain, oasys: env.engine}
+	if record, err := api.GetLastSlash(common.HexToAddress("0x01")); record != nil || err != nil {
+		t.Errorf("never slashed, got %v (err %v), want nil", record, err)
+	}
+}
+
+func TestSlashEscalation(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+	env.engine.config.SlashEscalationMax = 3
+	env.engine.config.SlashEscalationBlock = big.NewInt(40)
+
+	validator := common.HexToAddress("0x01")
+	schedule := map[uint64]common.Address{1: validator, 2: validator}
+	initial := getInitialEnvironment(env.engine.config)
+	snap := newSnapshot(env.engine.config, nil, nil, 0, common.Hash{}, nil, initial)
+	cx := env.chain
+	txs := make([]*types.Transaction, 0)
+	receipts := make([]*types.Receipt, 0)
+	systemTxs := make([]*types.Transaction, 0)
+	usedGas := uint64(0)
+	mining := true
+
+	// Epochs of 100 blocks: repeated slashes escalate up to the maximum, until
+	// an epoch passes without any. The slash before the fork block isn't counted.
+	for i, tc := range []struct {
+		number uint64
+		blocks int64
+	}{
+		{30, 2},
+		{50, 2},
+		{60, 4},
+		{150, 6},
+		{160, 6},
+		{350, 2},
+	} {
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(tc.number),
+			Coinbase:   accounts[0].Address,
+			Difficulty: diffNoTurn,
+		}
+		snap.Number = tc.number - 1
+		err = env.engine.slash(validator, snap, schedule, initial, env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
+		if err != nil {
+			t.Fatalf("slash %d: failed to call slash method: %v", i, err)
+		}
+		args, err := stakeManager.abi.Methods["slash"].Inputs.Unpack(txs[len(txs)-1].Data()[4:])
+		if err != nil {
+			t.Fatalf("slash %d: failed to unpack slash data: %v", i, err)
+		}
+		if blocks := args[1].(*big.Int); blocks.Int64() != tc.blocks {
+			t.Errorf("slash %d at block %d: blocks, got %v, want %d", i, tc.number, blocks, tc.blocks)
+		}
+		snap.recordSlash(validator, accounts[0].Address, tc.number, initial.Epoch(tc.number))
+	}
+}
+
+func TestSlashBlocksBound(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// A broken schedule assigns the validator more blocks than the epoch of 100
+	validator := common.HexToAddress("0x01")
+	schedule := make(map[uint64]common.Address)
+	for number := uint64(0); number < 150; number++ {
+		schedule[number] = validator
+	}
+	header := &types.Header{
+		Number:     big.NewInt(50),
+		Coinbase:   accounts[0].Address,
+		Difficulty: diffNoTurn,
+	}
+	txs := make([]*types.Transaction, 0)
+	receipts := make([]*types.Receipt, 0)
+	systemTxs := make([]*types.Transaction, 0)
+	usedGas := uint64(0)
+
+	snap := newSnapshot(env.engine.config, nil, nil, 49, common.Hash{}, nil, getInitialEnvironment(env.engine.config))
+	err = env.engine.slash(validator, snap, schedule, getInitialEnvironment(env.engine.config), env.statedb, header, env.chain, &txs, &receipts, &systemTxs, &usedGas, true)
+	if err != nil {
+		t.Fatalf("failed to call slash method: %v", err)
+	}
+	args, err := stakeManager.abi.Methods["slash"].Inputs.Unpack(txs[len(txs)-1].Data()[4:])
+	if err != nil {
+		t.Fatalf("failed to unpack slash data: %v", err)
+	}
+	if blocks := args[1].(*big.Int); blocks.Int64() != 100 {
+		t.Errorf("blocks, got %v, want 100", blocks)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 40}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	backend.register(1, validators, stakes)
+	backend.allowlist = validators[:3]
+
+	chain := newTestChainReader(0)
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{chain: chain, oasys: engine}
+
+	// Before the permissioned validators block, the allowlist is ignored
+	engine.config.PermissionedValidatorsBlock = big.NewInt(40)
+	got, err := engine.getNextValidators(nil, common.Hash{}, env, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if !reflect.DeepEqual(got.Operators, validators) {
+		t.Errorf("permissionless validators, got %v, want %v", got.Operators, validators)
+	}
+
+	// The staked but unlisted validator is excluded
+	engine.config.PermissionedValidatorsBlock = common.Big0
+	if got, err = engine.getNextValidators(nil, common.Hash{}, env, 0, nil); err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if !reflect.DeepEqual(got.Operators, validators[:3]) {
+		t.Errorf("permissioned validators, got %v, want %v", got.Operators, validators[:3])
+	}
+
+	allowed, err := api.GetAllowlist()
+	if err != nil {
+		t.Fatalf("failed to call GetAllowlist: %v", err)
+	}
+	if !reflect.DeepEqual(allowed, validators[:3]) {
+		t.Errorf("allowlist, got %v, want %v", allowed, validators[:3])
+	}
+}
+
+func TestGasUsedMatchesReceipts(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	header := &types.Header{
+		Number:     big.NewInt(50),
+		Coinbase:   accounts[0].Address,
+		Difficulty: diffInTurn,
+	}
+	cx := env.chain
+	txs := make([]*types.Transaction, 0)
+	receipts := make([]*types.Receipt, 0)
+	systemTxs := make([]*types.Transaction, 0)
+	usedGas := uint64(0)
+	mining := true
+
+	err = env.engine.initializeSystemContracts(env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
+	if err != nil {
+		t.Fatalf("failed to call initializeSystemContracts method: %v", err)
+	}
+	snap := newSnapshot(env.engine.config, nil, nil, 49, common.Hash{}, nil, getInitialEnvironment(env.engine.config))
+	err = env.engine.slash(accounts[0].Address, snap, map[uint64]common.Address{}, getInitialEnvironment(env.engine.config), env.statedb, header, cx, &txs, &receipts, &systemTxs, &usedGas, mining)
+	if err != nil {
+		t.Fatalf("failed to call slash method: %v", err)
+	}
+	if len(receipts) != 3 {
+		t.Fatalf("len(receipts), got %v, want 3", len(receipts))
+	}
+
+	var sum uint64
+	for _, receipt := range receipts {
+		sum += receipt.GasUsed
+	}
+	if sum != usedGas {
+		t.Errorf("sum of receipt gas, got %v, want %v", sum, usedGas)
+	}
+	if err := verifyGasUsed(receipts, usedGas); err != nil {
+		t.Errorf("consistent gas used, got %v, want nil", err)
+	}
+	if err := verifyGasUsed(receipts, usedGas+1); !errors.Is(err, errGasUsedMismatch) {
+		t.Errorf("inconsistent gas used, got %v, want %v", err, errGasUsedMismatch)
+	}
 }
 
 func TestGetNextValidators(t *testing.T) {
@@ -227,7 +629,7 @@ func TestGetNextValidators(t *testing.T) {
 	}
 
 	ethapi := &testBlockchainAPI{rbytes: rbytes}
-	got, _ := getNextValidators(ethapi, common.Hash{}, 1)
+	got, _ := getNextValidators(ethapi, common.Hash{}, 1, nil)
 	if len(got.Owners) != len(wantOwners) {
 		t.Errorf("invalid owners length, got: %d, want: %d", len(got.Owners), len(wantOwners))
 	}
@@ -257,6 +659,300 @@ func TestGetNextValidators(t *testing.T) {
 	}
 }
 
+func TestGetNextValidatorsCandidates(t *testing.T) {
+	addressArrTy, _ := abi.NewType("address[]", "", nil)
+	uint256ArrTy, _ := abi.NewType("uint256[]", "", nil)
+	boolArrTy, _ := abi.NewType("bool[]", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	arguments := abi.Arguments{
+		{Type: addressArrTy},
+		{Type: addressArrTy},
+		{Type: uint256ArrTy},
+		{Type: boolArrTy},
+		{Type: uint256Ty},
+	}
+
+	threshold := new(big.Int).Mul(big.NewInt(10_000_000), ether)
+	below := new(big.Int).Sub(threshold, common.Big1)
+	var (
+		owners     = []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03"), common.HexToAddress("0x04")}
+		operators  = []common.Address{common.HexToAddress("0x05"), common.HexToAddress("0x06"), common.HexToAddress("0x07"), common.HexToAddress("0x08")}
+		stakes     = []*big.Int{threshold, below, threshold, below}
+		candidates = []bool{true, true, false, false}
+	)
+	rbyte, _ := arguments.Pack(owners, operators, stakes, candidates, big.NewInt(int64(len(owners))))
+	empty, _ := arguments.Pack([]common.Address{}, []common.Address{}, []*big.Int{}, []bool{}, big.NewInt(int64(len(owners))))
+
+	// Only the opted-in validator staking at least the threshold is selected
+	ethapi := &testBlockchainAPI{rbytes: [][]byte{rbyte, empty}}
+	got, err := getNextValidators(ethapi, common.Hash{}, 1, threshold)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if len(got.Operators) != 1 || got.Operators[0] != operators[0] {
+		t.Errorf("invalid operators, got %v, want %v", got.Operators, operators[:1])
+	}
+
+	// Without a threshold, the candidate flag alone decides
+	ethapi = &testBlockchainAPI{rbytes: [][]byte{rbyte, empty}}
+	got, err = getNextValidators(ethapi, common.Hash{}, 1, nil)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if len(got.Operators) != 2 || got.Operators[0] != operators[0] || got.Operators[1] != operators[1] {
+		t.Errorf("invalid operators, got %v, want %v", got.Operators, operators[:2])
+	}
+
+	// The threshold of the environment only applies from its activation block
+	config := &params.OasysConfig{Period: 0, Epoch: 10, ValidatorThresholdBlock: big.NewInt(20)}
+	env := getInitialEnvironment(config)
+	if got := validatorThreshold(config, env, 10); got != nil {
+		t.Errorf("threshold before the fork, got %v, want none", got)
+	}
+	if got := validatorThreshold(config, env, 20); got == nil || got.Cmp(env.ValidatorThreshold) != 0 {
+		t.Errorf("threshold, got %v, want %v", got, env.ValidatorThreshold)
+	}
+}
+
+func TestGetNextValidatorsDuplicates(t *testing.T) {
+	addressArrTy, _ := abi.NewType("address[]", "", nil)
+	uint256ArrTy, _ := abi.NewType("uint256[]", "", nil)
+	boolArrTy, _ := abi.NewType("bool[]", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	arguments := abi.Arguments{
+		{Type: addressArrTy},
+		{Type: addressArrTy},
+		{Type: uint256ArrTy},
+		{Type: boolArrTy},
+		{Type: uint256Ty},
+	}
+
+	var (
+		owners     = []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+		operators  = []common.Address{common.HexToAddress("0x04"), common.HexToAddress("0x05"), common.HexToAddress("0x04")}
+		stakes     = []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}
+		candidates = []bool{true, true, true}
+	)
+	rbyte, _ := arguments.Pack(owners, operators, stakes, candidates, big.NewInt(int64(len(owners))))
+	empty, _ := arguments.Pack([]common.Address{}, []common.Address{}, []*big.Int{}, []bool{}, big.NewInt(int64(len(owners))))
+
+	ethapi := &testBlockchainAPI{rbytes: [][]byte{rbyte, empty}}
+	result, err := getNextValidators(ethapi, common.Hash{}, 1, nil)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	config := &params.OasysConfig{Period: 0, Epoch: 10, UniqueOperatorsBlock: big.NewInt(20)}
+
+	// Duplicates are kept before the fork, not to change the set of past epochs
+	if got := withUniqueOperators(config, 10, result); !reflect.DeepEqual(got.Operators, operators) {
+		t.Errorf("operators before the fork, got %v, want %v", got.Operators, operators)
+	}
+
+	got := withUniqueOperators(config, 20, result)
+	if !reflect.DeepEqual(got.Operators, operators[:2]) {
+		t.Errorf("operators, got %v, want %v", got.Operators, operators[:2])
+	}
+	if !reflect.DeepEqual(got.Owners, owners[:2]) {
+		t.Errorf("owners, got %v, want %v", got.Owners, owners[:2])
+	}
+	if len(got.Stakes) != 2 || got.Stakes[0].Cmp(stakes[0]) != 0 {
+		t.Errorf("stakes, got %v, want first stake %v kept", got.Stakes, stakes[0])
+	}
+}
+
+func TestGetNextValidatorsPinned(t *testing.T) {
+	// The pinned block holds four validators, two per page, while the latest
+	// block has moved on to a single different one
+	pinned := common.HexToHash("0x01")
+	latest := newTestStakeManager(getInitialEnvironment(&params.OasysConfig{Period: 0, Epoch: 10}))
+	latest.register(1, []common.Address{common.HexToAddress("0x0e")}, stakes[:1])
+	at := newTestStakeManager(getInitialEnvironment(&params.OasysConfig{Period: 0, Epoch: 10}))
+	at.register(1, validators, stakes)
+
+	backend := &testPinnedBlockchainAPI{hash: pinned, pinned: at, latest: latest}
+	got, err := getNextValidatorsPaged(backend, pinned, 1, nil, 2)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if !reflect.DeepEqual(got.Operators, validators) {
+		t.Errorf("operators, got %v, want %v", got.Operators, validators)
+	}
+	if backend.calls != 3 || backend.unpinned != 0 {
+		t.Errorf("calls, got %d with %d not at the pinned block, want 3 all pinned", backend.calls, backend.unpinned)
+	}
+}
+
+func TestSelectionFilter(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 40}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	backend.register(1, validators, stakes)
+
+	engine := New(params.AllOasysProtocolChanges, config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	engine.SetSelectionFilter(func(operator common.Address) bool { return operator != validators[1] })
+
+	got, err := engine.getNextValidators(nil, common.Hash{}, env, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	want := []common.Address{validators[0], validators[2], validators[3]}
+	if !reflect.DeepEqual(got.Operators, want) {
+		t.Errorf("operators, got %v, want %v", got.Operators, want)
+	}
+	if len(got.Owners) != len(want) || len(got.Stakes) != len(want) {
+		t.Errorf("owners and stakes not filtered along, got %d owners and %d stakes", len(got.Owners), len(got.Stakes))
+	}
+}
+
+func TestStandbyPromotion(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 40, MaxValidators: 2, MaxValidatorsBlock: common.Big0}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	ranked := []*big.Int{
+		new(big.Int).Mul(big.NewInt(20_000_000), ether),
+		new(big.Int).Mul(big.NewInt(40_000_000), ether),
+		new(big.Int).Mul(big.NewInt(10_000_000), ether),
+		new(big.Int).Mul(big.NewInt(30_000_000), ether),
+	}
+	backend.register(1, validators, ranked)
+
+	engine := New(params.AllOasysProtocolChanges, config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+
+	check := func(wantActive, wantStandbys []common.Address) {
+		t.Helper()
+		active, err := engine.getNextValidators(nil, common.Hash{}, env, 0, nil)
+		if err != nil {
+			t.Fatalf("failed to call getNextValidators: %v", err)
+		}
+		if !reflect.DeepEqual(active.Operators, wantActive) {
+			t.Errorf("active validators, got %v, want %v", active.Operators, wantActive)
+		}
+		standbys, err := engine.getStandbyValidators(common.Hash{}, env, 0)
+		if err != nil {
+			t.Fatalf("failed to call getStandbyValidators: %v", err)
+		}
+		if !reflect.DeepEqual(standbys.Operators, wantStandbys) {
+			t.Errorf("standbys, got %v, want %v", standbys.Operators, wantStandbys)
+		}
+	}
+	// The two largest stakes seal, the others stand by in stake order
+	check([]common.Address{validators[1], validators[3]}, []common.Address{validators[0], validators[2]})
+
+	// Jailing an active validator promotes the top standby
+	backend.jailed[validators[1]] = true
+	check([]common.Address{validators[0], validators[3]}, []common.Address{validators[2]})
+
+	// Before the max validators block, every candidate seals
+	engine.config.MaxValidatorsBlock = big.NewInt(40)
+	check([]common.Address{validators[0], validators[2], validators[3]}, nil)
+}
+
+func BenchmarkGetNextValidators(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		operators := make([]common.Address, count)
+		stakes := make([]*big.Int, count)
+		for i := range operators {
+			operators[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+			stakes[i] = new(big.Int).Mul(big.NewInt(10_000_000), ether)
+		}
+		config := &params.OasysConfig{Period: 0, Epoch: 40}
+		env := getInitialEnvironment(config)
+		backend := newTestStakeManager(env)
+		backend.register(1, operators, stakes)
+		backend.delay = 100 * time.Microsecond
+
+		b.Run(fmt.Sprintf("validators=%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				result, err := getNextValidators(backend, common.Hash{}, 1, env.ValidatorThreshold)
+				if err != nil {
+					b.Fatalf("failed to call getNextValidators: %v", err)
+				}
+				if len(result.Operators) != count {
+					b.Fatalf("validators, got %d, want %d", len(result.Operators), count)
+				}
+			}
+		})
+
+		// Within an epoch, the validators come from the snapshots cached in memory
+		b.Run(fmt.Sprintf("validators=%d/cached", count), func(b *testing.B) {
+			engine := New(params.AllOasysProtocolChanges, config, rawdb.NewMemoryDatabase(), nil)
+			engine.ethAPI = backend
+			hash := common.HexToHash("0x01")
+			engine.recents.Add(hash, newSnapshot(engine.config, engine.signatures, backend, 1, hash, operators, env))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				snap, err := engine.snapshot(nil, 1, hash, nil)
+				if err != nil {
+					b.Fatalf("failed to get snapshot: %v", err)
+				}
+				if len(snap.validators()) != count {
+					b.Fatalf("validators, got %d, want %d", len(snap.validators()), count)
+				}
+			}
+		})
+	}
+}
+
+func TestGetJailReleaseEligible(t *testing.T) {
+	addressArrTy, _ := abi.NewType("address[]", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+
+	released := common.HexToAddress("0x01")
+	jailed := common.HexToAddress("0x02")
+	free := common.HexToAddress("0x03")
+
+	var rbytes [][]byte
+	// mocking to getValidatorOwners method
+	rbyte, _ := abi.Arguments{{Type: addressArrTy}, {Type: uint256Ty}}.Pack([]common.Address{released, jailed, free}, big.NewInt(3))
+	rbytes = append(rbytes, rbyte)
+	rbyte, _ = abi.Arguments{{Type: addressArrTy}, {Type: uint256Ty}}.Pack([]common.Address{}, big.NewInt(3))
+	rbytes = append(rbytes, rbyte)
+	// mocking to getValidatorInfo method, for the previous and the given epoch
+	for _, jailedAt := range []bool{true, false, true, true, false} {
+		rbytes = append(rbytes, packValidatorInfo(t, jailedAt))
+	}
+
+	ethapi := &testBlockchainAPI{rbytes: rbytes}
+	got, err := getJailReleaseEligible(ethapi, common.Hash{}, 5)
+	if err != nil {
+		t.Fatalf("failed to call getJailReleaseEligible: %v", err)
+	}
+	if len(got) != 1 || got[0] != released {
+		t.Errorf("eligible validators, got %v, want %v", got, []common.Address{released})
+	}
+	if ethapi.count != len(rbytes) {
+		t.Errorf("calls, got %v, want %v", ethapi.count, len(rbytes))
+	}
+}
+
+// packValidatorInfo encodes a getValidatorInfo result with the given jailed flag
+// and zero values for the other outputs.
+func packValidatorInfo(t *testing.T, jailed bool) []byte {
+	method, err := validatorInfoMethod()
+	if err != nil {
+		t.Fatalf("failed to find getValidatorInfo method: %v", err)
+	}
+	values := make([]interface{}, len(method.Outputs))
+	for i, output := range method.Outputs {
+		switch {
+		case output.Name == "jailed":
+			values[i] = jailed
+		case output.Type.GetType() == reflect.TypeOf(new(big.Int)):
+			values[i] = new(big.Int)
+		default:
+			values[i] = reflect.Zero(output.Type.GetType()).Interface()
+		}
+	}
+	rbyte, err := method.Outputs.Pack(values...)
+	if err != nil {
+		t.Fatalf("failed to pack getValidatorInfo result: %v", err)
+	}
+	return rbyte
+}
+
 func TestGetRewards(t *testing.T) {
 	want := big.NewInt(1902587519025875190)
 
@@ -280,6 +976,63 @@ func TestGetRewards(t *testing.T) {
 	}
 }
 
+func TestFallbackBlockchainAPI(t *testing.T) {
+	want := big.NewInt(1902587519025875190)
+
+	addressArrTy, _ := abi.NewType("address[]", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	owners, _ := abi.Arguments{{Type: addressArrTy}, {Type: uint256Ty}}.Pack([]common.Address{}, common.Big0)
+	rewards, _ := abi.Arguments{{Type: uint256Ty}}.Pack(want)
+
+	primary := &testFailingBlockchainAPI{err: errors.New("connection refused")}
+	engine := New(params.AllEthashProtocolChanges, &params.OasysConfig{Period: 0, Epoch: 100}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = primary
+	engine.SetFallbackBackends(&testBlockchainAPI{rbytes: [][]byte{owners, rewards}})
+
+	got, err := getRewards(engine.ethAPI, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to get rewards: %v", err)
+	}
+	if got.Cmp(want) != 0 {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary calls, got %d, want 2", primary.calls)
+	}
+
+	// All backends failing returns the error of the last one
+	last := errors.New("timeout")
+	engine.SetFallbackBackends(&testFailingBlockchainAPI{err: last})
+	if _, err := getRewards(engine.ethAPI, common.Hash{}); !errors.Is(err, last) {
+		t.Errorf("got %v, want %v", err, last)
+	}
+}
+
+func TestVerifyRewardRecipients(t *testing.T) {
+	var (
+		member    = common.HexToAddress("0x01")
+		nonMember = common.HexToAddress("0x02")
+		stake     = new(big.Int).Mul(big.NewInt(10_000_000), ether)
+	)
+	config := &params.OasysConfig{Period: 0, Epoch: 100}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(2, []common.Address{member}, []*big.Int{stake})
+	backend.register(3, []common.Address{member, nonMember}, []*big.Int{stake, stake})
+	backend.rewards[member] = ether
+
+	// Only the active validator of epoch 2 is paid
+	active := []common.Address{member}
+	if err := verifyRewardRecipients(backend, common.Hash{}, active); err != nil {
+		t.Errorf("rewards to active validator, got %v, want nil", err)
+	}
+
+	// A validator joining in epoch 3 is paid for epoch 2
+	backend.rewards[nonMember] = big.NewInt(1)
+	if err := verifyRewardRecipients(backend, common.Hash{}, active); !errors.Is(err, errRewardRecipient) {
+		t.Errorf("rewards to non-member, got %v, want %v", err, errRewardRecipient)
+	}
+}
+
 func TestGetNextEnvironmentValue(t *testing.T) {
 	want := &environmentValue{
 		StartBlock:         common.Big0,
@@ -358,6 +1111,163 @@ func TestGetNextEnvironmentValue(t *testing.T) {
 	}
 }
 
+func TestGetNextEnvironmentValueABIMismatch(t *testing.T) {
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	for _, words := range []int{0, 8, 10} {
+		arguments := abi.Arguments{}
+		values := []interface{}{}
+		for i := 0; i < words; i++ {
+			arguments = append(arguments, abi.Argument{Type: uint256Ty})
+			values = append(values, big.NewInt(int64(i+1)))
+		}
+		rbyte, _ := arguments.Pack(values...)
+
+		ethapi := &testBlockchainAPI{rbytes: [][]byte{rbyte}}
+		if _, err := getNextEnvironmentValue(ethapi, common.Hash{}); !errors.Is(err, errEnvironmentABIMismatch) {
+			t.Errorf("%d words, got %v, want %v", words, err, errEnvironmentABIMismatch)
+		}
+	}
+}
+
+func TestEnvironmentValueEncoding(t *testing.T) {
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	arguments := abi.Arguments{}
+	for i := 0; i < environmentValueWords; i++ {
+		arguments = append(arguments, abi.Argument{Type: uint256Ty})
+	}
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 256), common.Big1)
+
+	for name, value := range map[string]*environmentValue{
+		"sample": {
+			StartBlock:         common.Big0,
+			StartEpoch:         common.Big1,
+			BlockPeriod:        big.NewInt(3),
+			EpochPeriod:        big.NewInt(20),
+			RewardRate:         big.NewInt(10),
+			CommissionRate:     big.NewInt(15),
+			ValidatorThreshold: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(10_000_000)),
+			JailThreshold:      big.NewInt(500),
+			JailPeriod:         big.NewInt(2),
+		},
+		"zeroed": {
+			StartBlock:         new(big.Int),
+			StartEpoch:         new(big.Int),
+			BlockPeriod:        new(big.Int),
+			EpochPeriod:        new(big.Int),
+			RewardRate:         new(big.Int),
+			CommissionRate:     new(big.Int),
+			ValidatorThreshold: new(big.Int),
+			JailThreshold:      new(big.Int),
+			JailPeriod:         new(big.Int),
+		},
+		"edges": {
+			StartBlock:         big.NewInt(1_000_000),
+			StartEpoch:         big.NewInt(50),
+			BlockPeriod:        big.NewInt(15),
+			EpochPeriod:        big.NewInt(5760),
+			RewardRate:         new(big.Int),
+			CommissionRate:     new(big.Int),
+			ValidatorThreshold: maxUint256,
+			JailThreshold:      maxUint256,
+			JailPeriod:         maxUint256,
+		},
+	} {
+		// The encoding is the one of the Environment contract, field by field
+		data, err := value.encode()
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %v", name, err)
+		}
+		want, _ := arguments.Pack(value.StartBlock, value.StartEpoch, value.BlockPeriod, value.EpochPeriod, value.RewardRate,
+			value.CommissionRate, value.ValidatorThreshold, value.JailThreshold, value.JailPeriod)
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: encoding, got %x, want %x", name, data, want)
+		}
+
+		got := new(environmentValue)
+		if err := got.decode(data); err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		have, expected := reflect.ValueOf(*got), reflect.ValueOf(*value)
+		for i := 0; i < have.NumField(); i++ {
+			field := have.Type().Field(i).Name
+			if have.Field(i).Interface().(*big.Int).Cmp(expected.Field(i).Interface().(*big.Int)) != 0 {
+				t.Errorf("%s: %s, got %v, want %v", name, field, have.Field(i).Interface(), expected.Field(i).Interface())
+			}
+		}
+	}
+
+	if err := new(environmentValue).decode(make([]byte, 8*32)); !errors.Is(err, errEnvironmentABIMismatch) {
+		t.Errorf("truncated value, got %v, want %v", err, errEnvironmentABIMismatch)
+	}
+}
+
+func TestEnvironmentValueEpochPeriod(t *testing.T) {
+	config := &params.OasysConfig{Period: 15, Epoch: 5760, MinEpochPeriod: 100, MaxEpochPeriod: 100_000}
+
+	for _, tc := range []struct {
+		epochPeriod int64
+		wantErr     bool
+	}{
+		{99, true},
+		{100, false},
+		{5760, false},
+		{100_000, false},
+		{100_001, true},
+	} {
+		env := getInitialEnvironment(config)
+		env.EpochPeriod = big.NewInt(tc.epochPeriod)
+		if err := env.validate(config); (err != nil) != tc.wantErr {
+			t.Errorf("epoch period %v: got %v, want error %v", tc.epochPeriod, err, tc.wantErr)
+		}
+	}
+
+	// Without bounds, any epoch period is accepted
+	env := getInitialEnvironment(config)
+	env.EpochPeriod = big.NewInt(1_000_000_000)
+	if err := env.validate(&params.OasysConfig{}); err != nil {
+		t.Errorf("unbounded epoch period, got %v", err)
+	}
+}
+
+func TestEnvironmentValueRates(t *testing.T) {
+	testCases := []struct {
+		rewardRate     *big.Int
+		commissionRate *big.Int
+		wantReward     float64
+		wantCommission float64
+		wantErr        bool
+	}{
+		{big.NewInt(0), big.NewInt(0), 0, 0, false},
+		{big.NewInt(10), big.NewInt(1_500), 0.1, 15, false},
+		{big.NewInt(10_000), big.NewInt(10_000), 100, 100, false},
+		{big.NewInt(10_001), big.NewInt(10), 0, 0, true},
+		{big.NewInt(10), big.NewInt(10_001), 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		env := getInitialEnvironment(&params.OasysConfig{Period: 15, Epoch: 5760})
+		env.RewardRate = tc.rewardRate
+		env.CommissionRate = tc.commissionRate
+
+		err := env.validate(&params.OasysConfig{})
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("rates %v/%v: expected error", tc.rewardRate, tc.commissionRate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("rates %v/%v: unexpected error: %v", tc.rewardRate, tc.commissionRate, err)
+		}
+		if got := env.RewardRatePercent(); got != tc.wantReward {
+			t.Errorf("RewardRatePercent, got %v, want %v", got, tc.wantReward)
+		}
+		if got := env.CommissionRatePercent(); got != tc.wantCommission {
+			t.Errorf("CommissionRatePercent, got %v, want %v", got, tc.wantCommission)
+		}
+	}
+}
+
 type testBlockchainAPI struct {
 	rbytes [][]byte
 	count  int
@@ -368,10 +1278,284 @@ func (p *testBlockchainAPI) Call(ctx context.Context, args ethapi.TransactionArg
 	return p.rbytes[p.count], nil
 }
 
+// testPinnedBlockchainAPI serves the calls at the given block hash from one
+// backend and any other from another, as if the chain moved on.
+type testPinnedBlockchainAPI struct {
+	hash           common.Hash
+	pinned, latest blockchainAPI
+	calls          int
+	unpinned       int
+}
+
+func (p *testPinnedBlockchainAPI) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	p.calls++
+	if hash, ok := blockNrOrHash.Hash(); ok && hash == p.hash {
+		return p.pinned.Call(ctx, args, blockNrOrHash, overrides)
+	}
+	p.unpinned++
+	return p.latest.Call(ctx, args, blockNrOrHash, overrides)
+}
+
+type testFailingBlockchainAPI struct {
+	err   error
+	calls int
+}
+
+func (p *testFailingBlockchainAPI) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	p.calls++
+	return nil, p.err
+}
+
+type testNonceProvider struct {
+	offset uint64
+	calls  int
+}
+
+func (p *testNonceProvider) GetNonce(state *state.StateDB, account common.Address) uint64 {
+	p.calls++
+	return state.GetNonce(account) + p.offset
+}
+
 type testEnv struct {
-	engine  *Oasys
-	chain   *core.BlockChain
-	statedb *state.StateDB
+	engine       *Oasys
+	chain        *core.BlockChain
+	statedb      *state.StateDB
+	stakeManager *testStakeManager
+	clock        uint64 // Unix time of the engine's fake clock, accessed atomically
+}
+
+// testStakeManager is a system contract backend serving the StakeManager and
+// Environment views from the validators registered per epoch.
+type testStakeManager struct {
+	env        *environmentValue
+	operators  map[uint64][]common.Address // Validators, keyed by the first epoch they are active in
+	stakes     map[uint64][]*big.Int
+	rewards    map[common.Address]*big.Int                 // Rewards of the last epoch, by owner
+	rewardsAt  map[common.Hash]map[common.Address]*big.Int // Rewards reported at the given blocks instead
+	jailed     map[common.Address]bool                     // Operators reported as non-candidates
+	selfStakes map[common.Address]*big.Int                 // Stakes of the owners on their own validator, the rest delegated
+	lastEpochs []uint64
+	allowlist  []common.Address // Addresses permitted by the allowlist contract
+	delay      time.Duration    // Latency of every call
+	pageSizes  []int64          // Number of validators requested by each getValidators call
+}
+
+func newTestStakeManager(env *environmentValue) *testStakeManager {
+	return &testStakeManager{
+		env:        env,
+		operators:  make(map[uint64][]common.Address),
+		stakes:     make(map[uint64][]*big.Int),
+		rewards:    make(map[common.Address]*big.Int),
+		jailed:     make(map[common.Address]bool),
+		selfStakes: make(map[common.Address]*big.Int),
+	}
+}
+
+// register sets the validators active from the given epoch onwards.
+func (p *testStakeManager) register(epoch uint64, operators []common.Address, stakes []*big.Int) {
+	p.operators[epoch] = operators
+	p.stakes[epoch] = stakes
+	p.lastEpochs = append(p.lastEpochs, epoch)
+}
+
+// validators returns the validators active in the given epoch.
+func (p *testStakeManager) validators(epoch uint64) ([]common.Address, []*big.Int) {
+	var (
+		active uint64
+		found  bool
+	)
+	for _, registered := range p.lastEpochs {
+		if registered <= epoch && (!found || registered > active) {
+			active, found = registered, true
+		}
+	}
+	if !found {
+		return []common.Address{}, []*big.Int{}
+	}
+	return p.operators[active], p.stakes[active]
+}
+
+func (p *testStakeManager) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	data := *args.Data
+	method, err := stakeManager.abi.MethodById(data)
+	if *args.To == environment.address {
+		method, err = environment.abi.MethodById(data)
+	}
+	if *args.To == allowList.address {
+		method, err = allowList.abi.MethodById(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(p.delay)
+
+	switch method.RawName {
+	case "getValidators":
+		operators, stakes := p.validators(inputs[0].(*big.Int).Uint64())
+		cursor, howMany := int(inputs[1].(*big.Int).Int64()), int(inputs[2].(*big.Int).Int64())
+		p.pageSizes = append(p.pageSizes, int64(howMany))
+		if cursor > len(operators) {
+			cursor = len(operators)
+		}
+		end := cursor + howMany
+		if end > len(operators) {
+			end = len(operators)
+		}
+		operators, stakes = operators[cursor:end], stakes[cursor:end]
+		candidates := make([]bool, len(operators))
+		for i, operator := range operators {
+			candidates[i] = !p.jailed[operator]
+		}
+		return method.Outputs.Pack(operators, operators, stakes, candidates, big.NewInt(int64(end)))
+
+	case "getValidatorInfo":
+		operators, stakes := p.validators(inputs[1].(*big.Int).Uint64())
+		values := make([]interface{}, len(method.Outputs))
+		for i, output := range method.Outputs {
+			switch {
+			case output.Name == "stakes":
+				values[i] = new(big.Int)
+				for j, operator := range operators {
+					if operator == inputs[0].(common.Address) {
+						values[i] = stakes[j]
+					}
+				}
+			case output.Name == "jailed":
+				values[i] = p.jailed[inputs[0].(common.Address)]
+			case output.Type.GetType() == reflect.TypeOf(new(big.Int)):
+				values[i] = new(big.Int)
+			default:
+				values[i] = reflect.Zero(output.Type.GetType()).Interface()
+			}
+		}
+		return method.Outputs.Pack(values...)
+
+	case "getValidatorStakes":
+		owner := inputs[0].(common.Address)
+		self, ok := p.selfStakes[owner]
+		if !ok || inputs[2].(*big.Int).Sign() > 0 {
+			return method.Outputs.Pack([]common.Address{}, []*big.Int{}, big.NewInt(2))
+		}
+		operators, stakes := p.validators(inputs[1].(*big.Int).Uint64())
+		delegated := new(big.Int)
+		for j, operator := range operators {
+			if operator == owner {
+				delegated.Sub(stakes[j], self)
+			}
+		}
+		delegator := common.HexToAddress("0xde1e6a7e")
+		return method.Outputs.Pack([]common.Address{owner, delegator}, []*big.Int{self, delegated}, big.NewInt(2))
+
+	case "getValidatorOwners":
+		owners := []common.Address{}
+		if inputs[0].(*big.Int).Sign() == 0 {
+			seen := make(map[common.Address]bool)
+			for _, epoch := range p.lastEpochs {
+				for _, operator := range p.operators[epoch] {
+					if !seen[operator] {
+						seen[operator] = true
+						owners = append(owners, operator)
+					}
+				}
+			}
+		}
+		return method.Outputs.Pack(owners, big.NewInt(int64(len(owners))))
+
+	case "getTotalRewards":
+		rewardsOf := p.rewards
+		if hash, ok := blockNrOrHash.Hash(); ok && p.rewardsAt[hash] != nil {
+			rewardsOf = p.rewardsAt[hash]
+		}
+		total := new(big.Int)
+		for _, owner := range inputs[0].([]common.Address) {
+			if rewards, ok := rewardsOf[owner]; ok {
+				total.Add(total, rewards)
+			}
+		}
+		return method.Outputs.Pack(total)
+
+	case "getAllowlist":
+		return method.Outputs.Pack(p.allowlist)
+
+	case "nextValue":
+		uint256Ty, _ := abi.NewType("uint256", "", nil)
+		arguments := abi.Arguments{}
+		for i := 0; i < 9; i++ {
+			arguments = append(arguments, abi.Argument{Type: uint256Ty})
+		}
+		return arguments.Pack(p.env.StartBlock, p.env.StartEpoch, p.env.BlockPeriod, p.env.EpochPeriod, p.env.RewardRate,
+			p.env.CommissionRate, p.env.ValidatorThreshold, p.env.JailThreshold, p.env.JailPeriod)
+	}
+	return nil, fmt.Errorf("unexpected call: %s", method.Sig)
+}
+
+// generateBlock seals a block on top of the current head of the test chain by
+// the given validator, going through the same Prepare, FinalizeAndAssemble and
+// import path as a miner would. If inturn is set, the validator must be the
+// scheduled one, otherwise it must not.
+func (env *testEnv) generateBlock(wallet accounts.Wallet, account accounts.Account, inturn bool) (*types.Block, error) {
+	env.engine.Authorize(account.Address, wallet.SignData, wallet.SignTx)
+
+	parent := env.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Coinbase:   account.Address,
+		BaseFee:    misc.CalcBaseFee(env.chain.Config(), parent.Header()),
+	}
+	if err := env.engine.Prepare(env.chain, header); err != nil {
+		return nil, err
+	}
+	if (header.Difficulty.Cmp(diffInTurn) == 0) != inturn {
+		return nil, fmt.Errorf("validator %v in-turn mismatch at block %v", account.Address, header.Number)
+	}
+	statedb, err := env.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	block, _, err := env.engine.FinalizeAndAssemble(env.chain, header, statedb, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	header = block.Header()
+	sig, err := wallet.SignData(account, accounts.MimetypeOasys, sealRLP(header, nil))
+	if err != nil {
+		return nil, err
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+	block = block.WithSeal(header)
+
+	// Out-of-turn blocks are backed off, move the clock to their slot like Seal
+	// waits for it
+	atomic.StoreUint64(&env.clock, header.Time)
+	if _, err := env.chain.InsertChain(types.Blocks{block}); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// generateBlocks seals blocks up to the given number, each by whichever of the
+// given validators is in-turn.
+func (env *testEnv) generateBlocks(number uint64, wallets []*accounts.Wallet, accounts []*accounts.Account) error {
+	for env.chain.CurrentBlock().NumberU64() < number {
+		sealed := false
+		for i := range wallets {
+			if _, err := env.generateBlock(*wallets[i], *accounts[i], true); err == nil {
+				sealed = true
+				break
+			}
+		}
+		if !sealed {
+			return fmt.Errorf("no in-turn validator for block %v", env.chain.CurrentBlock().NumberU64()+1)
+		}
+	}
+	return nil
 }
 
 func makeKeyStore() (*keystore.KeyStore, func(), error) {
@@ -402,7 +1586,12 @@ func makeWallets(count int) ([]*accounts.Wallet, []*accounts.Account, error) {
 			return nil, nil, err
 		}
 		keystore.Unlock(account, "")
-		wallets = append(wallets, &keystore.Wallets()[0])
+		for _, wallet := range keystore.Wallets() {
+			if wallet.Contains(account) {
+				wallets = append(wallets, &wallet)
+				break
+			}
+		}
 		accounts = append(accounts, &account)
 	}
 	return wallets, accounts, err
@@ -499,8 +1688,12 @@ func makeEnv(wallet accounts.Wallet, account accounts.Account) (*testEnv, error)
 	copy(genspec.ExtraData[extraVanity:], account.Address[:])
 	genspec.MustCommit(db)
 
-	// Generate consensus engine
+	// Generate consensus engine, serving the system contract views from a fake
+	// and reading the time from a fake clock set to the genesis
+	env := &testEnv{stakeManager: newTestStakeManager(getInitialEnvironment(chainConfig.Oasys)), clock: genspec.Timestamp}
 	engine := New(chainConfig, chainConfig.Oasys, db, nil)
+	engine.ethAPI = env.stakeManager
+	engine.now = func() time.Time { return time.Unix(int64(atomic.LoadUint64(&env.clock)), 0) }
 	engine.Authorize(account.Address, wallet.SignData, wallet.SignTx)
 
 	// Generate a batch of blocks, each properly signed
@@ -516,5 +1709,6 @@ func makeEnv(wallet accounts.Wallet, account accounts.Account) (*testEnv, error)
 	environment.artifact.DeployedBytecode = fmt.Sprintf("0x%s", hex.EncodeToString(genspec.Alloc[_environmentAddress].Code))
 	stakeManager.artifact.DeployedBytecode = fmt.Sprintf("0x%s", hex.EncodeToString(genspec.Alloc[_stakeManagerAddress].Code))
 
-	return &testEnv{engine, chain, statedb}, nil
+	env.engine, env.chain, env.statedb = engine, chain, statedb
+	return env, nil
 }
@@ -0,0 +1,124 @@
+package oasys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// consensusStateVersion is the version of the consensus state export format.
+const consensusStateVersion = 1
+
+// consensusStateFile is the envelope of an exported consensus state, carrying
+// the format version and a checksum of the encoded state.
+type consensusStateFile struct {
+	Version  uint64          `json:"version"`
+	Checksum common.Hash     `json:"checksum"`
+	State    json.RawMessage `json:"state"`
+}
+
+// consensusState is the consensus state at a given block, allowing a new node
+// to start from it without rebuilding the snapshot.
+type consensusState struct {
+	Snapshot    *Snapshot         `json:"snapshot"`
+	Environment *environmentValue `json:"environment"`
+}
+
+// ExportConsensusState writes the snapshot and environment value at the current
+// block of the chain for ImportConsensusState. The validator schedule isn't
+// written, being derived from the snapshot.
+func (c *Oasys) ExportConsensusState(chain consensus.ChainHeaderReader, w io.Writer) error {
+	header := chain.CurrentHeader()
+	if header == nil {
+		return errUnknownBlock
+	}
+	snap, err := c.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return err
+	}
+	state, err := json.Marshal(&consensusState{
+		Snapshot:    snap,
+		Environment: snap.Environment,
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(&consensusStateFile{
+		Version:  consensusStateVersion,
+		Checksum: crypto.Keccak256Hash(state),
+		State:    state,
+	})
+}
+
+// ImportConsensusState loads a consensus state written by ExportConsensusState,
+// so that the snapshot at its block is not rebuilt from the chain. The block must
+// be known to the chain, or be the trusted checkpoint of the config along with
+// its validators.
+func (c *Oasys) ImportConsensusState(chain consensus.ChainHeaderReader, r io.Reader) error {
+	var file consensusStateFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return err
+	}
+	if file.Version != consensusStateVersion {
+		return fmt.Errorf("unsupported consensus state version: have %d, want %d", file.Version, consensusStateVersion)
+	}
+	if checksum := crypto.Keccak256Hash(file.State); checksum != file.Checksum {
+		return fmt.Errorf("consensus state checksum mismatch: have %x, want %x", checksum, file.Checksum)
+	}
+	var state consensusState
+	if err := json.Unmarshal(file.State, &state); err != nil {
+		return err
+	}
+	snap := state.Snapshot
+	if snap == nil {
+		return errors.New("missing snapshot in consensus state")
+	}
+	if err := snap.validate(snap.Hash); err != nil {
+		return err
+	}
+	if state.Environment == nil || !sameEnvironment(state.Environment, snap.Environment) {
+		return errors.New("environment mismatch in consensus state")
+	}
+	if isTrustedCheckpoint(c.config, snap.Number, snap.Hash) {
+		trusted := &getNextValidatorsResult{Operators: c.config.TrustedCheckpoint.Validators}
+		if !sameOperators(trusted, &getNextValidatorsResult{Operators: snap.validators()}) {
+			return fmt.Errorf("validators mismatch with trusted checkpoint %d", snap.Number)
+		}
+	} else if chain.GetHeader(snap.Hash, snap.Number) == nil {
+		return fmt.Errorf("unknown consensus state block %d (%x)", snap.Number, snap.Hash)
+	}
+	snap.config = c.config
+	snap.sigcache = c.signatures
+	snap.ethAPI = c.ethAPI
+	if snap.Recents == nil {
+		snap.Recents = make(map[uint64]common.Address)
+	}
+
+	if err := snap.store(c.db); err != nil {
+		return err
+	}
+	c.recents.Add(snap.Hash, snap)
+	log.Info("Imported consensus state", "number", snap.Number, "hash", snap.Hash, "validators", len(snap.Validators))
+	return nil
+}
+
+// sameEnvironment reports whether the two environment values are equal.
+func sameEnvironment(a, b *environmentValue) bool {
+	as := []*big.Int{a.StartBlock, a.StartEpoch, a.BlockPeriod, a.EpochPeriod, a.RewardRate,
+		a.CommissionRate, a.ValidatorThreshold, a.JailThreshold, a.JailPeriod}
+	bs := []*big.Int{b.StartBlock, b.StartEpoch, b.BlockPeriod, b.EpochPeriod, b.RewardRate,
+		b.CommissionRate, b.ValidatorThreshold, b.JailThreshold, b.JailPeriod}
+	for i := range as {
+		if as[i] == nil || bs[i] == nil || as[i].Cmp(bs[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
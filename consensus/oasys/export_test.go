@@ -0,0 +1,106 @@
+package oasys
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestConsensusStateRoundTrip(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	exporter := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	exporter.ethAPI = &testEpochBlockchainAPI{validator: validator}
+
+	var exported bytes.Buffer
+	if err := exporter.ExportConsensusState(chain, &exported); err != nil {
+		t.Fatalf("failed to export consensus state: %v", err)
+	}
+
+	// A fresh engine without any system contract access serves the imported snapshot
+	importer := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	if err := importer.ImportConsensusState(chain, bytes.NewReader(exported.Bytes())); err != nil {
+		t.Fatalf("failed to import consensus state: %v", err)
+	}
+
+	head := headers[len(headers)-1]
+	want, err := exporter.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to get exported snapshot: %v", err)
+	}
+	got, err := importer.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to get imported snapshot: %v", err)
+	}
+	wantBlob, _ := json.Marshal(want)
+	gotBlob, _ := json.Marshal(got)
+	if !bytes.Equal(gotBlob, wantBlob) {
+		t.Errorf("snapshot mismatch\ngot:  %s\nwant: %s", gotBlob, wantBlob)
+	}
+}
+
+func TestConsensusStateImportInvalid(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+
+	var exported bytes.Buffer
+	if err := engine.ExportConsensusState(chain, &exported); err != nil {
+		t.Fatalf("failed to export consensus state: %v", err)
+	}
+	var file consensusStateFile
+	if err := json.Unmarshal(exported.Bytes(), &file); err != nil {
+		t.Fatalf("failed to decode consensus state: %v", err)
+	}
+
+	testCases := map[string]func(file *consensusStateFile){
+		"version":  func(file *consensusStateFile) { file.Version++ },
+		"checksum": func(file *consensusStateFile) { file.Checksum[0] ^= 0xff },
+		"state": func(file *consensusStateFile) {
+			file.State = bytes.Replace(file.State, []byte(`"number":5`), []byte(`"number":6`), 1)
+		},
+	}
+	for name, tamper := range testCases {
+		tampered := file
+		tampered.State = append([]byte{}, file.State...)
+		tamper(&tampered)
+		blob, _ := json.Marshal(&tampered)
+
+		fresh := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+		if err := fresh.ImportConsensusState(chain, bytes.NewReader(blob)); err == nil {
+			t.Errorf("%s: tampered consensus state imported", name)
+		}
+	}
+
+	// States of blocks unknown to the chain are refused, unless trusted
+	var state consensusState
+	if err := json.Unmarshal(file.State, &state); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	short := newTestChainReaderWithHeaders(headers[:3])
+	if err := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil).ImportConsensusState(short, bytes.NewReader(exported.Bytes())); err == nil {
+		t.Error("unknown block: consensus state imported")
+	}
+	head := headers[len(headers)-1]
+	trusted := *config
+	trusted.TrustedCheckpoint = &params.OasysCheckpoint{Number: head.Number.Uint64(), Hash: head.Hash(), Validators: state.Snapshot.validators()}
+	if err := New(chain.Config(), &trusted, rawdb.NewMemoryDatabase(), nil).ImportConsensusState(short, bytes.NewReader(exported.Bytes())); err != nil {
+		t.Errorf("trusted checkpoint: failed to import consensus state: %v", err)
+	}
+	trusted.TrustedCheckpoint.Validators = append(trusted.TrustedCheckpoint.Validators, common.HexToAddress("0x01"))
+	if err := New(chain.Config(), &trusted, rawdb.NewMemoryDatabase(), nil).ImportConsensusState(short, bytes.NewReader(exported.Bytes())); err == nil {
+		t.Error("trusted checkpoint with other validators: consensus state imported")
+	}
+}
@@ -0,0 +1,132 @@
+package oasys
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maxLivenessLag is the number of block periods past the due time of the next
+// block beyond which the head is assumed to be behind the network, as when the
+// node was offline, rather than the chain to be stalled.
+const maxLivenessLag = 10
+
+// missedSlot is a block whose scheduled validator failed to seal it in time.
+type missedSlot struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Validator common.Address `json:"validator"`
+	Due       hexutil.Uint64 `json:"due"` // Timestamp the block was due by, twice the block period after its parent
+}
+
+// livenessMonitor detects stalls of the chain, reporting the scheduled validator
+// of the next block once the head hasn't advanced for twice the block period.
+type livenessMonitor struct {
+	now func() time.Time // Local clock, replaceable in tests
+
+	lock   sync.Mutex
+	missed *missedSlot // Latest missed slot, nil until any
+	quit   chan struct{}
+	closed sync.Once
+}
+
+func newLivenessMonitor(now func() time.Time) *livenessMonitor {
+	return &livenessMonitor{now: now, quit: make(chan struct{})}
+}
+
+// report records the missed slot, warning once per block.
+func (m *livenessMonitor) report(slot *missedSlot) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.missed != nil && m.missed.Number == slot.Number {
+		return
+	}
+	log.Warn("Chain stalled, scheduled validator missed its slot", "number", uint64(slot.Number), "validator", slot.Validator,
+		"late", m.now().Sub(time.Unix(int64(slot.Due), 0)))
+	m.missed = slot
+}
+
+// last returns a copy of the latest missed slot, or nil if none was missed.
+func (m *livenessMonitor) last() *missedSlot {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.missed == nil {
+		return nil
+	}
+	missed := *m.missed
+	return &missed
+}
+
+// stop terminates the monitoring loop, if running.
+func (m *livenessMonitor) stop() {
+	m.closed.Do(func() { close(m.quit) })
+}
+
+// StartLivenessMonitor checks every block period whether the chain stalled,
+// until the engine is closed. Nothing is monitored in archive mode.
+func (c *Oasys) StartLivenessMonitor(chain consensus.ChainHeaderReader) {
+	if c.config.ArchiveMode {
+		return
+	}
+	interval := time.Duration(c.config.Period) * time.Second
+	if interval == 0 {
+		interval = time.Second
+	}
+	goWithLabel("oasys-liveness", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.checkLiveness(chain)
+			case <-c.liveness.quit:
+				return
+			}
+		}
+	})
+}
+
+// checkLiveness reports the scheduled validator of the block following the head
+// if that block is more than twice the block period late. Nothing is reported
+// while the node is syncing, or while its head is far behind the local clock.
+func (c *Oasys) checkLiveness(chain consensus.ChainHeaderReader) {
+	c.lock.RLock()
+	synced := c.synced
+	c.lock.RUnlock()
+	if synced != nil && !synced() {
+		return
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return
+	}
+	pending := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number, common.Big1)}
+	env, err := c.environment(chain, pending, nil)
+	if err != nil {
+		return
+	}
+	period := env.BlockPeriod.Uint64()
+	due := head.Time + 2*period
+	now := uint64(c.liveness.now().Unix())
+	if now <= due {
+		return
+	}
+	if now > due+maxLivenessLag*period {
+		log.Debug("Head behind the local clock, skipping liveness check", "number", head.Number, "due", due, "now", now)
+		return
+	}
+	schedule, err := c.scheduleAt(chain, pending)
+	if err != nil {
+		return
+	}
+	number := pending.Number.Uint64()
+	c.liveness.report(&missedSlot{Number: hexutil.Uint64(number), Validator: schedule[number], Due: hexutil.Uint64(due)})
+}
@@ -0,0 +1,67 @@
+package oasys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestLivenessMonitor(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 3)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	now := time.Unix(int64(headers[3].Time), 0)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 15, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.liveness = newLivenessMonitor(func() time.Time { return now })
+	api := &API{chain: chain, oasys: engine}
+
+	// Block 4 is late, but within twice the block period
+	now = now.Add(30 * time.Second)
+	engine.checkLiveness(chain)
+	if missed := api.GetLastMissedSlot(); missed != nil {
+		t.Errorf("slot missed within the tolerated delay: %+v", missed)
+	}
+
+	// Past twice the block period, its validator is reported
+	now = now.Add(time.Second)
+	engine.checkLiveness(chain)
+	missed := api.GetLastMissedSlot()
+	if missed == nil {
+		t.Fatal("missed slot not detected")
+	}
+	if missed.Number != 4 || missed.Validator != validator || uint64(missed.Due) != headers[3].Time+30 {
+		t.Errorf("missed slot, got %+v, want block 4 of %v due at %d", missed, validator, headers[3].Time+30)
+	}
+}
+
+func TestLivenessMonitorSyncing(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 3)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	now := time.Unix(int64(headers[3].Time)+31, 0)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 15, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.liveness = newLivenessMonitor(func() time.Time { return now })
+	api := &API{chain: chain, oasys: engine}
+
+	// Nothing is reported while syncing
+	synced := false
+	engine.SetSyncStatus(func() bool { return synced })
+	engine.checkLiveness(chain)
+	if missed := api.GetLastMissedSlot(); missed != nil {
+		t.Errorf("slot missed while syncing: %+v", missed)
+	}
+
+	// Nor while the head is far behind the local clock, as after being offline
+	synced = true
+	now = now.Add(maxLivenessLag * 15 * time.Second)
+	engine.checkLiveness(chain)
+	if missed := api.GetLastMissedSlot(); missed != nil {
+		t.Errorf("slot missed behind the local clock: %+v", missed)
+	}
+}
@@ -0,0 +1,111 @@
+package oasys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// errInvalidValidatorRoot is returned if an epoch header past the validator
+// root fork doesn't commit to the Merkle root of its validators.
+var errInvalidValidatorRoot = errors.New("invalid validator root on epoch block")
+
+// validatorMerkleRoot returns the root of the Merkle tree over the validators,
+// which must be sorted. The leaves are the hashes of the addresses, the inner
+// nodes the hashes of their concatenated children, and the last node of a level
+// with an odd number of nodes is promoted to the next level unchanged.
+func validatorMerkleRoot(validators []common.Address) common.Hash {
+	if len(validators) == 0 {
+		return common.Hash{}
+	}
+	level := make([]common.Hash, len(validators))
+	for i, validator := range validators {
+		level[i] = crypto.Keccak256Hash(validator.Bytes())
+	}
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+	return level[0]
+}
+
+// merkleParents returns the level of the tree above the given one.
+func merkleParents(level []common.Hash) []common.Hash {
+	parents := make([]common.Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			parents = append(parents, level[i])
+			continue
+		}
+		parents = append(parents, crypto.Keccak256Hash(level[i].Bytes(), level[i+1].Bytes()))
+	}
+	return parents
+}
+
+// validatorMerkleProof returns the index of the validator among the sorted
+// validators and the sibling hashes from its leaf up to the root, skipping the
+// levels it is promoted through.
+func validatorMerkleProof(validators []common.Address, validator common.Address) (int, []common.Hash, error) {
+	index := -1
+	level := make([]common.Hash, len(validators))
+	for i, v := range validators {
+		if v == validator {
+			index = i
+		}
+		level[i] = crypto.Keccak256Hash(v.Bytes())
+	}
+	if index < 0 {
+		return 0, nil, fmt.Errorf("%v is not a validator", validator)
+	}
+	var (
+		proof    []common.Hash
+		position = index
+	)
+	for len(level) > 1 {
+		if sibling := position ^ 1; sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		level = merkleParents(level)
+		position /= 2
+	}
+	return index, proof, nil
+}
+
+// verifyValidatorProof checks that the validator is at the index of a set of
+// the given size committed to by the root.
+func verifyValidatorProof(root common.Hash, validator common.Address, index, size int, proof []common.Hash) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	node := crypto.Keccak256Hash(validator.Bytes())
+	for width := size; width > 1; width = (width + 1) / 2 {
+		sibling := index ^ 1
+		if sibling < width {
+			if len(proof) == 0 {
+				return false
+			}
+			if index%2 == 0 {
+				node = crypto.Keccak256Hash(node.Bytes(), proof[0].Bytes())
+			} else {
+				node = crypto.Keccak256Hash(proof[0].Bytes(), node.Bytes())
+			}
+			proof = proof[1:]
+		}
+		index /= 2
+	}
+	return len(proof) == 0 && node == root
+}
+
+// verifyValidatorRoot checks that the vanity of the epoch header holds the
+// Merkle root of the given validators, decoded from its extra-data whether
+// compressed or not.
+func verifyValidatorRoot(header *types.Header, validators []common.Address) error {
+	root := validatorMerkleRoot(validators)
+	if !bytes.Equal(header.Extra[:extraVanity], root.Bytes()) {
+		return errInvalidValidatorRoot
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package oasys
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestValidatorMerkleRoot(t *testing.T) {
+	operators := make([]common.Address, 5)
+	for i := range operators {
+		operators[i] = common.BigToAddress(big.NewInt(int64(5 - i)))
+	}
+	sorted := append([]common.Address{}, operators...)
+	sort.Sort(validatorsAscending(sorted))
+
+	// The root depends on the set only once sorted, and changes with it
+	shuffled := []common.Address{operators[2], operators[0], operators[4], operators[1], operators[3]}
+	sort.Sort(validatorsAscending(shuffled))
+	root := validatorMerkleRoot(sorted)
+	if got := validatorMerkleRoot(shuffled); got != root {
+		t.Errorf("root of the reordered set, got %x, want %x", got, root)
+	}
+	if got := validatorMerkleRoot(sorted[:4]); got == root {
+		t.Error("root unchanged after removing a validator")
+	}
+
+	// Every member proves its inclusion, whatever the size of the set
+	for size := 1; size <= len(sorted); size++ {
+		set := sorted[:size]
+		root := validatorMerkleRoot(set)
+		for _, operator := range set {
+			index, proof, err := validatorMerkleProof(set, operator)
+			if err != nil {
+				t.Fatalf("size %d: failed to prove %v: %v", size, operator, err)
+			}
+			if !verifyValidatorProof(root, operator, index, size, proof) {
+				t.Errorf("size %d: proof of %v rejected", size, operator)
+			}
+		}
+	}
+
+	// Non-members can't be proven, nor pass off a member's proof
+	outsider := common.BigToAddress(big.NewInt(6))
+	if _, _, err := validatorMerkleProof(sorted, outsider); err == nil {
+		t.Error("proof of a non-member generated")
+	}
+	index, proof, _ := validatorMerkleProof(sorted, sorted[1])
+	if verifyValidatorProof(root, outsider, index, len(sorted), proof) {
+		t.Error("non-member verified with a member's proof")
+	}
+	if verifyValidatorProof(root, sorted[1], index, len(sorted), proof[:len(proof)-1]) {
+		t.Error("truncated proof verified")
+	}
+}
+
+func TestVerifyValidatorRoot(t *testing.T) {
+	config := &params.OasysConfig{Period: 1, Epoch: 10, ValidatorRootBlock: big.NewInt(20)}
+	if config.IsValidatorRoot(big.NewInt(10)) || !config.IsValidatorRoot(big.NewInt(20)) {
+		t.Fatal("validator root fork activated at the wrong block")
+	}
+
+	sorted := append([]common.Address{}, validators...)
+	sort.Sort(validatorsAscending(sorted))
+	extra := make([]byte, extraVanity)
+	for _, validator := range sorted {
+		extra = append(extra, validator.Bytes()...)
+	}
+	extra = append(extra, make([]byte, extraSeal)...)
+	header := &types.Header{Number: big.NewInt(20), Extra: extra}
+
+	if err := verifyValidatorRoot(header, sorted); err != errInvalidValidatorRoot {
+		t.Errorf("empty vanity, got %v, want %v", err, errInvalidValidatorRoot)
+	}
+	copy(header.Extra[:extraVanity], validatorMerkleRoot(sorted).Bytes())
+	if err := verifyValidatorRoot(header, sorted); err != nil {
+		t.Errorf("committed root rejected: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package oasys
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	activeValidatorsGauge    = metrics.NewRegisteredGauge("oasys/validators/active", nil)
+	candidateValidatorsGauge = metrics.NewRegisteredGauge("oasys/validators/candidates", nil)
+	jailedValidatorsGauge    = metrics.NewRegisteredGauge("oasys/validators/jailed", nil)
+	validatorChurnGauge      = metrics.NewRegisteredGauge("oasys/validators/churn", nil)
+
+	rewardOutsidersCounter = metrics.NewRegisteredCounter("oasys/rewards/outsiders", nil)
+)
+
+// validatorMetricsUpdate is an epoch block to report the validators of.
+type validatorMetricsUpdate struct {
+	chain  consensus.ChainHeaderReader
+	header *types.Header
+	env    *environmentValue
+	next   *getNextValidatorsResult
+}
+
+// metricsWorker reports the validator metrics off the block processing path, as
+// they take a call per validator. Updates are reported one at a time by a single
+// worker, the ones queued while it's busy replacing each other, so that only the
+// latest epoch block is reported while syncing.
+type metricsWorker struct {
+	pending chan *validatorMetricsUpdate // Latest update not reported yet
+	quit    chan struct{}
+	started sync.Once
+	closed  sync.Once
+}
+
+func newMetricsWorker() *metricsWorker {
+	return &metricsWorker{pending: make(chan *validatorMetricsUpdate, 1), quit: make(chan struct{})}
+}
+
+// queue schedules the update for the worker, started on first use, dropping the
+// update pending if any.
+func (w *metricsWorker) queue(report func(*validatorMetricsUpdate), update *validatorMetricsUpdate) {
+	w.started.Do(func() {
+		goWithLabel("oasys-metrics", func() {
+			for {
+				select {
+				case update := <-w.pending:
+					report(update)
+				case <-w.quit:
+					return
+				}
+			}
+		})
+	})
+	for {
+		select {
+		case w.pending <- update:
+			return
+		default:
+		}
+		select {
+		case <-w.pending:
+		default:
+		}
+	}
+}
+
+// stop terminates the worker, if running.
+func (w *metricsWorker) stop() {
+	w.closed.Do(func() { close(w.quit) })
+}
+
+// queueValidatorMetrics reports the validators of the given epoch block in the
+// background, if metrics are enabled.
+func (c *Oasys) queueValidatorMetrics(chain consensus.ChainHeaderReader, header *types.Header, env *environmentValue, next *getNextValidatorsResult) {
+	if !metrics.Enabled {
+		return
+	}
+	c.metrics.queue(c.reportValidatorMetrics, &validatorMetricsUpdate{chain: chain, header: types.CopyHeader(header), env: env, next: next})
+}
+
+// reportValidatorMetrics reports the queued update, unless the head already
+// moved past its epoch.
+func (c *Oasys) reportValidatorMetrics(update *validatorMetricsUpdate) {
+	number := update.header.Number.Uint64()
+	if head := update.chain.CurrentHeader(); head != nil && head.Number.Uint64() >= number+update.env.EpochPeriod.Uint64() {
+		log.Debug("Skipping stale validator metrics", "number", number, "head", head.Number)
+		return
+	}
+	c.updateValidatorMetrics(update.chain, update.header, update.env, update.next)
+}
+
+// updateValidatorMetrics reports the validators selected at the given epoch
+// block, the candidates regardless of the stake threshold, the jailed validators
+// and the number of validators added and removed against the previous epoch.
+// Failures are only logged, as the metrics must not affect block processing,
+// which queues them for the metrics worker.
+func (c *Oasys) updateValidatorMetrics(chain consensus.ChainHeaderReader, header *types.Header, env *environmentValue, next *getNextValidatorsResult) {
+	if !metrics.Enabled {
+		return
+	}
+	number := header.Number.Uint64()
+	epoch := env.Epoch(number)
+	activeValidatorsGauge.Update(int64(len(next.Operators)))
+
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		log.Debug("Failed to get previous validators for metrics", "number", number, "err", err)
+	} else {
+		selected := make(map[common.Address]bool, len(next.Operators))
+		churn := 0
+		for _, operator := range next.Operators {
+			selected[operator] = true
+			if !snap.exists(operator) {
+				churn++
+			}
+		}
+		for operator := range snap.Validators {
+			if !selected[operator] {
+				churn++
+			}
+		}
+		validatorChurnGauge.Update(int64(churn))
+	}
+
+	candidates, err := getNextValidatorsPaged(c.ethAPI, header.ParentHash, epoch, nil, c.tunables.pageSize())
+	if err == nil {
+		candidates, err = withAllowlist(c.ethAPI, c.config, number, header.ParentHash, candidates)
+	}
+	if err != nil {
+		log.Debug("Failed to get candidates for metrics", "number", number, "err", err)
+	} else {
+		candidateValidatorsGauge.Update(int64(len(candidates.Operators)))
+	}
+
+	owners, err := getValidatorOwners(c.ethAPI, header.ParentHash)
+	if err != nil {
+		log.Debug("Failed to get validator owners for metrics", "number", number, "err", err)
+		return
+	}
+	jailed := 0
+	for _, owner := range owners {
+		ok, err := isValidatorJailed(c.ethAPI, header.ParentHash, owner, epoch)
+		if err != nil {
+			log.Debug("Failed to get jailed validators for metrics", "number", number, "err", err)
+			return
+		}
+		if ok {
+			jailed++
+		}
+	}
+	jailedValidatorsGauge.Update(int64(jailed))
+}
@@ -0,0 +1,105 @@
+package oasys
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestValidatorMetrics(t *testing.T) {
+	enabled := metrics.Enabled
+	gauges := []*metrics.Gauge{&activeValidatorsGauge, &candidateValidatorsGauge, &jailedValidatorsGauge, &validatorChurnGauge}
+	saved := make([]metrics.Gauge, len(gauges))
+	for i, gauge := range gauges {
+		saved[i] = *gauge
+		*gauge = new(metrics.StandardGauge)
+	}
+	metrics.Enabled = true
+	defer func() {
+		metrics.Enabled = enabled
+		for i, gauge := range gauges {
+			*gauge = saved[i]
+		}
+	}()
+
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 20)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// At epoch 3 the first validator leaves, a newcomer joins and the last
+	// validator stays jailed
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, validators, stakes)
+	backend.register(3, append(append([]common.Address{}, validators[1:]...), common.HexToAddress("0x0e")), stakes)
+	backend.jailed[validators[3]] = true
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+
+	env, err := engine.environment(chain, headers[20], nil)
+	if err != nil {
+		t.Fatalf("failed to get environment: %v", err)
+	}
+	next, err := engine.getNextValidators(nil, headers[20].ParentHash, env, 20, nil)
+	if err != nil {
+		t.Fatalf("failed to get validators: %v", err)
+	}
+	engine.updateValidatorMetrics(chain, headers[20], env, next)
+
+	for _, tt := range []struct {
+		name  string
+		gauge metrics.Gauge
+		want  int64
+	}{
+		{"active", activeValidatorsGauge, 3},
+		{"candidates", candidateValidatorsGauge, 3},
+		{"jailed", jailedValidatorsGauge, 1},
+		{"churn", validatorChurnGauge, 2},
+	} {
+		if got := tt.gauge.Value(); got != tt.want {
+			t.Errorf("%s gauge, got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsWorker(t *testing.T) {
+	worker := newMetricsWorker()
+	defer worker.stop()
+
+	var (
+		reported = make(chan uint64, 3)
+		release  = make(chan struct{})
+	)
+	report := func(update *validatorMetricsUpdate) {
+		reported <- update.header.Number.Uint64()
+		<-release
+	}
+	update := func(number int64) *validatorMetricsUpdate {
+		return &validatorMetricsUpdate{header: &types.Header{Number: big.NewInt(number)}}
+	}
+
+	// Updates queued while the worker is busy replace each other
+	worker.queue(report, update(10))
+	if got := <-reported; got != 10 {
+		t.Fatalf("first update, got block %d, want 10", got)
+	}
+	worker.queue(report, update(20))
+	worker.queue(report, update(30))
+	close(release)
+	if got := <-reported; got != 30 {
+		t.Errorf("latest update, got block %d, want 30", got)
+	}
+	select {
+	case got := <-reported:
+		t.Errorf("stale update reported: block %d", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
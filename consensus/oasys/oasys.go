@@ -2,11 +2,13 @@ package oasys
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"math/rand"
+	"runtime/pprof"
 	"sort"
 	"sync"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -26,7 +29,6 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
-	lru "github.com/hashicorp/golang-lru"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -74,6 +76,10 @@ var (
 	// their extra-data fields.
 	errExtraSigners = errors.New("non-checkpoint block contains extra signer list")
 
+	// errExtraDataTooShort is returned if the extra-data of an epoch block is too
+	// short to contain any validator.
+	errExtraDataTooShort = errors.New("extra-data too short for validator list")
+
 	// errInvalidCheckpointValidators is returned if a checkpoint block contains an
 	// invalid list of validators (i.e. non divisible by 20 bytes).
 	errInvalidCheckpointValidators = errors.New("invalid validator list on checkpoint block")
@@ -82,6 +88,24 @@ var (
 	// list of validators different than the one the local node calculated.
 	errMismatchingEpochValidators = errors.New("mismatching validator list on checkpoint block")
 
+	// errScheduleSpan is returned if a validator schedule doesn't cover exactly
+	// the blocks of its epoch.
+	errScheduleSpan = errors.New("validator schedule mismatches epoch span")
+
+	// errValidatorSetMismatch is returned if the validator set embedded in an
+	// epoch header differs from the one the StakeManager reports at the boundary.
+	errValidatorSetMismatch = errors.New("embedded validator set mismatches contract state")
+
+	// errDuplicateOperator is returned if the validator set embedded in an epoch
+	// header lists an operator address more than once.
+	errDuplicateOperator = errors.New("duplicate operator in embedded validator set")
+
+	// errUnexpectedSystemTx is returned if a block carries system transactions
+	// beyond the ones the engine issues for it. Rewards are minted without any
+	// transaction at epoch boundaries only, so a reward distribution transaction
+	// is always unexpected.
+	errUnexpectedSystemTx = errors.New("must not contain system transactions")
+
 	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
 	errInvalidMixDigest = errors.New("non-zero mix digest")
 
@@ -104,6 +128,44 @@ var (
 
 	// errCoinBaseMisMatch is returned if a header's coinbase do not match with signature
 	errCoinBaseMisMatch = errors.New("coinbase do not match with signature")
+
+	// errReorgTooDeep is returned if a header belongs to a fork whose common
+	// ancestor with the local chain is deeper than the configured limit.
+	errReorgTooDeep = errors.New("reorg exceeds maximum depth")
+
+	// errSystemTxFee is returned if a system transaction carries a gas price, as
+	// its gas must never be paid to the coinbase as a transaction fee.
+	errSystemTxFee = errors.New("system transaction with non-zero gas price")
+
+	// errEnvironmentABIMismatch is returned if the Environment contract returns
+	// a value whose layout doesn't match the environmentValue.
+	errEnvironmentABIMismatch = errors.New("environment value ABI mismatch")
+
+	// errRewardRecipient is returned if a validator owner outside of the active
+	// set of the rewarded epoch is paid rewards.
+	errRewardRecipient = errors.New("rewards paid to inactive validator")
+
+	// errCorruptSnapshot is returned if a snapshot persisted on disk can't be
+	// decoded into a usable state.
+	errCorruptSnapshot = errors.New("corrupt snapshot")
+
+	// errRecentlySigned is returned if a header is signed out-of-turn by a
+	// validator who sealed a block too recently, as enforced by the signer
+	// diversity rule.
+	errRecentlySigned = errors.New("recently signed")
+
+	// errFutureBlock is returned if a header is timestamped further ahead of the
+	// local clock than the configured tolerance, so that it is rejected rather
+	// than queued until its time.
+	errFutureBlock = errors.New("block in the future beyond tolerance")
+
+	// errGasUsedMismatch is returned if the gas used by a block doesn't add up to
+	// the gas used by its receipts after the system transactions are applied.
+	errGasUsedMismatch = errors.New("gas used mismatches receipts")
+
+	// errInsufficientPeers is returned when sealing a block while the node has
+	// fewer connected peers than configured, as during a network partition.
+	errInsufficientPeers = errors.New("insufficient peers to seal")
 )
 
 // SignerFn hashes and signs the data to be signed by a backing account.
@@ -111,25 +173,28 @@ type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]
 type TxSignerFn func(accounts.Account, *types.Transaction, *big.Int) (*types.Transaction, error)
 
 // ecrecover extracts the Ethereum account address from a signed header.
-func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+func ecrecover(config *params.OasysConfig, header *types.Header, sigcache *countingCache) (common.Address, error) {
 	// If the signature's already cached, return that
 	hash := header.Hash()
 	if address, known := sigcache.Get(hash); known {
 		return address.(common.Address), nil
 	}
-	// Retrieve the signature from the header extra-data
-	if len(header.Extra) < extraSeal {
+	// Retrieve the signature from the header extra-data, refusing truncated ones
+	// before they reach the seal hash
+	if len(header.Extra) < extraVanity+extraSeal {
 		return common.Address{}, errMissingSignature
 	}
 	signature := header.Extra[len(header.Extra)-extraSeal:]
 
-	// Recover the public key and the Ethereum address
-	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
+	// Recover the signer with the seal scheme of the block
+	scheme, err := sealSchemeAt(config, header.Number.Uint64())
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer, err := scheme.Recover(header, signature, sealChainID(config, header.Number))
 	if err != nil {
 		return common.Address{}, err
 	}
-	var signer common.Address
-	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
 
 	sigcache.Add(hash, signer)
 	return signer, nil
@@ -141,8 +206,9 @@ type Oasys struct {
 	config      *params.OasysConfig // Consensus engine configuration parameters
 	db          ethdb.Database      // Database to store and retrieve snapshot checkpoints
 
-	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
-	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	recents      *countingCache // Snapshots for recent block to speed up reorgs
+	signatures   *countingCache // Signatures of recent blocks to speed up mining
+	environments lookupCounter  // Environment values read from the snapshots or the Environment contract
 
 	proposals map[common.Address]bool // Current list of proposals we are pushing
 
@@ -150,12 +216,30 @@ type Oasys struct {
 	signFn SignerFn       // Signer function to authorize hashes with
 	lock   sync.RWMutex   // Protects the signer fields
 
-	ethAPI   *ethapi.PublicBlockChainAPI
+	ethAPI   blockchainAPI
 	txSigner types.Signer
 	txSignFn TxSignerFn
+	nonces   NonceProvider // Nonce source for system transactions
+	peers    func() int    // Number of connected peers, not checked before sealing if nil
+	synced   func() bool   // Whether the node caught up with the network, assumed so if nil
+
+	selectionFilter func(common.Address) bool // Validators kept in the active set of this node, all if nil
+
+	slashingPaused bool // Whether slashing is suspended during a network emergency
+
+	clock         *clockSkewMonitor  // Skew of the local clock against block timestamps
+	now           func() time.Time   // Local clock, faked by tests
+	liveness      *livenessMonitor   // Stalls of the chain and the validators missing their slot
+	metrics       *metricsWorker     // Reporter of the validator metrics of the latest epoch block
+	tunables      *tunables          // Settings changeable at runtime
+	systemTxKinds []*systemTxKind    // System transactions applied to every block, in order
+	rejected      *rejectionLog      // Recent headers that failed verification
+	timing        *sealTimingMonitor // Delay of the recent blocks after their slot opened
+	tracer        Tracer             // Spans of the seal and finalize operations
 
 	// The fields below are for testing only
-	fakeDiff bool // Skip difficulty verifications
+	fakeDiff     bool                      // Skip difficulty verifications
+	fakeSchedule map[uint64]common.Address // Validator schedule replacing the stake-weighted one
 }
 
 // New creates a Oasys proof-of-stake consensus engine with the initial
@@ -166,19 +250,41 @@ func New(chainConfig *params.ChainConfig, config *params.OasysConfig, db ethdb.D
 	if conf.Epoch == 0 {
 		conf.Epoch = epochLength
 	}
+	if conf.ChainID == nil && chainConfig != nil {
+		conf.ChainID = chainConfig.ChainID
+	}
+	if len(conf.BootstrapValidators) == 0 && db != nil {
+		conf.BootstrapValidators = genesisSigners(db)
+	}
 	// Allocate the snapshot caches and create the engine
-	recents, _ := lru.NewARC(inmemorySnapshots)
-	signatures, _ := lru.NewARC(inmemorySignatures)
+	recents := newCountingCache(inmemorySnapshots)
+	signatures := newCountingCache(inmemorySignatures)
+
+	// Don't wrap a missing backend into a non-nil interface
+	var backend blockchainAPI
+	if ethAPI != nil {
+		backend = ethAPI
+	}
 
 	return &Oasys{
-		chainConfig: chainConfig,
-		config:      &conf,
-		db:          db,
-		recents:     recents,
-		signatures:  signatures,
-		proposals:   make(map[common.Address]bool),
-		ethAPI:      ethAPI,
-		txSigner:    types.MakeSigner(chainConfig, common.Big0),
+		chainConfig:   chainConfig,
+		config:        &conf,
+		db:            db,
+		recents:       recents,
+		signatures:    signatures,
+		proposals:     make(map[common.Address]bool),
+		ethAPI:        backend,
+		txSigner:      types.MakeSigner(chainConfig, common.Big0),
+		nonces:        stateNonceProvider{},
+		clock:         newClockSkewMonitor(time.Now),
+		now:           time.Now,
+		liveness:      newLivenessMonitor(time.Now),
+		metrics:       newMetricsWorker(),
+		rejected:      new(rejectionLog),
+		timing:        new(sealTimingMonitor),
+		tunables:      newTunables(&conf),
+		systemTxKinds: defaultSystemTxKinds(),
+		tracer:        noopTracer{},
 	}
 }
 
@@ -190,7 +296,9 @@ func (c *Oasys) Author(header *types.Header) (common.Address, error) {
 
 // VerifyHeader checks whether a header conforms to the consensus rules.
 func (c *Oasys) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
-	return c.verifyHeader(chain, header, nil)
+	err := c.verifyHeader(chain, header, nil)
+	c.rejected.record(header, err)
+	return err
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
@@ -200,9 +308,10 @@ func (c *Oasys) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*type
 	abort := make(chan struct{})
 	results := make(chan error, len(headers))
 
-	go func() {
+	goWithLabel("oasys-verify", func() {
 		for i, header := range headers {
 			err := c.verifyHeader(chain, header, headers[:i])
+			c.rejected.record(header, err)
 
 			select {
 			case <-abort:
@@ -210,7 +319,7 @@ func (c *Oasys) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*type
 			case results <- err:
 			}
 		}
-	}()
+	})
 	return abort, results
 }
 
@@ -222,11 +331,19 @@ func (c *Oasys) verifyHeader(chain consensus.ChainHeaderReader, header *types.He
 	if header.Number == nil {
 		return errUnknownBlock
 	}
+	// Refuse chains not passing through the trusted checkpoint
+	if err := verifyTrustedCheckpoint(c.config, header); err != nil {
+		return err
+	}
+	if !c.config.IsOasys(header.Number) {
+		return c.verifyLegacyHeader(chain, header, parents)
+	}
 	number := header.Number.Uint64()
+	c.observeClockSkew(chain, header)
 
 	// Don't waste time checking blocks from the future
-	if header.Time > uint64(time.Now().Unix()) {
-		return consensus.ErrFutureBlock
+	if err := verifyFutureTime(c.config, header, c.now()); err != nil {
+		return err
 	}
 	// Check that the extra-data contains both the validators and signature
 	if len(header.Extra) < extraVanity {
@@ -245,8 +362,18 @@ func (c *Oasys) verifyHeader(chain consensus.ChainHeaderReader, header *types.He
 	if !isEpoch && validatorBytes != 0 {
 		return errExtraSigners
 	}
-	if isEpoch && validatorBytes%common.AddressLength != 0 {
-		return errInvalidCheckpointValidators
+	if isEpoch && c.config.IsCompressedExtra(header.Number) {
+		// Compressed validators are checked against the previous epoch's ones
+		if validatorBytes == 0 {
+			return errExtraDataTooShort
+		}
+	} else {
+		if isEpoch && validatorBytes < common.AddressLength {
+			return errExtraDataTooShort
+		}
+		if isEpoch && validatorBytes%common.AddressLength != 0 {
+			return errInvalidCheckpointValidators
+		}
 	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
 	if header.MixDigest != (common.Hash{}) {
@@ -258,8 +385,8 @@ func (c *Oasys) verifyHeader(chain consensus.ChainHeaderReader, header *types.He
 	}
 	// Ensure that the block's difficulty is meaningful (may not be correct at this point)
 	if number > 0 {
-		if header.Difficulty == nil || (header.Difficulty.Cmp(diffInTurn) != 0 && header.Difficulty.Cmp(diffNoTurn) != 0) {
-			return errInvalidDifficulty
+		if err := verifyDifficulty(header); err != nil {
+			return err
 		}
 	}
 	// Verify that the gas limit is <= 2^63-1
@@ -270,10 +397,62 @@ func (c *Oasys) verifyHeader(chain consensus.ChainHeaderReader, header *types.He
 	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
 		return err
 	}
+	// Refuse forks that would unwind more of the local chain than allowed
+	if err := c.verifyReorgDepth(chain, header, parents); err != nil {
+		return err
+	}
 	// All basic checks passed, verify cascading fields
 	return c.verifyCascadingFields(chain, header, parents)
 }
 
+// verifyReorgDepth checks that the fork the header belongs to does not branch
+// off the canonical chain deeper than the configured maximum reorg depth. The
+// caller may optionally pass in a batch of parents (ascending order) which are
+// not yet part of the local blockchain.
+func (c *Oasys) verifyReorgDepth(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	if c.config.MaxReorgDepth == 0 || header.Number.Uint64() == 0 {
+		return nil
+	}
+	current := chain.CurrentHeader()
+	if current == nil {
+		return nil
+	}
+	head := current.Number.Uint64()
+
+	// Headers already on the canonical chain don't unwind anything
+	number, hash := header.Number.Uint64(), header.Hash()
+	if canonical := chain.GetHeaderByNumber(number); canonical != nil && canonical.Hash() == hash {
+		return nil
+	}
+	// Walk back along the fork until it joins the canonical chain
+	number, hash = number-1, header.ParentHash
+	for {
+		if canonical := chain.GetHeaderByNumber(number); canonical != nil && canonical.Hash() == hash {
+			break
+		}
+		// The common ancestor is below this block, stop early if already too deep
+		if head >= number && head-number >= c.config.MaxReorgDepth {
+			return errReorgTooDeep
+		}
+		var parent *types.Header
+		if len(parents) > 0 && parents[len(parents)-1].Hash() == hash {
+			parent = parents[len(parents)-1]
+			parents = parents[:len(parents)-1]
+		} else {
+			parent = chain.GetHeader(hash, number)
+		}
+		// Unknown ancestors are reported by the cascading field checks
+		if parent == nil || number == 0 {
+			return nil
+		}
+		number, hash = number-1, parent.ParentHash
+	}
+	if head > number && head-number > c.config.MaxReorgDepth {
+		return errReorgTooDeep
+	}
+	return nil
+}
+
 // verifyCascadingFields verifies all the header fields that are not standalone,
 // rather depend on a batch of previous headers. The caller may optionally pass
 // in a batch of parents (ascending order) to avoid looking those up from the
@@ -301,24 +480,65 @@ func (c *Oasys) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	}
 	var backoff uint64
 	if number > 0 && env.IsEpoch(number) {
-		result, err := getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+		result, err := c.getNextValidators(chain, header.ParentHash, env, number, parents)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "verifyCascadingFields", "hash", header.ParentHash, "number", number, "err", err)
 			return err
 		}
-		backoff = c.backOffTime(chain, result, env, number, header.Coinbase)
+		embedded, err := c.embeddedValidators(chain, header, parents)
+		if err != nil {
+			return err
+		}
+		if err := verifyEpochValidators(embedded, result); err != nil {
+			return err
+		}
+		if c.config.IsValidatorRoot(header.Number) {
+			if err := verifyValidatorRoot(header, embedded); err != nil {
+				return err
+			}
+		}
+		if err := verifyCheckpointValidators(c.config, number, result.Operators); err != nil {
+			return err
+		}
+		if c.sealedByIncoming(env, number) {
+			backoff = c.backOffTime(chain, result, env, number, header.Coinbase)
+		} else {
+			snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+			if err != nil {
+				return err
+			}
+			backoff = snap.backOffTime(chain, env, number, header.Coinbase)
+		}
 	} else {
 		// Retrieve the snapshot needed to verify this header and cache it
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
 		if err != nil {
 			return err
 		}
+		if err := verifyCheckpointValidators(c.config, number, snap.validators()); err != nil {
+			return err
+		}
 		backoff = snap.backOffTime(chain, env, number, header.Coinbase)
 	}
-	if header.Time < parent.Time+env.BlockPeriod.Uint64()+backoff {
+	slot := parent.Time + env.BlockPeriod.Uint64() + backoff
+	if header.Time < slot {
 		return consensus.ErrFutureBlock
 	}
+	if err := verifyGasFields(chain, header, parent); err != nil {
+		return err
+	}
+
+	// All basic checks passed, verify the seal and return
+	if err := c.verifySeal(chain, header, parents); err != nil {
+		return err
+	}
+	c.timing.observe(number, header.Time-slot)
+	return nil
+}
 
+// verifyGasFields verifies the gas limit, gas used and base fee of the header
+// against its parent.
+func verifyGasFields(chain consensus.ChainHeaderReader, header, parent *types.Header) error {
 	// Verify that the gasUsed is <= gasLimit
 	if header.GasUsed > header.GasLimit {
 		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
@@ -335,9 +555,120 @@ func (c *Oasys) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 		// Verify the header's EIP-1559 attributes.
 		return err
 	}
+	return nil
+}
 
-	// All basic checks passed, verify the seal and return
-	return c.verifySeal(chain, header, parents)
+// verifyLegacyHeader checks a header preceding the activation of the Oasys rules
+// at OasysBlock. Such blocks are sealed in-turn by any of the genesis validators,
+// without validator schedule, epochs nor system contracts.
+func (c *Oasys) verifyLegacyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Don't waste time checking blocks from the future
+	if err := verifyFutureTime(c.config, header, c.now()); err != nil {
+		return err
+	}
+	if len(header.Extra) < extraVanity {
+		return errMissingVanity
+	}
+	if len(header.Extra) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	if len(header.Extra) != extraVanity+extraSeal {
+		return errExtraSigners
+	}
+	if header.MixDigest != (common.Hash{}) {
+		return errInvalidMixDigest
+	}
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	if header.Difficulty == nil || header.Difficulty.Cmp(diffInTurn) != 0 {
+		return errWrongDifficulty
+	}
+	if header.GasLimit > params.MaxGasLimit {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, params.MaxGasLimit)
+	}
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	// Snapshots skip the legacy blocks, keeping the genesis validators
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	validator, err := ecrecover(c.config, header, c.signatures)
+	if err != nil {
+		return err
+	}
+	if validator != header.Coinbase {
+		return errCoinBaseMisMatch
+	}
+	if !snap.exists(validator) {
+		return errUnauthorizedValidator
+	}
+	if header.Time < parent.Time+c.config.Period {
+		return consensus.ErrFutureBlock
+	}
+	return verifyGasFields(chain, header, parent)
+}
+
+// genesisValidators returns the validators of the first epoch registered in the
+// StakeManager state of the genesis block, if it is part of the genesis alloc.
+func (c *Oasys) genesisValidators(hash common.Hash) *getNextValidatorsResult {
+	if c.ethAPI == nil {
+		return nil
+	}
+	env := getInitialEnvironment(c.config)
+	result, err := getNextValidatorsPaged(c.ethAPI, hash, env.Epoch(0), validatorThreshold(c.config, env, 0), c.tunables.pageSize())
+	if err != nil {
+		log.Debug("No validators in the genesis StakeManager state", "hash", hash, "err", err)
+		return nil
+	}
+	active, _ := splitStandbys(c.config, 0, withUniqueOperators(c.config, 0, result))
+	return c.withSelectionFilter(active)
+}
+
+// genesisSigners returns the validators of the genesis header stored in the
+// database, if any, which the bootstrap validators default to so that the
+// genesis signers keep sealing until the StakeManager reports qualifying
+// validators.
+func genesisSigners(db ethdb.Database) []common.Address {
+	hash := rawdb.ReadCanonicalHash(db, 0)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	genesis := rawdb.ReadHeader(db, hash, 0)
+	if genesis == nil || len(genesis.Extra) < extraVanity+extraSeal {
+		return nil
+	}
+	validators, err := parseValidatorBytes(genesis.Extra[extraVanity : len(genesis.Extra)-extraSeal])
+	if err != nil {
+		log.Warn("Invalid validators in the genesis header", "err", err)
+		return nil
+	}
+	return validators
+}
+
+// isFirstOasysBlock reports whether the block is the first one sealed under the
+// Oasys rules, which deploys the system contracts.
+func (c *Oasys) isFirstOasysBlock(number uint64) bool {
+	if c.config.OasysBlock == nil || c.config.OasysBlock.Uint64() <= 1 {
+		return number == 1
+	}
+	return number == c.config.OasysBlock.Uint64()
 }
 
 // snapshot retrieves the authorization snapshot at a given point in time.
@@ -354,12 +685,34 @@ func (c *Oasys) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 			break
 		}
 		// If an on-disk checkpoint snapshot can be found, use that
-		if number%checkpointInterval == 0 {
-			if s, err := loadSnapshot(c.config, c.signatures, c.ethAPI, c.db, hash); err == nil {
+		trusted := isTrustedCheckpoint(c.config, number, hash)
+		if number%checkpointInterval == 0 || trusted {
+			s, err := loadSnapshot(c.config, c.signatures, c.ethAPI, c.db, hash)
+			if err == nil {
 				log.Trace("Loaded snapshot from disk", "number", number, "hash", hash)
 				snap = s
 				break
 			}
+			// Drop an unreadable snapshot and rebuild it from the chain instead
+			if errors.Is(err, errCorruptSnapshot) {
+				log.Warn("Deleting corrupt snapshot from disk", "number", number, "hash", hash, "err", err)
+				if err := c.db.Delete(snapshotKey(hash)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		// If we're at the trusted checkpoint, snapshot its validators rather than
+		// walking back to the genesis
+		if trusted {
+			if snap = c.trustedSnapshot(number, hash); snap != nil {
+				if !c.config.ArchiveMode {
+					if err := snap.store(c.db); err != nil {
+						return nil, err
+					}
+					log.Info("Stored trusted checkpoint snapshot to disk", "number", number, "hash", hash)
+				}
+				break
+			}
 		}
 		// If we're at the genesis, snapshot the initial state. Alternatively if we're
 		// at a checkpoint block without a parent (light client CHT), or we have piled
@@ -375,12 +728,26 @@ func (c *Oasys) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 				if err != nil {
 					return nil, err
 				}
+				var stakes []*big.Int
+				if len(validators) == 0 {
+					if registered := c.genesisValidators(hash); registered != nil {
+						validators, stakes = registered.Operators, registered.Stakes
+					}
+				}
+				if len(validators) == 0 {
+					validators = c.config.BootstrapValidators
+				}
 
 				snap = newSnapshot(c.config, c.signatures, c.ethAPI, number, hash, validators, getInitialEnvironment(c.config))
-				if err := snap.store(c.db); err != nil {
-					return nil, err
+				for i, stake := range stakes {
+					snap.Validators[validators[i]] = new(big.Int).Set(stake)
+				}
+				if !c.config.ArchiveMode {
+					if err := snap.store(c.db); err != nil {
+						return nil, err
+					}
+					log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
 				}
-				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
 				break
 			}
 		}
@@ -406,6 +773,7 @@ func (c *Oasys) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	if snap == nil {
 		return nil, fmt.Errorf("unknown error while retrieving snapshot at block %v", number)
 	}
+	snap.tunables = c.tunables
 
 	// Previous snapshot found, apply any pending headers on top of it
 	for i := 0; i < len(headers)/2; i++ {
@@ -417,8 +785,11 @@ func (c *Oasys) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	}
 	c.recents.Add(snap.Hash, snap)
 
-	// If we've generated a new checkpoint snapshot, save to disk
-	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+	// If we've generated a new checkpoint snapshot, save to disk unless replaying
+	// in archive mode, where the snapshots are rebuilt from the headers on demand.
+	// Without any on disk, the first snapshot after a restart walks the headers
+	// back to the genesis, or the trusted checkpoint, and replays them all.
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 && !c.config.ArchiveMode {
 		if err = snap.store(c.db); err != nil {
 			return nil, err
 		}
@@ -436,6 +807,30 @@ func (c *Oasys) VerifyUncles(chain consensus.ChainReader, block *types.Block) er
 	return nil
 }
 
+// verifyEpochValidators checks that the validator set embedded in the epoch
+// header, sorted ascending, equals the one computed from the StakeManager.
+func verifyEpochValidators(embedded []common.Address, result *getNextValidatorsResult) error {
+	// Validators sharing an operator would collide in the schedule and rewards
+	seen := make(map[common.Address]bool, len(embedded))
+	for _, operator := range embedded {
+		if seen[operator] {
+			return errDuplicateOperator
+		}
+		seen[operator] = true
+	}
+	validators := result.Copy().Operators
+	sort.Sort(validatorsAscending(validators))
+	if len(embedded) != len(validators) {
+		return errValidatorSetMismatch
+	}
+	for i, validator := range validators {
+		if embedded[i] != validator {
+			return errValidatorSetMismatch
+		}
+	}
+	return nil
+}
+
 // verifySeal checks whether the signature contained in the header satisfies the
 // consensus protocol requirements. The method accepts an optional list of parent
 // headers that aren't yet part of the local blockchain to generate the snapshots
@@ -448,7 +843,7 @@ func (c *Oasys) verifySeal(chain consensus.ChainHeaderReader, header *types.Head
 	}
 
 	// Resolve the authorization key and check against validators
-	validator, err := ecrecover(header, c.signatures)
+	validator, err := ecrecover(c.config, header, c.signatures)
 	if err != nil {
 		return err
 	}
@@ -462,29 +857,46 @@ func (c *Oasys) verifySeal(chain consensus.ChainHeaderReader, header *types.Head
 	}
 	var (
 		exists   bool
+		active   int
 		schedule map[uint64]common.Address
 	)
-	if number > 0 && env.IsEpoch(number) {
-		result, err := getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+	if number > 0 && c.sealedByIncoming(env, number) {
+		result, err := c.getNextValidators(chain, header.ParentHash, env, number, parents)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "verifySeal", "hash", header.ParentHash, "number", number, "err", err)
 			return err
 		}
 		exists = result.Exists(validator)
-		schedule = c.getValidatorSchedule(chain, result, env, number)
+		active = len(result.Operators)
+		if schedule, err = c.getValidatorSchedule(chain, result, env, number); err != nil {
+			return err
+		}
 	} else {
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
 		if err != nil {
 			return err
 		}
 		exists = snap.exists(validator)
-		schedule = snap.getValidatorSchedule(chain, env, number)
+		active = len(snap.Validators)
+		if schedule, err = c.snapshotSchedule(chain, snap, env, number); err != nil {
+			return err
+		}
 	}
 	if !exists {
 		return errUnauthorizedValidator
 	}
 
+	// Ensure that an out-of-turn validator didn't seal one of the recent blocks
+	if schedule[number] != validator {
+		if err := c.verifyRecents(chain, header, parents, validator, active); err != nil {
+			return err
+		}
+	}
+
 	// Ensure that the difficulty corresponds to the turn-ness of the validator
+	if err := verifyDifficulty(header); err != nil {
+		return err
+	}
 	if !c.fakeDiff {
 		inturn := schedule[number] == validator
 		if inturn && header.Difficulty.Cmp(diffInTurn) != 0 {
@@ -497,6 +909,26 @@ func (c *Oasys) verifySeal(chain consensus.ChainHeaderReader, header *types.Head
 	return nil
 }
 
+// verifyRecents enforces the signer diversity rule from its fork block on, i.e.
+// that the validator of an out-of-turn header didn't seal any of the last
+// len(active)/2+1 blocks. In-turn headers are never subject to it, as the weighted schedule may
+// legitimately pick the same validator for consecutive blocks.
+func (c *Oasys) verifyRecents(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header,
+	validator common.Address, active int) error {
+	if !c.config.IsSignerDiversity(header.Number) {
+		return nil
+	}
+	number := header.Number.Uint64()
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	if snap.recentlySigned(validator, number, active) {
+		return errRecentlySigned
+	}
+	return nil
+}
+
 // Prepare implements consensus.Engine, preparing all the consensus fields of the
 // header for running the transactions on top.
 func (c *Oasys) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
@@ -523,7 +955,7 @@ func (c *Oasys) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 		schedule map[uint64]common.Address
 	)
 	if number > 0 && env.IsEpoch(number) {
-		result, err := getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+		result, err := c.getNextValidators(chain, header.ParentHash, env, number, nil)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "Prepare", "hash", header.ParentHash, "number", number, "err", err)
 			return err
@@ -531,19 +963,31 @@ func (c *Oasys) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 
 		newValidators := result.Copy().Operators
 		sort.Sort(validatorsAscending(newValidators))
-		for _, validator := range newValidators {
-			header.Extra = append(header.Extra, validator[:]...)
+		embedded, err := c.encodeValidators(chain, header, nil, newValidators)
+		if err != nil {
+			return err
+		}
+		header.Extra = append(header.Extra, embedded...)
+		if c.config.IsValidatorRoot(header.Number) {
+			copy(header.Extra[:extraVanity], validatorMerkleRoot(newValidators).Bytes())
 		}
 
-		backoff = c.backOffTime(chain, result, env, number, c.signer)
-		schedule = c.getValidatorSchedule(chain, result, env, number)
-	} else {
+		if c.sealedByIncoming(env, number) {
+			backoff = c.backOffTime(chain, result, env, number, c.signer)
+			if schedule, err = c.getValidatorSchedule(chain, result, env, number); err != nil {
+				return err
+			}
+		}
+	}
+	if schedule == nil {
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
 		if err != nil {
 			return err
 		}
 		backoff = snap.backOffTime(chain, env, number, c.signer)
-		schedule = snap.getValidatorSchedule(chain, env, number)
+		if schedule, err = c.snapshotSchedule(chain, snap, env, number); err != nil {
+			return err
+		}
 	}
 
 	// Add extra seal
@@ -561,8 +1005,8 @@ func (c *Oasys) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 		return consensus.ErrUnknownAncestor
 	}
 	header.Time = parent.Time + env.BlockPeriod.Uint64() + backoff
-	if header.Time < uint64(time.Now().Unix()) {
-		header.Time = uint64(time.Now().Unix())
+	if now := uint64(c.now().Unix()); header.Time < now {
+		header.Time = now
 	}
 
 	return nil
@@ -572,6 +1016,12 @@ func (c *Oasys) Prepare(chain consensus.ChainHeaderReader, header *types.Header)
 // rewards given.
 func (c *Oasys) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs *[]*types.Transaction,
 	uncles []*types.Header, receipts *[]*types.Receipt, systemTxs *[]*types.Transaction, usedGas *uint64) error {
+	span := c.startSpan("oasys.Finalize", header)
+	defer func() {
+		span.SetAttribute(traceSystemTxs, len(*systemTxs))
+		span.End()
+	}()
+
 	if err := verifyTx(header, *txs); err != nil {
 		return err
 	}
@@ -582,14 +1032,12 @@ func (c *Oasys) Finalize(chain consensus.ChainHeaderReader, header *types.Header
 	hash := header.Hash()
 	number := header.Number.Uint64()
 
-	cx := chainContext{Chain: chain, oasys: c}
-	if number == 1 {
-		err := c.initializeSystemContracts(state, header, cx, txs, receipts, systemTxs, usedGas, false)
-		if err != nil {
-			log.Error("Failed to initialize system contracts", "in", "Finalize", "hash", hash, "number", number, "err", err)
-			return err
+	// Legacy blocks carry neither system contracts nor slashing
+	if !c.config.IsOasys(header.Number) {
+		if len(*systemTxs) > 0 {
+			return errUnexpectedSystemTx
 		}
-
+		return nil
 	}
 
 	env, err := c.environment(chain, header, nil)
@@ -602,56 +1050,62 @@ func (c *Oasys) Finalize(chain consensus.ChainHeaderReader, header *types.Header
 		nextValidators *getNextValidatorsResult
 	)
 	if env.IsEpoch(number) {
-		nextValidators, err = getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+		nextValidators, err = c.getNextValidators(chain, header.ParentHash, env, number, nil)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "Finalize", "hash", header.ParentHash, "number", number, "err", err)
 			return err
 		}
-		schedule = c.getValidatorSchedule(chain, nextValidators, env, number)
+		c.queueValidatorMetrics(chain, header, env, nextValidators)
+		if schedule, err = c.epochSchedule(chain, nextValidators, env, number, header.ParentHash); err != nil {
+			return err
+		}
 	} else {
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
 		if err != nil {
 			return err
 		}
-		schedule = snap.getValidatorSchedule(chain, env, number)
-	}
-
-	if env.IsEpoch(number) && env.Epoch(number) > 2 {
-		if err := c.addBalanceToStakeManager(state, header.ParentHash); err != nil {
-			log.Error("Failed to add balance to staking contract", "in", "Finalize", "hash", header.ParentHash, "number", number, "err", err)
+		if schedule, err = c.snapshotSchedule(chain, snap, env, number); err != nil {
 			return err
 		}
 	}
 
-	if number >= c.config.Epoch && header.Difficulty.Cmp(diffInTurn) != 0 {
-		if env.IsEpoch(number) {
-			// If the block is a checkpoint block, verify the validator list
-			newValidators := nextValidators.Copy().Operators
-			sort.Sort(validatorsAscending(newValidators))
-			validatorsBytes := make([]byte, len(newValidators)*common.AddressLength)
-			for i, validator := range newValidators {
-				copy(validatorsBytes[i*common.AddressLength:], validator.Bytes())
-			}
-			extraSuffix := len(header.Extra) - extraSeal
-			if !bytes.Equal(header.Extra[extraVanity:extraSuffix], validatorsBytes) {
-				return errMismatchingEpochValidators
-			}
-		}
-
-		validator, err := ecrecover(header, c.signatures)
+	// If the block is an out-of-turn checkpoint block, verify the validator list
+	if number >= c.config.Epoch && header.Difficulty.Cmp(diffInTurn) != 0 && env.IsEpoch(number) {
+		newValidators := nextValidators.Copy().Operators
+		sort.Sort(validatorsAscending(newValidators))
+		validatorsBytes, err := c.encodeValidators(chain, header, nil, newValidators)
 		if err != nil {
 			return err
 		}
-		expectedValidator := schedule[number]
-		if validator != expectedValidator {
-			if err := c.slash(expectedValidator, schedule, state, header, cx, txs, receipts, systemTxs, usedGas, false); err != nil {
-				log.Error("Failed to slash validator", "in", "Finalize", "hash", hash, "number", number, "address", expectedValidator, "err", err)
-			}
+		extraSuffix := len(header.Extra) - extraSeal
+		if !bytes.Equal(header.Extra[extraVanity:extraSuffix], validatorsBytes) {
+			return errMismatchingEpochValidators
 		}
 	}
 
+	err = c.applySystemTxs(&systemTxBlock{
+		chain:     chain,
+		header:    header,
+		state:     state,
+		cx:        chainContext{Chain: chain, oasys: c},
+		env:       env,
+		schedule:  schedule,
+		txs:       txs,
+		receipts:  receipts,
+		systemTxs: systemTxs,
+		usedGas:   usedGas,
+		in:        "Finalize",
+	})
+	if err != nil {
+		return err
+	}
+
 	if len(*systemTxs) > 0 {
-		return errors.New("must not contain system transactions")
+		return errUnexpectedSystemTx
+	}
+	if err := verifyGasUsed(*receipts, *usedGas); err != nil {
+		log.Error("Inconsistent gas accounting", "in", "Finalize", "hash", hash, "number", number, "err", err)
+		return err
 	}
 
 	return nil
@@ -667,6 +1121,13 @@ func (c *Oasys) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *t
 		receipts = make([]*types.Receipt, 0)
 	}
 
+	span := c.startSpan("oasys.FinalizeAndAssemble", header)
+	userTxs := len(txs)
+	defer func() {
+		span.SetAttribute(traceSystemTxs, len(txs)-userTxs)
+		span.End()
+	}()
+
 	if err := verifyTx(header, txs); err != nil {
 		return nil, nil, err
 	}
@@ -674,13 +1135,11 @@ func (c *Oasys) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *t
 	hash := header.Hash()
 	number := header.Number.Uint64()
 
-	cx := chainContext{Chain: chain, oasys: c}
-	if number == 1 {
-		err := c.initializeSystemContracts(state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
-		if err != nil {
-			log.Error("Failed to initialize system contracts", "in", "FinalizeAndAssemble", "hash", hash, "err", err)
-			return nil, nil, err
-		}
+	// Legacy blocks carry neither system contracts nor slashing
+	if !c.config.IsOasys(header.Number) {
+		header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+		header.UncleHash = types.CalcUncleHash(nil)
+		return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), receipts, nil
 	}
 
 	env, err := c.environment(chain, header, nil)
@@ -690,36 +1149,45 @@ func (c *Oasys) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *t
 
 	var schedule map[uint64]common.Address
 	if env.IsEpoch(number) {
-		nextValidators, err := getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+		nextValidators, err := c.getNextValidators(chain, header.ParentHash, env, number, nil)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "FinalizeAndAssemble", "hash", header.ParentHash, "number", number, "err", err)
 			return nil, nil, err
 		}
-		schedule = c.getValidatorSchedule(chain, nextValidators, env, number)
+		if schedule, err = c.epochSchedule(chain, nextValidators, env, number, header.ParentHash); err != nil {
+			return nil, nil, err
+		}
 	} else {
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
 		if err != nil {
 			return nil, nil, err
 		}
-		schedule = snap.getValidatorSchedule(chain, env, number)
-	}
-
-	if env.IsEpoch(number) && env.Epoch(number) > 2 {
-		if err := c.addBalanceToStakeManager(state, header.ParentHash); err != nil {
-			log.Error("Failed to add balance to staking contract", "in", "FinalizeAndAssemble", "hash", hash, "number", number, "err", err)
+		if schedule, err = c.snapshotSchedule(chain, snap, env, number); err != nil {
 			return nil, nil, err
 		}
 	}
 
-	if number >= c.config.Epoch && header.Difficulty.Cmp(diffInTurn) != 0 {
-		expectedValidator := schedule[number]
-		if header.Coinbase != expectedValidator {
-			if err := c.slash(expectedValidator, schedule, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true); err != nil {
-				log.Error("Failed to slash validator", "in", "FinalizeAndAssemble", "hash", hash, "number", number, "address", expectedValidator, "err", err)
-			}
-		}
+	err = c.applySystemTxs(&systemTxBlock{
+		chain:    chain,
+		header:   header,
+		state:    state,
+		cx:       chainContext{Chain: chain, oasys: c},
+		env:      env,
+		schedule: schedule,
+		txs:      &txs,
+		receipts: &receipts,
+		usedGas:  &header.GasUsed,
+		mining:   true,
+		in:       "FinalizeAndAssemble",
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
+	if err := verifyGasUsed(receipts, header.GasUsed); err != nil {
+		log.Error("Inconsistent gas accounting", "in", "FinalizeAndAssemble", "hash", hash, "number", number, "err", err)
+		return nil, nil, err
+	}
 	if header.GasLimit < header.GasUsed {
 		return nil, nil, errors.New("gas consumption of system txs exceed the gas limit")
 	}
@@ -740,11 +1208,125 @@ func (c *Oasys) Authorize(signer common.Address, signFn SignerFn, txSignFn TxSig
 	c.txSignFn = txSignFn
 }
 
+// CheckAuthorization warns if the authorized signer isn't among the validators
+// active at the given header, as peers would reject any block it seals until it
+// joins the set, returning whether it is.
+func (c *Oasys) CheckAuthorization(chain consensus.ChainHeaderReader, header *types.Header) bool {
+	c.lock.RLock()
+	signer := c.signer
+	c.lock.RUnlock()
+
+	snap, err := c.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		log.Warn("Failed to check the authorized signer", "signer", signer, "number", header.Number, "err", err)
+		return false
+	}
+	if _, ok := snap.Validators[signer]; !ok {
+		log.Warn("Authorized signer is not an active validator, sealed blocks will be rejected", "signer", signer,
+			"number", header.Number, "validators", len(snap.Validators))
+		return false
+	}
+	return true
+}
+
+// SetNonceProvider overrides how the nonce of the system transaction sender is
+// retrieved. By default it is read from the state database.
+func (c *Oasys) SetNonceProvider(nonces NonceProvider) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nonces = nonces
+}
+
+// SetPeerCounter sets the function counting the connected peers of the node,
+// checked against the configured minimum before sealing.
+func (c *Oasys) SetPeerCounter(peers func() int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.peers = peers
+}
+
+// SetSyncStatus sets the function reporting whether the node caught up with the
+// network, the liveness monitor being idle until it does.
+func (c *Oasys) SetSyncStatus(synced func() bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.synced = synced
+}
+
+// SetSelectionFilter sets the function called with the operator of every
+// validator selected, dropping those it returns false for from this node's
+// notion of the active set. It's a local option for fork analysis and not a
+// consensus rule: a node filtering validators computes a different schedule than
+// the rest of the network and will diverge from it. The snapshots, and so the
+// reward recipients checked against them, aren't filtered.
+func (c *Oasys) SetSelectionFilter(filter func(common.Address) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.selectionFilter = filter
+}
+
+// SetFallbackBackends sets the backends to read the system contracts from when
+// the primary one fails, tried in order. It must be called before the engine is
+// used.
+func (c *Oasys) SetFallbackBackends(backends ...blockchainAPI) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if primary, ok := c.ethAPI.(fallbackBlockchainAPI); ok {
+		c.ethAPI = primary[0]
+	}
+	if len(backends) > 0 {
+		c.ethAPI = append(fallbackBlockchainAPI{c.ethAPI}, backends...)
+	}
+}
+
+// SetTunable changes a setting of the engine which doesn't affect consensus,
+// taking effect from the next read. Consensus-critical fields are refused.
+func (c *Oasys) SetTunable(name string, value uint64) error {
+	if err := c.tunables.set(name, value); err != nil {
+		return err
+	}
+	log.Info("Changed engine tunable", "name", name, "value", value)
+	return nil
+}
+
+// SetSlashingPaused suspends or resumes slashing. While paused, validators who
+// missed their turn are not slashed, which must be coordinated network-wide as
+// the slash system transactions are part of consensus.
+func (c *Oasys) SetSlashingPaused(paused bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.slashingPaused = paused
+}
+
+// SlashingPaused reports whether slashing is suspended.
+func (c *Oasys) SlashingPaused() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.slashingPaused
+}
+
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (c *Oasys) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
 	header := block.Header()
 
+	span := c.startSpan("oasys.Seal", header)
+	defer span.End()
+	systemTxs := 0
+	for _, tx := range block.Transactions() {
+		if isSystemTx, _ := c.IsSystemTransaction(tx, header); isSystemTx {
+			systemTxs++
+		}
+	}
+	span.SetAttribute(traceSystemTxs, systemTxs)
+
 	// Sealing the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -756,46 +1338,72 @@ func (c *Oasys) Seal(chain consensus.ChainHeaderReader, block *types.Block, resu
 	}
 	// Don't hold the signer fields for the entire sealing procedure
 	c.lock.RLock()
-	validator, signFn := c.signer, c.signFn
+	validator, signFn, peers := c.signer, c.signFn, c.peers
 	c.lock.RUnlock()
 
+	// Don't seal in isolation, the block would be lost with the partition
+	if c.config.MinSealPeers > 0 && peers != nil {
+		if count := peers(); uint64(count) < c.config.MinSealPeers {
+			log.Warn("Not enough peers to seal", "number", number, "peers", count, "min", c.config.MinSealPeers)
+			return errInsufficientPeers
+		}
+	}
+
 	env, err := c.environment(chain, header, nil)
 	if err != nil {
 		return err
 	}
 
 	// Bail out if we're unauthorized to sign a block
-	var exists bool
-	if number > 0 && env.IsEpoch(number) {
-		result, err := getNextValidators(c.ethAPI, header.ParentHash, env.Epoch(number))
+	var (
+		exists bool
+		active int
+	)
+	if number > 0 && c.sealedByIncoming(env, number) {
+		result, err := c.getNextValidators(chain, header.ParentHash, env, number, nil)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "Seal", "hash", header.ParentHash, "number", number, "err", err)
 			return err
 		}
 		exists = result.Exists(validator)
+		active = len(result.Operators)
 	} else {
 		snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
 		if err != nil {
 			return err
 		}
 		exists = snap.exists(validator)
+		active = len(snap.Validators)
 	}
 
 	if !exists {
 		return errUnauthorizedValidator
 	}
+	// If we're amongst the recent signers, wait for the others to seal
+	if header.Difficulty.Cmp(diffInTurn) != 0 {
+		if err := c.verifyRecents(chain, header, nil, validator, active); err == errRecentlySigned {
+			log.Info("Signed recently, must wait for others")
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 
 	// Sweet, the protocol permits us to sign the block, wait for our time
 	delay := time.Until(time.Unix(int64(header.Time), 0))
 	// Sign all the things!
-	sighash, err := signFn(accounts.Account{Address: validator}, accounts.MimetypeOasys, OasysRLP(header))
+	scheme, err := sealSchemeAt(c.config, number)
+	if err != nil {
+		return err
+	}
+	sighash, err := scheme.Sign(signFn, validator, header, sealChainID(c.config, header.Number))
 	if err != nil {
 		return err
 	}
 	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
 	// Wait until sealing is terminated or delay timeout.
 	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
-	go func() {
+	goWithLabel("oasys-seal", func() {
 		select {
 		case <-stop:
 			return
@@ -805,9 +1413,9 @@ func (c *Oasys) Seal(chain consensus.ChainHeaderReader, block *types.Block, resu
 		select {
 		case results <- block.WithSeal(header):
 		default:
-			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
+			log.Warn("Sealing result is not read by miner", "sealhash", c.SealHash(header))
 		}
-	}()
+	})
 
 	return nil
 }
@@ -815,6 +1423,10 @@ func (c *Oasys) Seal(chain consensus.ChainHeaderReader, block *types.Block, resu
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have:
 func (c *Oasys) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	// Legacy blocks are always sealed in-turn
+	if !c.config.IsOasys(new(big.Int).Add(parent.Number, common.Big1)) {
+		return new(big.Int).Set(diffInTurn)
+	}
 	number := parent.Number.Uint64()
 
 	env, err := c.environment(chain, parent, nil)
@@ -824,18 +1436,22 @@ func (c *Oasys) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, p
 
 	var schedule map[uint64]common.Address
 	if env.IsEpoch(number) {
-		result, err := getNextValidators(c.ethAPI, parent.Hash(), env.Epoch(number))
+		result, err := c.getNextValidators(chain, parent.Hash(), env, number, nil)
 		if err != nil {
 			log.Error("Failed to get validators", "in", "Seal", "hash", parent.Hash(), "number", number, "err", err)
 			return nil
 		}
-		schedule = c.getValidatorSchedule(chain, result, env, number)
+		if schedule, err = c.epochSchedule(chain, result, env, number, parent.ParentHash); err != nil {
+			return nil
+		}
 	} else {
 		snap, err := c.snapshot(chain, number, parent.Hash(), nil)
 		if err != nil {
 			return nil
 		}
-		schedule = snap.getValidatorSchedule(chain, env, number)
+		if schedule, err = c.snapshotSchedule(chain, snap, env, number); err != nil {
+			return nil
+		}
 	}
 
 	if schedule[number] == c.signer {
@@ -846,11 +1462,13 @@ func (c *Oasys) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, p
 
 // SealHash returns the hash of a block prior to it being sealed.
 func (c *Oasys) SealHash(header *types.Header) common.Hash {
-	return SealHash(header)
+	return sealHash(header, sealChainID(c.config, header.Number))
 }
 
 // Close implements consensus.Engine. It's a noop for oasys as there are no background threads.
 func (c *Oasys) Close() error {
+	c.liveness.stop()
+	c.metrics.stop()
 	return nil
 }
 
@@ -865,10 +1483,17 @@ func (c *Oasys) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 	}}
 }
 
-// SealHash returns the hash of a block prior to it being sealed.
-func SealHash(header *types.Header) (hash common.Hash) {
+// SealHash returns the hash of a block prior to it being sealed, committing to
+// the chain ID of the config from the chain ID seal fork on.
+func SealHash(header *types.Header, config *params.OasysConfig) common.Hash {
+	return sealHash(header, sealChainID(config, header.Number))
+}
+
+// sealHash returns the hash of a block prior to it being sealed, committing to
+// the chain ID unless nil.
+func sealHash(header *types.Header, chainID *big.Int) (hash common.Hash) {
 	hasher := sha3.NewLegacyKeccak256()
-	encodeSigHeader(hasher, header)
+	encodeSigHeader(hasher, header, chainID)
 	hasher.(crypto.KeccakState).Read(hash[:])
 	return hash
 }
@@ -880,13 +1505,51 @@ func SealHash(header *types.Header) (hash common.Hash) {
 // Note, the method requires the extra data to be at least 65 bytes, otherwise it
 // panics. This is done to avoid accidentally using both forms (signature present
 // or not), which could be abused to produce different hashes for the same header.
-func OasysRLP(header *types.Header) []byte {
+// From the chain ID seal fork on, the chain ID of the config is prepended.
+func OasysRLP(header *types.Header, config *params.OasysConfig) []byte {
+	return sealRLP(header, sealChainID(config, header.Number))
+}
+
+// DecodeOasysRLP decodes the rlp bytes signed for the proof-of-stake sealing of
+// a header, returning the header along with the chain ID they commit to, nil
+// if none. The extra data of the header is left without its seal.
+func DecodeOasysRLP(data []byte) (*types.Header, *big.Int, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err == nil {
+		return header, nil, nil
+	}
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(data, &fields); err != nil {
+		return nil, nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil, errors.New("empty oasys header")
+	}
+	chainID := new(big.Int)
+	if err := rlp.DecodeBytes(fields[0], chainID); err != nil {
+		return nil, nil, err
+	}
+	rest, err := rlp.EncodeToBytes(fields[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := rlp.DecodeBytes(rest, header); err != nil {
+		return nil, nil, err
+	}
+	return header, chainID, nil
+}
+
+// sealRLP returns the rlp bytes which needs to be signed for the proof-of-stake
+// sealing, committing to the chain ID unless nil.
+func sealRLP(header *types.Header, chainID *big.Int) []byte {
 	b := new(bytes.Buffer)
-	encodeSigHeader(b, header)
+	encodeSigHeader(b, header, chainID)
 	return b.Bytes()
 }
 
-func encodeSigHeader(w io.Writer, header *types.Header) {
+// encodeSigHeader writes the header apart from its seal, prefixed by the chain
+// ID unless nil.
+func encodeSigHeader(w io.Writer, header *types.Header, chainID *big.Int) {
 	enc := []interface{}{
 		header.ParentHash,
 		header.UncleHash,
@@ -907,13 +1570,17 @@ func encodeSigHeader(w io.Writer, header *types.Header) {
 	if header.BaseFee != nil {
 		enc = append(enc, header.BaseFee)
 	}
+	if chainID != nil {
+		enc = append([]interface{}{chainID}, enc...)
+	}
 	if err := rlp.Encode(w, enc); err != nil {
 		panic("can't encode: " + err.Error())
 	}
 }
 
-func (c *Oasys) addBalanceToStakeManager(state *state.StateDB, hash common.Hash) error {
+func (c *Oasys) addBalanceToStakeManager(chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header) error {
 	var (
+		hash    = header.ParentHash
 		rewards *big.Int
 		err     error
 	)
@@ -928,11 +1595,167 @@ func (c *Oasys) addBalanceToStakeManager(state *state.StateDB, hash common.Hash)
 
 	state.AddBalance(stakeManager.address, rewards)
 	log.Info("Balance added to stake manager", "hash", hash, "amount", rewards.String())
+
+	c.reportRewardRecipients(chain, header)
+	return nil
+}
+
+// reportRewardRecipients reports the rewards paid outside of the validators
+// committed for the epoch just ended. The StakeManager pays every staked and
+// unjailed validator, knowing neither the standbys nor the deferred set changes,
+// so the mismatches are only logged and counted rather than failing the block.
+func (c *Oasys) reportRewardRecipients(chain consensus.ChainHeaderReader, header *types.Header) {
+	var (
+		hash   = header.ParentHash
+		number = header.Number.Uint64()
+	)
+	snap, err := c.snapshot(chain, number-1, hash, nil)
+	if err != nil {
+		log.Debug("Failed to get snapshot for reward recipients", "hash", hash, "number", number, "err", err)
+		return
+	}
+	candidates, err := getNextValidatorsPaged(c.ethAPI, hash, snap.Environment.Epoch(number-1), validatorThreshold(c.config, snap.Environment, number), c.tunables.pageSize())
+	if err != nil {
+		log.Debug("Failed to get candidates for reward recipients", "hash", hash, "number", number, "err", err)
+		return
+	}
+	candidates = withUniqueOperators(c.config, number, candidates)
+	if err := verifyRewardRecipients(c.ethAPI, hash, snap.committedValidators(candidates).Owners); err != nil {
+		if errors.Is(err, errRewardRecipient) {
+			rewardOutsidersCounter.Inc(1)
+			log.Warn("Rewards paid outside of the active validators", "hash", hash, "number", number, "err", err)
+		} else {
+			log.Debug("Failed to check reward recipients", "hash", hash, "number", number, "err", err)
+		}
+	}
+}
+
+// getNextValidators retrieves the validator set committed at the given epoch
+// block, on top of the parent snapshot if set changes may be deferred.
+func (c *Oasys) getNextValidators(chain consensus.ChainHeaderReader, hash common.Hash, env *environmentValue, number uint64, parents []*types.Header) (*getNextValidatorsResult, error) {
+	result, err := getNextValidatorsPaged(c.ethAPI, hash, env.Epoch(number), validatorThreshold(c.config, env, number), c.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	if result, err = withAllowlist(c.ethAPI, c.config, number, hash, withUniqueOperators(c.config, number, result)); err != nil {
+		return nil, err
+	}
+	selected := selectValidators(c.config, number, result)
+	if !deferringSetChanges(c.config, number) {
+		return c.withSelectionFilter(selected), nil
+	}
+	snap, err := c.snapshot(chain, number-1, hash, parents)
+	if err != nil {
+		return nil, err
+	}
+	return c.withSelectionFilter(snap.commitSet(number, env.Epoch(number), result, selected).validators), nil
+}
+
+// getStandbyValidators retrieves the candidates of the given epoch standing by
+// beyond the maximum number of validators, ordered by promotion rank.
+func (c *Oasys) getStandbyValidators(hash common.Hash, env *environmentValue, number uint64) (*getNextValidatorsResult, error) {
+	result, err := getNextValidatorsPaged(c.ethAPI, hash, env.Epoch(number), validatorThreshold(c.config, env, number), c.tunables.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	if result, err = withAllowlist(c.ethAPI, c.config, number, hash, withUniqueOperators(c.config, number, result)); err != nil {
+		return nil, err
+	}
+	_, standbys := splitStandbys(c.config, number, withBootstrapValidators(c.config, result))
+	return standbys, nil
+}
+
+func (c *Oasys) getValidatorSchedule(chain consensus.ChainHeaderReader, result *getNextValidatorsResult, env *environmentValue, number uint64) (map[uint64]common.Address, error) {
+	if c.fakeSchedule != nil {
+		return c.fakeSchedule, nil
+	}
+	schedule := getValidatorSchedule(chain, c.config, result.Operators, result.Stakes, env, number)
+	if err := verifyScheduleSpan(schedule, env, number); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// snapshotSchedule returns the validator schedule of the snapshot's validators.
+func (c *Oasys) snapshotSchedule(chain consensus.ChainHeaderReader, snap *Snapshot, env *environmentValue, number uint64) (map[uint64]common.Address, error) {
+	if c.fakeSchedule != nil {
+		return c.fakeSchedule, nil
+	}
+	schedule := snap.getValidatorSchedule(chain, env, number)
+	if err := verifyScheduleSpan(schedule, env, number); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// sealedByIncoming reports whether the given epoch block is sealed by the
+// validators it commits to. An epoch block ends the previous epoch as much as it
+// starts the next, so from the boundary signer fork on, its in-turn validator and
+// backoffs are determined by the outgoing validators of the parent snapshot.
+func (c *Oasys) sealedByIncoming(env *environmentValue, number uint64) bool {
+	return env.IsEpoch(number) && !c.config.IsBoundarySigner(new(big.Int).SetUint64(number))
+}
+
+// epochSchedule returns the validator schedule of the epoch starting at the given
+// epoch block, with the epoch block itself assigned by the outgoing validators
+// from the boundary signer fork on.
+func (c *Oasys) epochSchedule(chain consensus.ChainHeaderReader, result *getNextValidatorsResult, env *environmentValue, number uint64, parent common.Hash) (map[uint64]common.Address, error) {
+	schedule, err := c.getValidatorSchedule(chain, result, env, number)
+	if err != nil || number == 0 || c.fakeSchedule != nil || c.sealedByIncoming(env, number) {
+		return schedule, err
+	}
+	snap, err := c.snapshot(chain, number-1, parent, nil)
+	if err != nil {
+		return nil, err
+	}
+	outgoing, err := c.snapshotSchedule(chain, snap, env, number)
+	if err != nil {
+		return nil, err
+	}
+	boundary := make(map[uint64]common.Address, len(schedule))
+	for n, validator := range schedule {
+		boundary[n] = validator
+	}
+	boundary[number] = outgoing[number]
+	return boundary, nil
+}
+
+// verifyScheduleSpan checks that the schedule assigns exactly the blocks of the
+// epoch the given block belongs to, leaving none unassigned.
+func verifyScheduleSpan(schedule map[uint64]common.Address, env *environmentValue, number uint64) error {
+	start, period := env.GetFirstBlock(number), env.EpochPeriod.Uint64()
+	if uint64(len(schedule)) != period {
+		return fmt.Errorf("%w: %d blocks scheduled, epoch of %d from block %d", errScheduleSpan, len(schedule), period, start)
+	}
+	for block := start; block < start+period; block++ {
+		if _, ok := schedule[block]; !ok {
+			return fmt.Errorf("%w: block %d unassigned, epoch of %d from block %d", errScheduleSpan, block, period, start)
+		}
+	}
 	return nil
 }
 
-func (c *Oasys) getValidatorSchedule(chain consensus.ChainHeaderReader, result *getNextValidatorsResult, env *environmentValue, number uint64) map[uint64]common.Address {
-	return getValidatorSchedule(chain, result.Operators, result.Stakes, env, number)
+// scheduleAt returns the validator schedule of the epoch the given header
+// belongs to.
+func (c *Oasys) scheduleAt(chain consensus.ChainHeaderReader, header *types.Header) (map[uint64]common.Address, error) {
+	number := header.Number.Uint64()
+	env, err := c.environment(chain, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	if number > 0 && env.IsEpoch(number) {
+		result, err := c.getNextValidators(chain, header.ParentHash, env, number, nil)
+		if err != nil {
+			log.Error("Failed to get validators", "in", "scheduleAt", "hash", header.ParentHash, "number", number, "err", err)
+			return nil, err
+		}
+		return c.epochSchedule(chain, result, env, number, header.ParentHash)
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.snapshotSchedule(chain, snap, env, number)
 }
 
 func (c *Oasys) backOffTime(chain consensus.ChainHeaderReader, result *getNextValidatorsResult,
@@ -940,12 +1763,13 @@ func (c *Oasys) backOffTime(chain consensus.ChainHeaderReader, result *getNextVa
 	if !result.Exists(validator) {
 		return 0
 	}
-	return backOffTime(chain, result.Operators, result.Stakes, env, number, validator)
+	return jitteredBackoff(chain, c.config, result.Operators, result.Stakes, env, number, validator)
 }
 
 func (c *Oasys) environment(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) (*environmentValue, error) {
 	number := header.Number.Uint64()
 	if number < c.config.Epoch {
+		c.environments.hit()
 		return getInitialEnvironment(c.config), nil
 	}
 
@@ -955,17 +1779,49 @@ func (c *Oasys) environment(chain consensus.ChainHeaderReader, header *types.Hea
 	}
 
 	if number%snap.Environment.EpochPeriod.Uint64() == 0 {
+		c.environments.miss()
 		nextEnv, err := getNextEnvironmentValue(c.ethAPI, header.ParentHash)
 		if err != nil {
 			log.Error("Failed to get environment value", "in", "environment", "hash", header.ParentHash, "number", number, "err", err)
 			return nil, err
 		}
-		return nextEnv, nil
+		return activeEnvironment(snap.Environment, nextEnv, number), nil
 	}
-
+	c.environments.hit()
 	return snap.Environment, nil
 }
 
+// goWithLabel runs fn in a new goroutine carrying the given pprof label, so the
+// consensus goroutines can be told apart in profiles.
+func goWithLabel(name string, fn func()) {
+	go pprof.Do(context.Background(), pprof.Labels("consensus", name), func(context.Context) {
+		fn()
+	})
+}
+
+// verifyFutureTime checks the timestamp of the header against the local clock.
+// Headers from the near future are reported with consensus.ErrFutureBlock to be
+// queued until their time, unless they are further ahead than the configured
+// tolerance.
+func verifyFutureTime(config *params.OasysConfig, header *types.Header, now time.Time) error {
+	if header.Time <= uint64(now.Unix()) {
+		return nil
+	}
+	if config.FutureBlockTolerance > 0 && header.Time > uint64(now.Unix())+config.FutureBlockTolerance {
+		return errFutureBlock
+	}
+	return consensus.ErrFutureBlock
+}
+
+// verifyDifficulty checks that the difficulty of the header is exactly either
+// the in-turn or the out-of-turn one.
+func verifyDifficulty(header *types.Header) error {
+	if header.Difficulty == nil || (header.Difficulty.Cmp(diffInTurn) != 0 && header.Difficulty.Cmp(diffNoTurn) != 0) {
+		return errInvalidDifficulty
+	}
+	return nil
+}
+
 // Oasys transaction verification
 func verifyTx(header *types.Header, txs []*types.Transaction) error {
 	for _, tx := range txs {
@@ -976,6 +1832,19 @@ func verifyTx(header *types.Header, txs []*types.Transaction) error {
 	return nil
 }
 
+// verifyGasUsed checks that the gas used by the user and system transactions of
+// a block adds up to the accumulated usedGas.
+func verifyGasUsed(receipts []*types.Receipt, usedGas uint64) error {
+	var sum uint64
+	for _, receipt := range receipts {
+		sum += receipt.GasUsed
+	}
+	if sum != usedGas {
+		return fmt.Errorf("%w: receipts %d, used %d", errGasUsedMismatch, sum, usedGas)
+	}
+	return nil
+}
+
 type validatorAndValue struct {
 	validator common.Address
 	value     *big.Int
@@ -1008,15 +1877,18 @@ func sortValidatorsAndValues(validators []common.Address, values []*big.Int) ([]
 	return rvalidators, rvalues
 }
 
+// weightedRandomChooser picks validators with a probability proportional to
+// their stake in whole tokens. Cumulative weights are kept as big integers, so
+// that total stakes beyond the native integer range can't overflow.
 type weightedRandomChooser struct {
 	random     *rand.Rand
 	validators []common.Address
-	totals     []int
-	max        int
+	totals     []*big.Int
+	max        *big.Int
 }
 
 func (c *weightedRandomChooser) choice() common.Address {
-	if (c.max) == 0 {
+	if c.max.Sign() == 0 {
 		i := rand.Intn(len(c.validators))
 		return c.validators[i]
 	}
@@ -1027,7 +1899,7 @@ func (c *weightedRandomChooser) choice() common.Address {
 
 	for i < j {
 		h := (i + j) >> 1
-		if c.totals[h] < x {
+		if c.totals[h].Cmp(x) < 0 {
 			i = h + 1
 		} else {
 			j = h
@@ -1037,11 +1909,17 @@ func (c *weightedRandomChooser) choice() common.Address {
 	return c.validators[i]
 }
 
-func (c *weightedRandomChooser) randInt() int {
-	if (c.max) == 0 {
-		return 0
+// randInt draws a weight between one and the total. Totals within the native
+// integer range are drawn as they always were, keeping the schedules unchanged.
+func (c *weightedRandomChooser) randInt() *big.Int {
+	if c.max.Sign() == 0 {
+		return new(big.Int)
+	}
+	if c.max.IsInt64() {
+		return big.NewInt(int64(c.random.Intn(int(c.max.Int64())) + 1))
 	}
-	return c.random.Intn(c.max) + 1
+	x := new(big.Int).Rand(c.random, c.max)
+	return x.Add(x, common.Big1)
 }
 
 func (c *weightedRandomChooser) skip() {
@@ -1055,32 +1933,36 @@ func newWeightedRandomChooser(
 	env *environmentValue,
 	number uint64,
 ) *weightedRandomChooser {
-	start := env.GetFirstBlock(number)
-	seed := int64(start)
-	if start > 0 {
-		if header := chain.GetHeaderByNumber(start - 1); header != nil {
-			seed = header.Hash().Big().Int64()
-		}
-	}
-
 	validators, stakes = sortValidatorsAndValues(validators, stakes)
 	chooser := &weightedRandomChooser{
-		random:     rand.New(rand.NewSource(seed)),
+		random:     rand.New(rand.NewSource(scheduleSeed(chain, env.GetFirstBlock(number)))),
 		validators: make([]common.Address, len(validators)),
-		totals:     make([]int, len(stakes)),
-		max:        0,
+		totals:     make([]*big.Int, len(stakes)),
+		max:        new(big.Int),
 	}
 	for i, validator := range validators {
 		chooser.validators[i] = validator
-		chooser.max += int(new(big.Int).Div(stakes[i], ether).Int64())
-		chooser.totals[i] = chooser.max
+		chooser.max.Add(chooser.max, new(big.Int).Div(stakes[i], ether))
+		chooser.totals[i] = new(big.Int).Set(chooser.max)
 	}
 	return chooser
 }
 
-func getValidatorSchedule(chain consensus.ChainHeaderReader, validators []common.Address, stakes []*big.Int, env *environmentValue, number uint64) map[uint64]common.Address {
+// scheduleSeed returns the seed of the validator schedule of the epoch starting
+// at the given block, derived from the hash of the block before it.
+func scheduleSeed(chain consensus.ChainHeaderReader, start uint64) int64 {
+	seed := int64(start)
+	if start > 0 {
+		if header := chain.GetHeaderByNumber(start - 1); header != nil {
+			seed = header.Hash().Big().Int64()
+		}
+	}
+	return seed
+}
+
+func getValidatorSchedule(chain consensus.ChainHeaderReader, config *params.OasysConfig, validators []common.Address, stakes []*big.Int, env *environmentValue, number uint64) map[uint64]common.Address {
 	start := env.GetFirstBlock(number)
-	chooser := newWeightedRandomChooser(chain, validators, stakes, env, number)
+	chooser := newScheduleChooser(chain, config, validators, stakes, env, number)
 	epochPeriod := env.EpochPeriod.Uint64()
 	ret := make(map[uint64]common.Address)
 	for i := uint64(0); i < epochPeriod; i++ {
@@ -1089,9 +1971,9 @@ func getValidatorSchedule(chain consensus.ChainHeaderReader, validators []common
 	return ret
 }
 
-func backOffTime(chain consensus.ChainHeaderReader, validators []common.Address, stakes []*big.Int, env *environmentValue, number uint64, validator common.Address) uint64 {
+func backOffTime(chain consensus.ChainHeaderReader, config *params.OasysConfig, validators []common.Address, stakes []*big.Int, env *environmentValue, number uint64, validator common.Address) uint64 {
 	start := env.GetFirstBlock(number)
-	chooser := newWeightedRandomChooser(chain, validators, stakes, env, number)
+	chooser := newScheduleChooser(chain, config, validators, stakes, env, number)
 	for i := number - start; i > 0; i-- {
 		chooser.skip()
 	}
@@ -1115,3 +1997,97 @@ func backOffTime(chain consensus.ChainHeaderReader, validators []common.Address,
 	}
 	return uint64(turn) + backoffWiggleTime
 }
+
+// backoffJittered reports whether the out-of-turn backoffs of the given block are
+// jittered.
+func backoffJittered(config *params.OasysConfig, number uint64) bool {
+	return config.BackoffJitter > 0 && config.IsBackoffJitter(new(big.Int).SetUint64(number))
+}
+
+// withBackoffJitter adds a jitter of up to the configured number of seconds to an
+// out-of-turn backoff from the jitter fork on. The jitter is derived from the
+// validator and the block number, so that the verifying nodes compute the same
+// one.
+func withBackoffJitter(config *params.OasysConfig, backoff, number uint64, validator common.Address) uint64 {
+	if backoff == 0 || !backoffJittered(config, number) {
+		return backoff
+	}
+	seed := crypto.Keccak256(validator.Bytes(), new(big.Int).SetUint64(number).Bytes())
+	return backoff + new(big.Int).SetBytes(seed).Uint64()%(config.BackoffJitter+1)
+}
+
+// jitteredBackoff returns the out-of-turn backoff of the validator with the
+// configured jitter. From the tie-break fork on, colliding backoffs are spread
+// out so that no two validators may seal the block at the same time.
+func jitteredBackoff(chain consensus.ChainHeaderReader, config *params.OasysConfig, validators []common.Address, stakes []*big.Int,
+	env *environmentValue, number uint64, validator common.Address) uint64 {
+	if backoffJittered(config, number) && config.IsBackoffTieBreak(new(big.Int).SetUint64(number)) {
+		return tieBrokenBackoff(config, backoffOrder(chain, config, validators, stakes, env, number), number, validator)
+	}
+	backoff := backOffTime(chain, config, validators, stakes, env, number, validator)
+	return withBackoffJitter(config, backoff, number, validator)
+}
+
+// backoffOrder returns the validators in the order they're allowed to seal the
+// given block, the in-turn validator first, as ranked by backOffTime. This is the
+// fallback chain of the block: each validator backs off a second longer than the
+// previous one, so that the block is sealed by the first one up.
+func backoffOrder(chain consensus.ChainHeaderReader, config *params.OasysConfig, validators []common.Address, stakes []*big.Int, env *environmentValue, number uint64) []common.Address {
+	start := env.GetFirstBlock(number)
+	chooser := newScheduleChooser(chain, config, validators, stakes, env, number)
+	for i := number - start; i > 0; i-- {
+		chooser.skip()
+	}
+
+	order := make([]common.Address, 0, len(validators))
+	seen := make(map[common.Address]bool)
+	for len(order) < len(validators) {
+		picked := chooser.choice()
+		if seen[picked] {
+			continue
+		}
+		seen[picked] = true
+		order = append(order, picked)
+	}
+	return order
+}
+
+// tieBrokenBackoff returns the jittered backoff of the validator among the ones
+// ordered by backoffOrder. Validators whose jittered backoffs collide are ranked
+// by a key derived from their address and the block number, each moved to the
+// second after the previous one.
+func tieBrokenBackoff(config *params.OasysConfig, order []common.Address, number uint64, validator common.Address) uint64 {
+	type slot struct {
+		validator common.Address
+		backoff   uint64
+		key       []byte
+	}
+	slots := make([]slot, len(order))
+	for i, v := range order {
+		backoff := uint64(0)
+		if i > 0 {
+			backoff = uint64(i) + backoffWiggleTime
+		}
+		slots[i] = slot{
+			validator: v,
+			backoff:   withBackoffJitter(config, backoff, number, v),
+			key:       crypto.Keccak256(v.Bytes(), new(big.Int).SetUint64(number).Bytes(), []byte("tie-break")),
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].backoff != slots[j].backoff {
+			return slots[i].backoff < slots[j].backoff
+		}
+		return bytes.Compare(slots[i].key, slots[j].key) < 0
+	})
+
+	for i := range slots {
+		if i > 0 && slots[i].backoff <= slots[i-1].backoff {
+			slots[i].backoff = slots[i-1].backoff + 1
+		}
+		if slots[i].validator == validator {
+			return slots[i].backoff
+		}
+	}
+	return 0
+}
@@ -1,10 +1,24 @@
 package oasys
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
 	"math/big"
+	"reflect"
+	"runtime/pprof"
+	"sort"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 var (
@@ -141,7 +155,7 @@ func TestBackOffTime(t *testing.T) {
 	for _, tc := range testCases {
 		for i, want := range tc.want {
 			validator := validators[i]
-			backoff := backOffTime(env.chain, validators, stakes, envValue, tc.block, validator)
+			backoff := backOffTime(env.chain, &params.OasysConfig{}, validators, stakes, envValue, tc.block, validator)
 			if backoff != want {
 				t.Errorf("backoff mismatch, block %v, validator %v, got %v, want %v", tc.block, names[validator], backoff, want)
 			}
@@ -149,6 +163,151 @@ func TestBackOffTime(t *testing.T) {
 	}
 }
 
+func TestBackoffJitter(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 40}
+	if got := withBackoffJitter(config, 3, 100, validators[0]); got != 3 {
+		t.Errorf("jitter disabled, got %d, want 3", got)
+	}
+
+	// Nor before the jitter fork
+	config.BackoffJitter, config.BackoffJitterBlock = 3, big.NewInt(101)
+	if got := withBackoffJitter(config, 3, 100, validators[0]); got != 3 {
+		t.Errorf("before the fork, got %d, want 3", got)
+	}
+
+	config.BackoffJitterBlock = common.Big0
+	if got := withBackoffJitter(config, 0, 100, validators[0]); got != 0 {
+		t.Errorf("in-turn, got %d, want 0", got)
+	}
+	jitters := make(map[uint64]bool)
+	for number := uint64(100); number < 120; number++ {
+		for _, validator := range validators {
+			got := withBackoffJitter(config, 3, number, validator)
+			if got < 3 || got > 3+config.BackoffJitter {
+				t.Errorf("block %d, %s: backoff %d out of range [3, %d]", number, names[validator], got, 3+config.BackoffJitter)
+			}
+			if again := withBackoffJitter(config, 3, number, validator); again != got {
+				t.Errorf("block %d, %s: not reproducible, got %d and %d", number, names[validator], got, again)
+			}
+			jitters[got] = true
+		}
+	}
+	if len(jitters) < 2 {
+		t.Errorf("jitter doesn't vary across signers and blocks: %v", jitters)
+	}
+}
+
+func TestBoundarySigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 9)
+	chain := newTestChainReaderWithHeaders(headers)
+	incoming := make(map[common.Address]bool)
+	for _, validator := range validators {
+		incoming[validator] = true
+	}
+
+	// The test chain signer hands over to the registered validators at block 10
+	for _, fork := range []*big.Int{nil, common.Big0} {
+		config := &params.OasysConfig{Period: 0, Epoch: 10, BoundarySignerBlock: fork}
+		backend := newTestStakeManager(getInitialEnvironment(config))
+		backend.register(1, validators, stakes)
+		engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+		engine.ethAPI = backend
+
+		boundary := makeSignedTestHeader(headers[9], diffInTurn, key)
+		schedule, err := engine.scheduleAt(chain, boundary)
+		if err != nil {
+			t.Fatalf("fork %v: failed to get schedule: %v", fork, err)
+		}
+		for number := uint64(11); number < 20; number++ {
+			if !incoming[schedule[number]] {
+				t.Errorf("fork %v: block %d scheduled to %x, want an incoming validator", fork, number, schedule[number])
+			}
+		}
+		err = engine.verifySeal(chain, boundary, nil)
+		if fork == nil {
+			if !incoming[schedule[10]] {
+				t.Errorf("boundary block scheduled to %x, want an incoming validator", schedule[10])
+			}
+			if err != errUnauthorizedValidator {
+				t.Errorf("boundary block by the outgoing validator, got %v, want %v", err, errUnauthorizedValidator)
+			}
+			continue
+		}
+		if schedule[10] != signer {
+			t.Errorf("boundary block scheduled to %x, want the outgoing validator %x", schedule[10], signer)
+		}
+		if err != nil {
+			t.Errorf("boundary block by the outgoing validator, got %v, want nil", err)
+		}
+
+		// Applying the boundary block hands over to the incoming validators
+		snap, err := engine.snapshot(chain, 9, headers[9].Hash(), nil)
+		if err != nil {
+			t.Fatalf("failed to get snapshot: %v", err)
+		}
+		next, err := snap.apply([]*types.Header{boundary}, chain)
+		if err != nil {
+			t.Fatalf("failed to apply the boundary block: %v", err)
+		}
+		if next.exists(signer) || len(next.Validators) != len(validators) {
+			t.Errorf("validators after the boundary block, got %v, want %v", next.validators(), validators)
+		}
+	}
+}
+
+func TestBackoffTieBreak(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+	envValue := &environmentValue{
+		StartBlock:  common.Big0,
+		StartEpoch:  common.Big1,
+		EpochPeriod: big.NewInt(40),
+	}
+	config := &params.OasysConfig{Period: 0, Epoch: 40, BackoffJitter: 3, BackoffJitterBlock: common.Big0}
+
+	collided := 0
+	for number := uint64(100); number < 120; number++ {
+		// Count the blocks where plain jittered backoffs collide
+		naive := make(map[uint64]bool)
+		for _, validator := range validators {
+			naive[jitteredBackoff(env.chain, config, validators, stakes, envValue, number, validator)] = true
+		}
+		if len(naive) < len(validators) {
+			collided++
+		}
+
+		// Past the fork, every validator is given its own slot
+		config.BackoffTieBreakBlock = common.Big0
+		order := backoffOrder(env.chain, config, validators, stakes, envValue, number)
+		refined := make(map[uint64]common.Address)
+		for i, validator := range order {
+			backoff := jitteredBackoff(env.chain, config, validators, stakes, envValue, number, validator)
+			if other, ok := refined[backoff]; ok {
+				t.Errorf("block %d: %s and %s share backoff %d", number, names[validator], names[other], backoff)
+			}
+			refined[backoff] = validator
+
+			if want := backOffTime(env.chain, config, validators, stakes, envValue, number, validator); i == 0 && backoff != want {
+				t.Errorf("block %d: in-turn %s backoff, got %d, want %d", number, names[validator], backoff, want)
+			} else if backoff < want {
+				t.Errorf("block %d: %s backoff %d below the unjittered %d", number, names[validator], backoff, want)
+			}
+		}
+		config.BackoffTieBreakBlock = nil
+	}
+	if collided == 0 {
+		t.Fatal("no colliding backoffs to break ties of")
+	}
+}
+
 func TestGetValidatorSchedule(t *testing.T) {
 	testCases := []struct {
 		block uint64
@@ -255,10 +414,768 @@ func TestGetValidatorSchedule(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		schedule := getValidatorSchedule(env.chain, validators, stakes, envValue, tc.block)
+		schedule := getValidatorSchedule(env.chain, &params.OasysConfig{}, validators, stakes, envValue, tc.block)
 		got := names[schedule[tc.block]]
 		if got != tc.want {
 			t.Errorf("validator mismatch, block %v, got %v, want %v", tc.block, got, tc.want)
 		}
 	}
 }
+
+func TestGetValidatorScheduleLargeStakes(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chain := newTestChainReaderWithHeaders(makeSignedTestChain(key, 0))
+
+	// Stakes summing to 2^64 tokens, beyond the range of native integers
+	tokens := new(big.Int).Lsh(common.Big1, 62)
+	large := []*big.Int{
+		new(big.Int).Mul(new(big.Int).Mul(tokens, big.NewInt(3)), ether),
+		new(big.Int).Mul(tokens, ether),
+	}
+	envValue := &environmentValue{
+		StartBlock:  common.Big0,
+		StartEpoch:  common.Big1,
+		EpochPeriod: big.NewInt(1000),
+	}
+
+	schedule := getValidatorSchedule(chain, &params.OasysConfig{}, validators[:2], large, envValue, 1000)
+	counts := make(map[common.Address]int)
+	for number := uint64(1000); number < 2000; number++ {
+		counts[schedule[number]]++
+	}
+	if len(counts) != 2 {
+		t.Fatalf("scheduled validators, got %v, want both", counts)
+	}
+	// Three quarters of the blocks go to the larger stake, give or take
+	if n := counts[validators[0]]; n < 700 || n > 800 {
+		t.Errorf("blocks of the larger stake, got %d of 1000, want about 750", n)
+	}
+}
+
+func TestVerifyScheduleSpan(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chain := newTestChainReaderWithHeaders(makeSignedTestChain(key, 0))
+	envValue := &environmentValue{
+		StartBlock:  common.Big0,
+		StartEpoch:  common.Big1,
+		EpochPeriod: big.NewInt(10),
+	}
+
+	schedule := getValidatorSchedule(chain, &params.OasysConfig{}, validators, stakes, envValue, 25)
+	if err := verifyScheduleSpan(schedule, envValue, 25); err != nil {
+		t.Fatalf("built schedule, got %v", err)
+	}
+
+	// A schedule missing a block of the epoch
+	short := make(map[uint64]common.Address)
+	for number := uint64(20); number < 29; number++ {
+		short[number] = schedule[number]
+	}
+	if err := verifyScheduleSpan(short, envValue, 25); !errors.Is(err, errScheduleSpan) {
+		t.Errorf("short schedule, got %v, want %v", err, errScheduleSpan)
+	}
+	// A schedule spilling over the next epoch
+	long := make(map[uint64]common.Address)
+	for number := uint64(20); number < 31; number++ {
+		long[number] = validators[0]
+	}
+	if err := verifyScheduleSpan(long, envValue, 25); !errors.Is(err, errScheduleSpan) {
+		t.Errorf("long schedule, got %v, want %v", err, errScheduleSpan)
+	}
+	// A schedule of the right size, shifted by a block
+	shifted := make(map[uint64]common.Address)
+	for number := uint64(21); number < 31; number++ {
+		shifted[number] = validators[0]
+	}
+	if err := verifyScheduleSpan(shifted, envValue, 25); !errors.Is(err, errScheduleSpan) {
+		t.Errorf("shifted schedule, got %v, want %v", err, errScheduleSpan)
+	}
+}
+
+func TestSlashingPaused(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping multi-epoch chain in short mode")
+	}
+
+	wallets, accounts, err := makeWallets(2)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+	stake := new(big.Int).Mul(big.NewInt(10_000_000), ether)
+	env.stakeManager.register(2, []common.Address{accounts[0].Address, accounts[1].Address}, []*big.Int{stake, stake})
+
+	if err := env.generateBlocks(149, wallets, accounts); err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+
+	// Capture the would-be slashes while paused
+	var skipped []*log.Record
+	handler := log.Root().GetHandler()
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "Skipping slash while slashing is paused" {
+			skipped = append(skipped, r)
+		}
+		return nil
+	}))
+	defer log.Root().SetHandler(handler)
+
+	env.engine.SetSlashingPaused(true)
+	var block *types.Block
+	for i := range wallets {
+		if block, err = env.generateBlock(*wallets[i], *accounts[i], false); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to generate out-of-turn block: %v", err)
+	}
+	if len(block.Transactions()) != 0 {
+		t.Errorf("transactions while paused, got %v, want 0", len(block.Transactions()))
+	}
+	statedb, err := env.chain.StateAt(block.Root())
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if slashed := statedb.GetState(_stakeManagerAddress, common.HexToHash("0x01")); slashed != (common.Hash{}) {
+		t.Errorf("StakeManager.slashed while paused, got %v, want 0", slashed.Big())
+	}
+	// Both sealing and importing the block would have slashed
+	if len(skipped) != 2 {
+		t.Errorf("skipped slash logs, got %v, want 2", len(skipped))
+	}
+}
+
+func TestCheckAuthorization(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	stranger, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 2)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 1, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+
+	var warnings []*log.Record
+	handler := log.Root().GetHandler()
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "Authorized signer is not an active validator, sealed blocks will be rejected" {
+			warnings = append(warnings, r)
+		}
+		return nil
+	}))
+	defer log.Root().SetHandler(handler)
+
+	// The genesis validator is active, no warning
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), nil, nil)
+	if !engine.CheckAuthorization(chain, headers[2]) {
+		t.Error("active validator reported as unauthorized")
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings for an active validator, got %v, want 0", len(warnings))
+	}
+
+	// An address outside of the set is warned about
+	engine.Authorize(crypto.PubkeyToAddress(stranger.PublicKey), nil, nil)
+	if engine.CheckAuthorization(chain, headers[2]) {
+		t.Error("address outside of the active set reported as authorized")
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings for an address outside of the active set, got %v, want 1", len(warnings))
+	}
+}
+
+func TestVerifyReorgDepth(t *testing.T) {
+	chain := newTestChainReader(100)
+	engine := &Oasys{config: &params.OasysConfig{Epoch: 40, MaxReorgDepth: 40}}
+
+	testCases := []struct {
+		ancestor uint64
+		length   int
+		want     error
+	}{
+		{100, 1, nil},
+		{99, 1, nil},
+		{99, 5, nil},
+		{60, 1, nil},
+		{60, 50, nil},
+		{59, 1, errReorgTooDeep},
+		{59, 50, errReorgTooDeep},
+		{10, 1, errReorgTooDeep},
+	}
+	for _, tc := range testCases {
+		fork := makeTestChain(chain.canonical[tc.ancestor], tc.length, 1)
+		header, parents := fork[len(fork)-1], fork[:len(fork)-1]
+		if err := engine.verifyReorgDepth(chain, header, parents); err != tc.want {
+			t.Errorf("ancestor %d, length %d: got %v, want %v", tc.ancestor, tc.length, err, tc.want)
+		}
+	}
+
+	// Canonical headers are never rejected
+	if err := engine.verifyReorgDepth(chain, chain.canonical[10], nil); err != nil {
+		t.Errorf("canonical header rejected: %v", err)
+	}
+	// A zero limit disables the check
+	engine.config.MaxReorgDepth = 0
+	fork := makeTestChain(chain.canonical[10], 1, 1)
+	if err := engine.verifyReorgDepth(chain, fork[0], nil); err != nil {
+		t.Errorf("unlimited reorg rejected: %v", err)
+	}
+}
+
+func TestVerifySealRecentlySigned(t *testing.T) {
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 3)
+		addrs = make([]common.Address, 3)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+
+	genesis := &types.Header{Number: common.Big0, Difficulty: diffInTurn}
+	block1 := makeSignedTestHeader(genesis, diffNoTurn, keys[0])
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis, block1})
+
+	// Only the second validator has any stake, so every block is its turn
+	config := &params.OasysConfig{Period: 0, Epoch: 100, SignerDiversityBlock: common.Big0}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	snap := newSnapshot(config, engine.signatures, nil, 1, block1.Hash(), addrs, getInitialEnvironment(config))
+	snap.Validators[addrs[1]] = new(big.Int).Mul(big.NewInt(10), ether)
+	snap.Recents[1] = addrs[0]
+	engine.recents.Add(snap.Hash, snap)
+
+	// The first validator sealed block 1, so can't seal block 2 out-of-turn
+	if err := engine.verifySeal(chain, makeSignedTestHeader(block1, diffNoTurn, keys[0]), nil); err != errRecentlySigned {
+		t.Errorf("recent signer, got %v, want %v", err, errRecentlySigned)
+	}
+	if err := engine.verifySeal(chain, makeSignedTestHeader(block1, diffNoTurn, keys[2]), nil); err != nil {
+		t.Errorf("other signer, got %v, want nil", err)
+	}
+	if err := engine.verifySeal(chain, makeSignedTestHeader(block1, diffInTurn, keys[1]), nil); err != nil {
+		t.Errorf("in-turn signer, got %v, want nil", err)
+	}
+
+	// Once out of the window of 3/2+1 blocks, the validator may seal again
+	block2 := makeSignedTestHeader(block1, diffNoTurn, keys[2])
+	next, err := snap.apply([]*types.Header{block2}, chain)
+	if err != nil {
+		t.Fatalf("failed to apply block 2: %v", err)
+	}
+	if next.recentlySigned(addrs[0], 3, len(addrs)) {
+		t.Error("validator still recent out of the window")
+	}
+	if !next.recentlySigned(addrs[2], 3, len(addrs)) {
+		t.Error("validator not recent within the window")
+	}
+
+	// The rule is only enforced from the fork block on
+	engine.config.SignerDiversityBlock = big.NewInt(3)
+	if err := engine.verifySeal(chain, makeSignedTestHeader(block1, diffNoTurn, keys[0]), nil); err != nil {
+		t.Errorf("recent signer before signer diversity, got %v, want nil", err)
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	var (
+		keys   = make(map[common.Address]*ecdsa.PrivateKey)
+		addrs  = make([]common.Address, 4)
+		staked = make([]*big.Int, 4)
+	)
+	for i := range addrs {
+		key, _ := crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+		keys[addrs[i]] = key
+		staked[i] = new(big.Int).Mul(big.NewInt(int64(10_000_000*(i+1))), ether)
+	}
+
+	// The parent is timestamped ahead of the clock to keep the slot unclamped
+	genesis := &types.Header{Number: common.Big0, Difficulty: diffInTurn, Time: uint64(time.Now().Unix()) + 3600}
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis})
+
+	config := &params.OasysConfig{Period: 0, Epoch: 100}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	env := getInitialEnvironment(config)
+	snap := newSnapshot(config, engine.signatures, nil, 0, genesis.Hash(), addrs, env)
+	for i, address := range addrs {
+		snap.Validators[address] = staked[i]
+	}
+	engine.recents.Add(snap.Hash, snap)
+
+	// Each fallback of the weighted schedule backs off longer than the previous
+	validators, weights := snap.validatorsToTuple()
+	order := backoffOrder(chain, config, validators, weights, env, 1)
+	for i, validator := range order {
+		want := uint64(0)
+		if i > 0 {
+			want = uint64(i) + backoffWiggleTime
+		}
+		if backoff := snap.backOffTime(chain, env, 1, validator); backoff != want {
+			t.Errorf("fallback %d: backoff, got %d, want %d", i, backoff, want)
+		}
+	}
+
+	// With the in-turn validator and the first fallback down, the second fallback
+	// seals out-of-turn once its backoff elapsed
+	third := order[2]
+	engine.Authorize(third, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), keys[third])
+	}, nil)
+	header := &types.Header{ParentHash: genesis.Hash(), Number: common.Big1}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Difficulty.Cmp(diffNoTurn) != 0 {
+		t.Errorf("difficulty, got %v, want %v", header.Difficulty, diffNoTurn)
+	}
+	if want := genesis.Time + 2 + backoffWiggleTime; header.Time != want {
+		t.Errorf("timestamp, got %d, want %d", header.Time, want)
+	}
+
+	sealed := makeSignedTestHeader(genesis, diffNoTurn, keys[third])
+	if err := engine.verifySeal(chain, sealed, nil); err != nil {
+		t.Errorf("fallback seal, got %v, want nil", err)
+	}
+	if err := engine.verifySeal(chain, makeSignedTestHeader(genesis, diffInTurn, keys[third]), nil); err != errWrongDifficulty {
+		t.Errorf("fallback sealing in-turn, got %v, want %v", err, errWrongDifficulty)
+	}
+}
+
+func TestVerifyInvalidDifficulty(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 1)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+
+	for _, difficulty := range []*big.Int{nil, common.Big0, big.NewInt(3), new(big.Int).Neg(diffInTurn)} {
+		header := makeSignedTestHeader(headers[0], diffInTurn, key)
+		header.Difficulty = difficulty
+		sig, _ := crypto.Sign(sealHash(header, nil).Bytes(), key)
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+		if err := engine.verifyHeader(chain, header, nil); err != errInvalidDifficulty {
+			t.Errorf("difficulty %v: verifyHeader, got %v, want %v", difficulty, err, errInvalidDifficulty)
+		}
+		if err := engine.verifySeal(chain, header, nil); err != errInvalidDifficulty {
+			t.Errorf("difficulty %v: verifySeal, got %v, want %v", difficulty, err, errInvalidDifficulty)
+		}
+	}
+}
+
+func TestOasysBlock(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	stranger, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 6)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10, OasysBlock: big.NewInt(5)}, rawdb.NewMemoryDatabase(), nil)
+
+	// Legacy blocks are sealed in-turn by the genesis validators
+	if err := engine.verifyHeader(chain, makeSignedTestHeader(headers[2], big.NewInt(3), key), nil); err != errWrongDifficulty {
+		t.Errorf("legacy block with invalid difficulty, got %v, want %v", err, errWrongDifficulty)
+	}
+	if err := engine.verifyHeader(chain, makeSignedTestHeader(headers[2], diffInTurn, stranger), nil); err != errUnauthorizedValidator {
+		t.Errorf("legacy block by unknown signer, got %v, want %v", err, errUnauthorizedValidator)
+	}
+	if diff := engine.CalcDifficulty(chain, headers[2].Time+1, headers[2]); diff.Cmp(diffInTurn) != 0 {
+		t.Errorf("legacy difficulty, got %v, want %v", diff, diffInTurn)
+	}
+
+	// From the activation block on, the Oasys rules apply
+	if err := engine.verifyHeader(chain, makeSignedTestHeader(headers[5], big.NewInt(3), key), nil); err != errInvalidDifficulty {
+		t.Errorf("oasys block with invalid difficulty, got %v, want %v", err, errInvalidDifficulty)
+	}
+	if diff := engine.CalcDifficulty(chain, headers[5].Time+1, headers[5]); diff.Cmp(diffNoTurn) != 0 {
+		t.Errorf("oasys difficulty of an unscheduled signer, got %v, want %v", diff, diffNoTurn)
+	}
+	if !engine.isFirstOasysBlock(5) || engine.isFirstOasysBlock(1) {
+		t.Error("system contracts not deployed at the activation block")
+	}
+}
+
+func TestFakeSchedule(t *testing.T) {
+	key0, _ := crypto.GenerateKey()
+	key1, _ := crypto.GenerateKey()
+	validator0 := crypto.PubkeyToAddress(key0.PublicKey)
+	validator1 := crypto.PubkeyToAddress(key1.PublicKey)
+
+	genesis := &types.Header{
+		Number:     common.Big0,
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+2*common.AddressLength+extraSeal),
+	}
+	copy(genesis.Extra[extraVanity:], validator0.Bytes())
+	copy(genesis.Extra[extraVanity+common.AddressLength:], validator1.Bytes())
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis})
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.Authorize(validator1, nil, nil)
+
+	for _, scheduled := range []common.Address{validator0, validator1} {
+		engine.fakeSchedule = map[uint64]common.Address{1: scheduled}
+
+		// Sealing follows the injected schedule
+		header := &types.Header{ParentHash: genesis.Hash(), Number: common.Big1}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare header: %v", err)
+		}
+		if inturn := header.Difficulty.Cmp(diffInTurn) == 0; inturn != (scheduled == validator1) {
+			t.Errorf("scheduled %v: prepared in-turn %v, want %v", scheduled, inturn, scheduled == validator1)
+		}
+
+		// So does validation
+		for _, key := range []*ecdsa.PrivateKey{key0, key1} {
+			signer := crypto.PubkeyToAddress(key.PublicKey)
+			if err := engine.verifySeal(chain, makeSignedTestHeader(genesis, diffInTurn, key), nil); (err == nil) != (signer == scheduled) {
+				t.Errorf("scheduled %v: in-turn block by %v, got %v", scheduled, signer, err)
+			}
+			if err := engine.verifySeal(chain, makeSignedTestHeader(genesis, diffNoTurn, key), nil); (err == nil) != (signer != scheduled) {
+				t.Errorf("scheduled %v: out-of-turn block by %v, got %v", scheduled, signer, err)
+			}
+		}
+	}
+}
+
+func TestFutureBlockTolerance(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	config := &params.OasysConfig{Period: 15, Epoch: 40, FutureBlockTolerance: 30}
+
+	for _, tc := range []struct {
+		name  string
+		ahead int64
+		want  error
+	}{
+		{"past", -15, nil},
+		{"now", 0, nil},
+		{"slightly future", 10, consensus.ErrFutureBlock},
+		{"at tolerance", 30, consensus.ErrFutureBlock},
+		{"far future", 31, errFutureBlock},
+	} {
+		header := &types.Header{Number: big.NewInt(1), Time: uint64(now.Unix() + tc.ahead)}
+		if err := verifyFutureTime(config, header, now); err != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// Without tolerance, every future header is queued
+	config.FutureBlockTolerance = 0
+	header := &types.Header{Number: big.NewInt(1), Time: uint64(now.Unix() + 3600)}
+	if err := verifyFutureTime(config, header, now); err != consensus.ErrFutureBlock {
+		t.Errorf("no tolerance, got %v, want %v", err, consensus.ErrFutureBlock)
+	}
+}
+
+func TestVerifyExtraDataLength(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 9)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: crypto.PubkeyToAddress(key.PublicKey)}
+
+	// Extra-data holding a seal but no vanity is refused before the seal hash
+	for _, length := range []int{0, extraSeal, extraVanity + extraSeal - 1} {
+		header := makeSignedTestHeader(headers[0], diffInTurn, key)
+		header.Extra = header.Extra[len(header.Extra)-length:]
+		if _, err := ecrecover(engine.config, header, engine.signatures); err != errMissingSignature {
+			t.Errorf("%d bytes: ecrecover, got %v, want %v", length, err, errMissingSignature)
+		}
+	}
+	valid := makeSignedTestHeader(headers[0], diffInTurn, key)
+	if signer, err := ecrecover(engine.config, valid, engine.signatures); err != nil || signer != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("correctly sized extra-data, got %v (err %v), want %v", signer, err, crypto.PubkeyToAddress(key.PublicKey))
+	}
+
+	// Epoch blocks must carry at least one validator
+	epoch := makeSignedTestHeader(headers[9], diffInTurn, key)
+	if err := engine.verifyHeader(chain, epoch, nil); err != errExtraDataTooShort {
+		t.Errorf("epoch block without validators, got %v, want %v", err, errExtraDataTooShort)
+	}
+}
+
+func TestVerifyEpochValidatorSet(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 9)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator}
+
+	makeEpochHeader := func(embedded common.Address) *types.Header {
+		header := makeSignedTestHeader(headers[9], diffInTurn, key)
+		header.Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+		copy(header.Extra[extraVanity:], embedded.Bytes())
+		sig, _ := crypto.Sign(sealHash(header, nil).Bytes(), key)
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		return header
+	}
+
+	if err := engine.verifyCascadingFields(chain, makeEpochHeader(validator), nil); err == errValidatorSetMismatch {
+		t.Errorf("embedded contract validator set, got %v", err)
+	}
+	tampered := makeEpochHeader(common.HexToAddress("0xdead"))
+	if err := engine.verifyCascadingFields(chain, tampered, nil); err != errValidatorSetMismatch {
+		t.Errorf("tampered validator set, got %v, want %v", err, errValidatorSetMismatch)
+	}
+}
+
+func TestVerifyDuplicateOperator(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 9)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator}
+
+	// The contract's only validator is embedded twice
+	header := makeSignedTestHeader(headers[9], diffInTurn, key)
+	header.Extra = make([]byte, extraVanity+2*common.AddressLength+extraSeal)
+	copy(header.Extra[extraVanity:], validator.Bytes())
+	copy(header.Extra[extraVanity+common.AddressLength:], validator.Bytes())
+	sig, _ := crypto.Sign(sealHash(header, nil).Bytes(), key)
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+	if err := engine.verifyCascadingFields(chain, header, nil); err != errDuplicateOperator {
+		t.Errorf("duplicated operator, got %v, want %v", err, errDuplicateOperator)
+	}
+}
+
+func TestTrustedCheckpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 3)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.config.TrustedCheckpoint = &params.OasysCheckpoint{Number: 2, Hash: headers[2].Hash(), Validators: []common.Address{validator}}
+
+	// The chain passing through the checkpoint is accepted
+	if err := engine.verifyHeader(chain, headers[2], nil); err == errCheckpointMismatch || err == errCheckpointValidators {
+		t.Errorf("matching chain, got %v", err)
+	}
+
+	// A fork at the checkpoint height is refused
+	fork := makeSignedTestHeader(headers[1], diffInTurn, key)
+	fork.Time++
+	sig, _ := crypto.Sign(sealHash(fork, nil).Bytes(), key)
+	copy(fork.Extra[len(fork.Extra)-extraSeal:], sig)
+	if err := engine.verifyHeader(chain, fork, nil); err != errCheckpointMismatch {
+		t.Errorf("non-matching chain, got %v, want %v", err, errCheckpointMismatch)
+	}
+
+	// The validators at the checkpoint must be the trusted ones
+	if err := engine.verifyCascadingFields(chain, headers[2], nil); err == errCheckpointValidators {
+		t.Errorf("trusted validators, got %v", err)
+	}
+	engine.config.TrustedCheckpoint.Validators = []common.Address{common.HexToAddress("0xdead")}
+	if err := engine.verifyCascadingFields(chain, headers[2], nil); err != errCheckpointValidators {
+		t.Errorf("untrusted validators, got %v, want %v", err, errCheckpointValidators)
+	}
+}
+
+func TestTrustedCheckpointSnapshot(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 5)
+	db := rawdb.NewMemoryDatabase()
+	engine := New(params.AllOasysProtocolChanges, &params.OasysConfig{Period: 0, Epoch: 10}, db, nil)
+	engine.ethAPI = &testEpochBlockchainAPI{validator: validator}
+	engine.config.TrustedCheckpoint = &params.OasysCheckpoint{Number: 3, Hash: headers[3].Hash(), Validators: []common.Address{validator}}
+
+	// The headers before the checkpoint aren't needed anymore
+	chain := newTestChainReaderWithHeaders(headers)
+	delete(chain.headers, headers[2].Hash())
+	snap, err := engine.snapshot(chain, 5, headers[5].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to get snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(snap.validators(), []common.Address{validator}) {
+		t.Errorf("validators, got %v, want %v", snap.validators(), []common.Address{validator})
+	}
+	if stake := snap.Validators[validator]; stake == nil || stake.Sign() == 0 {
+		t.Errorf("stake, got %v, want the stake of the StakeManager", stake)
+	}
+
+	// The checkpoint snapshot is stored to be loaded after a restart
+	if _, err := loadSnapshot(engine.config, nil, nil, db, headers[3].Hash()); err != nil {
+		t.Errorf("failed to load checkpoint snapshot: %v", err)
+	}
+}
+
+func TestGoWithLabel(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	goWithLabel("oasys-test", func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	var profile bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		t.Fatalf("failed to write goroutine profile: %v", err)
+	}
+	if !bytes.Contains(profile.Bytes(), []byte(`"consensus":"oasys-test"`)) {
+		t.Error("labeled goroutine not found in profile")
+	}
+}
+
+func TestEpochTransitions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping multi-epoch chain in short mode")
+	}
+
+	wallets, accounts, err := makeWallets(2)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// The second validator joins from epoch 3 (block 200)
+	var (
+		validator0 = accounts[0].Address
+		validator1 = accounts[1].Address
+		stake      = new(big.Int).Mul(big.NewInt(10_000_000), ether)
+		rewards    = new(big.Int).Mul(big.NewInt(5), ether)
+	)
+	env.stakeManager.register(2, []common.Address{validator0}, []*big.Int{stake})
+	env.stakeManager.register(3, []common.Address{validator0, validator1}, []*big.Int{stake, stake})
+	env.stakeManager.rewards[validator0] = rewards
+
+	validatorsAt := func(number uint64) []common.Address {
+		header := env.chain.GetHeaderByNumber(number)
+		snap, err := env.engine.snapshot(env.chain, number, header.Hash(), nil)
+		if err != nil {
+			t.Fatalf("failed to get snapshot at %v: %v", number, err)
+		}
+		return snap.validators()
+	}
+	balanceAt := func(number uint64) *big.Int {
+		statedb, err := env.chain.StateAt(env.chain.GetHeaderByNumber(number).Root)
+		if err != nil {
+			t.Fatalf("failed to get state at %v: %v", number, err)
+		}
+		return statedb.GetBalance(_stakeManagerAddress)
+	}
+
+	// Epochs 1 and 2 are sealed by the genesis validator alone
+	if err := env.generateBlocks(199, wallets, accounts); err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+	if got := validatorsAt(199); !reflect.DeepEqual(got, []common.Address{validator0}) {
+		t.Errorf("validators at 199, got %v, want %v", got, []common.Address{validator0})
+	}
+	if got := balanceAt(100); got.Sign() != 0 {
+		t.Errorf("rewards at 100, got %v, want 0", got)
+	}
+
+	// Rotate in the second validator and distribute the rewards at the boundary
+	if err := env.generateBlocks(200, wallets, accounts); err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+	want := []common.Address{validator0, validator1}
+	sort.Sort(validatorsAscending(want))
+	if got := validatorsAt(200); !reflect.DeepEqual(got, want) {
+		t.Errorf("validators at 200, got %v, want %v", got, want)
+	}
+	extra := env.chain.GetHeaderByNumber(200).Extra
+	if got := extra[extraVanity : len(extra)-extraSeal]; !bytes.Equal(got, append(want[0].Bytes(), want[1].Bytes()...)) {
+		t.Errorf("epoch validators at 200, got %x", got)
+	}
+	if got := new(big.Int).Sub(balanceAt(200), balanceAt(199)); got.Cmp(rewards) != 0 {
+		t.Errorf("rewards at 200, got %v, want %v", got, rewards)
+	}
+
+	// An out-of-turn block slashes the scheduled validator
+	if err := env.generateBlocks(249, wallets, accounts); err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+	var block *types.Block
+	for i := range wallets {
+		if block, err = env.generateBlock(*wallets[i], *accounts[i], false); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to generate out-of-turn block: %v", err)
+	}
+	if block.NumberU64() != 250 || len(block.Transactions()) != 1 {
+		t.Fatalf("block %v, got %v transactions, want 1", block.NumberU64(), len(block.Transactions()))
+	}
+	if to := block.Transactions()[0].To(); to == nil || *to != _stakeManagerAddress {
+		t.Errorf("slash transaction sent to %v, want %v", to, _stakeManagerAddress)
+	}
+	statedb, err := env.chain.StateAt(block.Root())
+	if err != nil {
+		t.Fatalf("failed to get state at 250: %v", err)
+	}
+	if slashed := statedb.GetState(_stakeManagerAddress, common.HexToHash("0x01")); slashed.Big().Uint64() != 2 {
+		t.Errorf("StakeManager.slashed, got %v, want 2", slashed.Big())
+	}
+
+	// The chain keeps on after the slash
+	if err := env.generateBlocks(300, wallets, accounts); err != nil {
+		t.Fatalf("failed to generate blocks: %v", err)
+	}
+}
+
+// testChainReader implements consensus.ChainHeaderReader over an in-memory set
+// of headers, without any state or consensus verification.
+type testChainReader struct {
+	config    *params.ChainConfig
+	canonical []*types.Header
+	headers   map[common.Hash]*types.Header
+}
+
+func newTestChainReader(head uint64) *testChainReader {
+	genesis := &types.Header{Number: common.Big0, Difficulty: diffInTurn}
+	return newTestChainReaderWithHeaders(append([]*types.Header{genesis}, makeTestChain(genesis, int(head), 0)...))
+}
+
+func newTestChainReaderWithHeaders(canonical []*types.Header) *testChainReader {
+	chain := &testChainReader{
+		config:    params.AllOasysProtocolChanges,
+		canonical: canonical,
+		headers:   make(map[common.Hash]*types.Header),
+	}
+	for _, header := range chain.canonical {
+		chain.headers[header.Hash()] = header
+	}
+	return chain
+}
+
+// makeTestChain creates a contiguous batch of headers on top of the given parent.
+// The extra-data is salted so that different forks never collide.
+func makeTestChain(parent *types.Header, length int, salt byte) []*types.Header {
+	headers := make([]*types.Header, length)
+	for i := range headers {
+		headers[i] = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			Difficulty: diffNoTurn,
+			Extra:      []byte{salt},
+		}
+		parent = headers[i]
+	}
+	return headers
+}
+
+func (r *testChainReader) Config() *params.ChainConfig  { return r.config }
+func (r *testChainReader) CurrentHeader() *types.Header { return r.canonical[len(r.canonical)-1] }
+
+func (r *testChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := r.headers[hash]; ok && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (r *testChainReader) GetHeaderByNumber(number uint64) *types.Header {
+	if number < uint64(len(r.canonical)) {
+		return r.canonical[number]
+	}
+	return nil
+}
+
+func (r *testChainReader) GetHeaderByHash(hash common.Hash) *types.Header { return r.headers[hash] }
+func (r *testChainReader) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
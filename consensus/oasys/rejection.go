@@ -0,0 +1,63 @@
+package oasys
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// recentRejections is the number of rejected headers remembered for the API.
+const recentRejections = 16
+
+// rejection is a header that failed verification, along with the reason.
+type rejection struct {
+	Hash   common.Hash    `json:"hash"`
+	Number hexutil.Uint64 `json:"number"`
+	Reason string         `json:"reason"`
+}
+
+// rejectionLog keeps the most recent headers that failed verification, so that
+// operators can tell why the sync stalls.
+type rejectionLog struct {
+	lock    sync.Mutex
+	entries []*rejection // Ring buffer of the recent rejections
+	next    int          // Index of the oldest entry once the buffer is full
+}
+
+// record adds the header rejected with the given error. Headers from the future
+// are only queued by the downloader, so they aren't recorded.
+func (l *rejectionLog) record(header *types.Header, err error) {
+	if err == nil || err == consensus.ErrFutureBlock || header.Number == nil {
+		return
+	}
+	entry := &rejection{Hash: header.Hash(), Number: hexutil.Uint64(header.Number.Uint64()), Reason: err.Error()}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.entries) < recentRejections {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+		l.next = (l.next + 1) % recentRejections
+	}
+}
+
+// last returns a copy of the most recent rejection, or nil if none.
+func (l *rejectionLog) last() *rejection {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.entries) == 0 {
+		return nil
+	}
+	latest := len(l.entries) - 1
+	if len(l.entries) == recentRejections {
+		latest = (l.next + recentRejections - 1) % recentRejections
+	}
+	entry := *l.entries[latest]
+	return &entry
+}
@@ -0,0 +1,53 @@
+package oasys
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestGetLastRejection(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 1)
+	chain := newTestChainReaderWithHeaders(headers)
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{chain: chain, oasys: engine}
+
+	if rejected := api.GetLastRejection(); rejected != nil {
+		t.Fatalf("rejection before any header, got %+v", rejected)
+	}
+
+	// A header with an invalid difficulty is recorded along with the reason
+	header := makeSignedTestHeader(headers[0], big.NewInt(3), key)
+	if err := engine.VerifyHeader(chain, header, true); err != errInvalidDifficulty {
+		t.Fatalf("invalid header, got %v, want %v", err, errInvalidDifficulty)
+	}
+	rejected := api.GetLastRejection()
+	if rejected == nil {
+		t.Fatal("rejection not recorded")
+	}
+	if rejected.Hash != header.Hash() || rejected.Number != 1 || rejected.Reason != errInvalidDifficulty.Error() {
+		t.Errorf("rejection, got %+v, want block 1 %x rejected for %q", rejected, header.Hash(), errInvalidDifficulty)
+	}
+
+	// Accepted and future headers leave the latest rejection in place
+	engine.rejected.record(headers[1], nil)
+	engine.rejected.record(headers[1], consensus.ErrFutureBlock)
+	if latest := api.GetLastRejection(); latest == nil || latest.Hash != header.Hash() {
+		t.Errorf("rejection after a valid header, got %+v, want %x", latest, header.Hash())
+	}
+
+	// The log wraps around, still returning the latest rejection
+	for i := 0; i < 2*recentRejections+1; i++ {
+		engine.rejected.record(&types.Header{Number: big.NewInt(int64(100 + i))}, errors.New("test"))
+	}
+	if latest := api.GetLastRejection(); latest == nil || latest.Number != 100+2*recentRejections {
+		t.Errorf("rejection after wrapping, got %+v, want block %d", latest, 100+2*recentRejections)
+	}
+}
@@ -0,0 +1,100 @@
+package oasys
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// scheduleChooser draws the validators of an epoch's blocks in order, from its
+// first block on. Both the schedule and the backoffs are derived from the same
+// sequence of draws.
+type scheduleChooser interface {
+	choice() common.Address
+	skip()
+}
+
+// newScheduleChooser returns the chooser of the algorithm version scheduling the
+// epoch the given block belongs to. The version is selected by the first block of
+// the epoch, so an epoch is never scheduled by two algorithms.
+func newScheduleChooser(
+	chain consensus.ChainHeaderReader,
+	config *params.OasysConfig,
+	validators []common.Address,
+	stakes []*big.Int,
+	env *environmentValue,
+	number uint64,
+) scheduleChooser {
+	start := new(big.Int).SetUint64(env.GetFirstBlock(number))
+	if config.ScheduleAlgoVersion(start) >= 2 {
+		return newRoundRobinChooser(chain, validators, stakes, env, number)
+	}
+	return newWeightedRandomChooser(chain, validators, stakes, env, number)
+}
+
+// roundRobinChooser picks validators by smooth weighted round-robin on their
+// stake in whole tokens: every draw credits each validator its weight and picks
+// the most credited one, which is then debited the total weight. Over an epoch,
+// each validator seals in proportion to its stake with its blocks spread evenly,
+// rather than by chance as with the weighted random draws. The validators are
+// shuffled by the epoch seed first, so the order of the ties changes per epoch.
+type roundRobinChooser struct {
+	validators []common.Address
+	weights    []*big.Int
+	credits    []*big.Int
+	total      *big.Int
+}
+
+func (c *roundRobinChooser) choice() common.Address {
+	best := 0
+	for i, weight := range c.weights {
+		c.credits[i].Add(c.credits[i], weight)
+		if c.credits[i].Cmp(c.credits[best]) > 0 {
+			best = i
+		}
+	}
+	c.credits[best].Sub(c.credits[best], c.total)
+	return c.validators[best]
+}
+
+func (c *roundRobinChooser) skip() {
+	c.choice()
+}
+
+func newRoundRobinChooser(
+	chain consensus.ChainHeaderReader,
+	validators []common.Address,
+	stakes []*big.Int,
+	env *environmentValue,
+	number uint64,
+) *roundRobinChooser {
+	validators, stakes = sortValidatorsAndValues(validators, stakes)
+	random := rand.New(rand.NewSource(scheduleSeed(chain, env.GetFirstBlock(number))))
+	random.Shuffle(len(validators), func(i, j int) {
+		validators[i], validators[j] = validators[j], validators[i]
+		stakes[i], stakes[j] = stakes[j], stakes[i]
+	})
+
+	chooser := &roundRobinChooser{
+		validators: validators,
+		weights:    make([]*big.Int, len(stakes)),
+		credits:    make([]*big.Int, len(stakes)),
+		total:      new(big.Int),
+	}
+	for i, stake := range stakes {
+		chooser.weights[i] = new(big.Int).Div(stake, ether)
+		chooser.credits[i] = new(big.Int)
+		chooser.total.Add(chooser.total, chooser.weights[i])
+	}
+	// Without any whole token staked, the validators take turns
+	if chooser.total.Sign() == 0 {
+		for i := range chooser.weights {
+			chooser.weights[i].SetInt64(1)
+		}
+		chooser.total.SetInt64(int64(len(chooser.weights)))
+	}
+	return chooser
+}
@@ -0,0 +1,81 @@
+package oasys
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestScheduleAlgoVersion(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chain := newTestChainReaderWithHeaders(makeSignedTestChain(key, 30))
+	config := &params.OasysConfig{Period: 0, Epoch: 10, ScheduleV2Block: big.NewInt(20)}
+	envValue := &environmentValue{
+		StartBlock:  common.Big0,
+		StartEpoch:  common.Big1,
+		EpochPeriod: big.NewInt(10),
+	}
+
+	// Both algorithms draw from the same seed, so each schedule is compared
+	// against the draws of the chooser expected on its side of the fork
+	for _, tt := range []struct {
+		number  uint64
+		version uint64
+		chooser scheduleChooser
+	}{
+		{15, 1, newWeightedRandomChooser(chain, validators, stakes, envValue, 15)},
+		{19, 1, newWeightedRandomChooser(chain, validators, stakes, envValue, 19)},
+		{20, 2, newRoundRobinChooser(chain, validators, stakes, envValue, 20)},
+		{25, 2, newRoundRobinChooser(chain, validators, stakes, envValue, 25)},
+	} {
+		start := envValue.GetFirstBlock(tt.number)
+		if got := config.ScheduleAlgoVersion(new(big.Int).SetUint64(start)); got != tt.version {
+			t.Errorf("block %d: version, got %d, want %d", tt.number, got, tt.version)
+		}
+		schedule := getValidatorSchedule(chain, config, validators, stakes, envValue, tt.number)
+		for n := start; n < start+envValue.EpochPeriod.Uint64(); n++ {
+			if want := tt.chooser.choice(); schedule[n] != want {
+				t.Errorf("block %d: version %d validator of block %d, got %v, want %v", tt.number, tt.version, n, schedule[n], want)
+			}
+		}
+		// The in-turn validator is given no backoff by either algorithm
+		if backoff := backOffTime(chain, config, validators, stakes, envValue, tt.number, schedule[tt.number]); backoff != 0 {
+			t.Errorf("block %d: in-turn backoff, got %d, want 0", tt.number, backoff)
+		}
+	}
+}
+
+func TestRoundRobinChooser(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chain := newTestChainReaderWithHeaders(makeSignedTestChain(key, 0))
+	envValue := &environmentValue{
+		StartBlock:  common.Big0,
+		StartEpoch:  common.Big1,
+		EpochPeriod: big.NewInt(70),
+	}
+
+	// Every seven blocks, the validator staking three times the others seals
+	// three of them
+	weighted := []*big.Int{
+		new(big.Int).Mul(big.NewInt(3), stakes[0]),
+		stakes[1], stakes[2], stakes[3], stakes[0],
+	}
+	operators := append(append([]common.Address{}, validators...), common.HexToAddress("0x0e"))
+	chooser := newRoundRobinChooser(chain, operators, weighted, envValue, 0)
+	counts := make(map[common.Address]int)
+	for i := 0; i < 70; i++ {
+		counts[chooser.choice()]++
+	}
+	for i, operator := range operators {
+		want := 10
+		if i == 0 {
+			want = 30
+		}
+		if counts[operator] != want {
+			t.Errorf("blocks of %v, got %d, want %d", operator, counts[operator], want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package oasys
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// SealScheme signs block headers and recovers their signers from the seal in
+// the extra-data suffix, which is extraSeal bytes long whatever the scheme. The
+// seal commits to the given chain ID unless nil.
+type SealScheme interface {
+	// Sign returns the seal of the header signed by the validator.
+	Sign(signFn SignerFn, validator common.Address, header *types.Header, chainID *big.Int) ([]byte, error)
+
+	// Recover returns the address of the validator who produced the seal.
+	Recover(header *types.Header, seal []byte, chainID *big.Int) (common.Address, error)
+}
+
+// publicKeyRecoverer is implemented by the seal schemes able to recover the
+// public key of the validator who produced a seal, not only its address.
+type publicKeyRecoverer interface {
+	// RecoverPublicKey returns the public key of the validator who produced the
+	// seal, encoded as the scheme defines it.
+	RecoverPublicKey(header *types.Header, seal []byte, chainID *big.Int) ([]byte, error)
+}
+
+// defaultSealScheme is the name of the scheme sealing the blocks unless the
+// configuration selects another one.
+const defaultSealScheme = "secp256k1"
+
+// sealSchemes are the known seal schemes by configuration name.
+var sealSchemes = map[string]SealScheme{
+	defaultSealScheme: secp256k1Scheme{},
+}
+
+// sealSchemeAt returns the scheme the block with the given number is sealed
+// with: the configured one from its activation block on, the default otherwise.
+func sealSchemeAt(config *params.OasysConfig, number uint64) (SealScheme, error) {
+	name := defaultSealScheme
+	if config.SealScheme != "" && (config.SealSchemeBlock == nil || config.SealSchemeBlock.Uint64() <= number) {
+		name = config.SealScheme
+	}
+	scheme, ok := sealSchemes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown seal scheme %q", name)
+	}
+	return scheme, nil
+}
+
+// sealChainID returns the chain ID the seal of the block with the given number
+// commits to, nil before the chain ID seal fork.
+func sealChainID(config *params.OasysConfig, number *big.Int) *big.Int {
+	if !config.IsChainIDSeal(number) {
+		return nil
+	}
+	if config.ChainID == nil {
+		return new(big.Int)
+	}
+	return config.ChainID
+}
+
+// secp256k1Scheme seals the blocks with ECDSA signatures over the secp256k1
+// curve, recovering the signer as an Ethereum account.
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) Sign(signFn SignerFn, validator common.Address, header *types.Header, chainID *big.Int) ([]byte, error) {
+	return signFn(accounts.Account{Address: validator}, accounts.MimetypeOasys, sealRLP(header, chainID))
+}
+
+func (s secp256k1Scheme) Recover(header *types.Header, seal []byte, chainID *big.Int) (common.Address, error) {
+	pubkey, err := s.RecoverPublicKey(header, seal, chainID)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// RecoverPublicKey returns the uncompressed public key of the validator who
+// produced the seal.
+func (secp256k1Scheme) RecoverPublicKey(header *types.Header, seal []byte, chainID *big.Int) ([]byte, error) {
+	return crypto.Ecrecover(sealHash(header, chainID).Bytes(), seal)
+}
@@ -0,0 +1,159 @@
+package oasys
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSealScheme(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	signFn := func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}
+
+	// Without configuration, blocks are sealed with secp256k1
+	config := &params.OasysConfig{Period: 1, Epoch: 10}
+	scheme, err := sealSchemeAt(config, 1)
+	if err != nil {
+		t.Fatalf("failed to get the default seal scheme: %v", err)
+	}
+	if _, ok := scheme.(secp256k1Scheme); !ok {
+		t.Errorf("default scheme, got %T, want secp256k1", scheme)
+	}
+
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	seal, err := scheme.Sign(signFn, signer, header, nil)
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	if len(seal) != extraSeal {
+		t.Fatalf("seal length, got %d, want %d", len(seal), extraSeal)
+	}
+	copy(header.Extra[extraVanity:], seal)
+	if recovered, err := scheme.Recover(header, seal, nil); err != nil || recovered != signer {
+		t.Errorf("recovered signer, got %v (err %v), want %v", recovered, err, signer)
+	}
+
+	// Unknown schemes are refused from their activation block on
+	engine := New(params.AllOasysProtocolChanges, config, rawdb.NewMemoryDatabase(), nil)
+	engine.config.SealScheme, engine.config.SealSchemeBlock = "unknown", big.NewInt(5)
+	if recovered, err := ecrecover(engine.config, header, engine.signatures); err != nil || recovered != signer {
+		t.Errorf("before activation, got %v (err %v), want %v", recovered, err, signer)
+	}
+	if _, err := sealSchemeAt(engine.config, 5); err == nil {
+		t.Error("unknown scheme accepted")
+	}
+	future := &types.Header{Number: big.NewInt(5), Extra: header.Extra}
+	if _, err := ecrecover(engine.config, future, engine.signatures); err == nil {
+		t.Error("header of an unknown scheme recovered")
+	}
+}
+
+func TestChainIDSeal(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 1)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The header is sealed for chain 1
+	header := makeSignedTestHeader(headers[0], diffInTurn, key)
+	sig, _ := crypto.Sign(sealHash(header, big.NewInt(1)).Bytes(), key)
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+
+	for _, tt := range []struct {
+		chainID *big.Int
+		valid   bool
+	}{
+		{big.NewInt(1), true},
+		{big.NewInt(2), false},
+	} {
+		config := &params.OasysConfig{Period: 0, Epoch: 10, ChainIDSealBlock: common.Big0, ChainID: tt.chainID}
+		engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+
+		recovered, err := ecrecover(engine.config, header, engine.signatures)
+		if err != nil {
+			t.Fatalf("chain %v: failed to recover signer: %v", tt.chainID, err)
+		}
+		if (recovered == signer) != tt.valid {
+			t.Errorf("chain %v: recovered %v, signer %v, want match %v", tt.chainID, recovered, signer, tt.valid)
+		}
+		err = engine.verifySeal(chain, header, nil)
+		if tt.valid && err != nil {
+			t.Errorf("chain %v: verifySeal, got %v, want nil", tt.chainID, err)
+		}
+		if !tt.valid && err != errCoinBaseMisMatch {
+			t.Errorf("chain %v: verifySeal, got %v, want %v", tt.chainID, err, errCoinBaseMisMatch)
+		}
+	}
+
+	// Before the fork, the seal doesn't commit to any chain ID
+	engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10, ChainID: big.NewInt(1)}, rawdb.NewMemoryDatabase(), nil)
+	if recovered, err := ecrecover(engine.config, header, engine.signatures); err != nil || recovered == signer {
+		t.Errorf("before the fork, got %v (err %v), want a mismatch", recovered, err)
+	}
+
+	// The exported seal hash and rlp follow the fork, and decode back
+	for _, config := range []*params.OasysConfig{
+		{ChainIDSealBlock: big.NewInt(2), ChainID: big.NewInt(1)},
+		{ChainIDSealBlock: common.Big0, ChainID: big.NewInt(1)},
+	} {
+		want := sealChainID(config, header.Number)
+		if got := SealHash(header, config); got != sealHash(header, want) {
+			t.Errorf("fork %v: seal hash, got %x, want %x", config.ChainIDSealBlock, got, sealHash(header, want))
+		}
+		decoded, chainID, err := DecodeOasysRLP(OasysRLP(header, config))
+		if err != nil {
+			t.Fatalf("fork %v: failed to decode rlp: %v", config.ChainIDSealBlock, err)
+		}
+		if decoded.Number.Cmp(header.Number) != 0 || (chainID == nil) != (want == nil) || (want != nil && chainID.Cmp(want) != 0) {
+			t.Errorf("fork %v: decoded block %v chain %v, want block %v chain %v", config.ChainIDSealBlock, decoded.Number, chainID, header.Number, want)
+		}
+	}
+}
+
+func TestMinSealPeers(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 0)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 1, Epoch: 10, MinSealPeers: 3}, rawdb.NewMemoryDatabase(), nil)
+	engine.Authorize(signer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}, nil)
+
+	block := types.NewBlockWithHeader(makeSignedTestHeader(headers[0], diffInTurn, key))
+	for _, tt := range []struct {
+		peers int
+		want  error
+	}{
+		{0, errInsufficientPeers},
+		{2, errInsufficientPeers},
+		{3, nil},
+		{5, nil},
+	} {
+		peers := tt.peers
+		engine.SetPeerCounter(func() int { return peers })
+
+		results := make(chan *types.Block, 1)
+		if err := engine.Seal(chain, block, results, make(chan struct{})); err != tt.want {
+			t.Errorf("%d peers, got %v, want %v", tt.peers, err, tt.want)
+			continue
+		}
+		if tt.want == nil {
+			<-results
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package oasys
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// minEpochsBetweenSetChanges returns the minimum number of epochs between two
+// validator set changes at the given block, none before the set change deferral
+// block.
+func minEpochsBetweenSetChanges(config *params.OasysConfig, number uint64) uint64 {
+	if !config.IsMinEpochsBetweenSetChanges(new(big.Int).SetUint64(number)) {
+		return 0
+	}
+	return config.MinEpochsBetweenSetChanges
+}
+
+// activationDelayEpochs returns the number of epochs validators must qualify for
+// in a row before joining the set at the given block, none before the activation
+// delay block.
+func activationDelayEpochs(config *params.OasysConfig, number uint64) uint64 {
+	if !config.IsActivationDelay(new(big.Int).SetUint64(number)) {
+		return 0
+	}
+	return config.ActivationDelayEpochs
+}
+
+// deferringSetChanges reports whether validator set changes may be deferred at
+// the given block, which makes the committed set depend on the parent snapshot.
+func deferringSetChanges(config *params.OasysConfig, number uint64) bool {
+	return minEpochsBetweenSetChanges(config, number) > 0 || activationDelayEpochs(config, number) > 0
+}
+
+// setCommit is the validator set committed at an epoch, along with the epoch it
+// last changed at and the epochs the validators outside of it qualify since.
+type setCommit struct {
+	validators *getNextValidatorsResult
+	since      uint64
+	qualifying map[common.Address]uint64
+	tracked    bool // Whether set changes may be deferred, the snapshot tracking them
+}
+
+// commitSet returns the validator set committed at the epoch starting at the
+// given block on top of the snapshot, the last one of the previous epoch: the
+// next validators, less the ones still delayed from activation, if they're the
+// snapshot's or enough epochs elapsed since its set changed, the snapshot's
+// validators along with their stakes otherwise. The snapshot's validators no
+// longer among the candidates, like the jailed or withdrawn ones, are dropped
+// even then. The snapshot isn't modified, so the commit only depends on the
+// chain it was built from.
+func (s *Snapshot) commitSet(number, epoch uint64, candidates, next *getNextValidatorsResult) *setCommit {
+	tracked := deferringSetChanges(s.config, number)
+	if !tracked || s.SetChanged == 0 {
+		// Nothing to defer to before the first tracked commit
+		return &setCommit{validators: next, since: epoch, tracked: tracked}
+	}
+	prev := s.committedValidators(next)
+
+	commit := &setCommit{validators: next, since: epoch, tracked: true}
+	if delay := activationDelayEpochs(s.config, number); delay > 0 {
+		commit.validators, commit.qualifying = s.delayActivations(epoch, delay, prev, next)
+	}
+	switch minEpochs := minEpochsBetweenSetChanges(s.config, number); {
+	case sameOperators(prev, commit.validators):
+		commit.since = s.SetChanged
+	case epoch-s.SetChanged < minEpochs:
+		kept := retainCandidates(prev, candidates, next)
+		if len(kept.Operators) == 0 {
+			log.Warn("Committing validator set change, none left to defer to", "epoch", epoch, "changed", s.SetChanged, "min", minEpochs)
+			break
+		}
+		log.Info("Deferring validator set change", "epoch", epoch, "changed", s.SetChanged, "min", minEpochs, "dropped", len(prev.Operators)-len(kept.Operators))
+		commit.validators, commit.since = kept, s.SetChanged
+	}
+	return commit
+}
+
+// retainCandidates returns the given validators which are still among the
+// candidates or the next validators, dropping the ones the StakeManager stopped
+// reporting, like the jailed or withdrawn ones, so a deferred set doesn't keep
+// scheduling them.
+func retainCandidates(validators, candidates, next *getNextValidatorsResult) *getNextValidatorsResult {
+	retained := &getNextValidatorsResult{}
+	for i, operator := range validators.Operators {
+		if !candidates.Exists(operator) && !next.Exists(operator) {
+			log.Debug("Dropping validator from deferred set", "operator", operator)
+			continue
+		}
+		retained.Owners = append(retained.Owners, validators.Owners[i])
+		retained.Operators = append(retained.Operators, operator)
+		retained.Stakes = append(retained.Stakes, validators.Stakes[i])
+	}
+	return retained
+}
+
+// committedValidators returns the validators of the snapshot in ascending order,
+// with their owners taken from the given candidates. The operators left out of
+// them are their own owners, like the bootstrap validators.
+func (s *Snapshot) committedValidators(next *getNextValidatorsResult) *getNextValidatorsResult {
+	owners := make(map[common.Address]common.Address, len(next.Operators))
+	for i, operator := range next.Operators {
+		owners[operator] = next.Owners[i]
+	}
+	committed := &getNextValidatorsResult{}
+	for _, operator := range s.validators() {
+		owner, ok := owners[operator]
+		if !ok {
+			owner = operator
+		}
+		committed.Owners = append(committed.Owners, owner)
+		committed.Operators = append(committed.Operators, operator)
+		committed.Stakes = append(committed.Stakes, s.Validators[operator])
+	}
+	return committed
+}
+
+// delayActivations drops the validators outside of the previous epoch's set
+// until they qualified for the given delay in epochs in a row, so that lowering the
+// validator threshold phases the newly qualifying validators in rather than
+// admitting them at once. It returns the validators left along with the epochs
+// the ones outside of the previous set qualify since.
+func (s *Snapshot) delayActivations(epoch, delay uint64, prev, next *getNextValidatorsResult) (*getNextValidatorsResult, map[common.Address]uint64) {
+	// Validators failing to qualify in any epoch start over, the ones activated
+	// are remembered in case the set change is deferred
+	qualifying := make(map[common.Address]uint64)
+	active := &getNextValidatorsResult{}
+	for i, operator := range next.Operators {
+		if !prev.Exists(operator) {
+			since, ok := s.Qualifying[operator]
+			if !ok {
+				since = epoch
+			}
+			qualifying[operator] = since
+			if epoch-since < delay {
+				log.Debug("Delaying validator activation", "epoch", epoch, "operator", operator, "qualified", since, "delay", delay)
+				continue
+			}
+		}
+		active.Owners = append(active.Owners, next.Owners[i])
+		active.Operators = append(active.Operators, operator)
+		active.Stakes = append(active.Stakes, next.Stakes[i])
+	}
+
+	// Better to activate every validator than to leave the epoch without any
+	if len(active.Operators) == 0 {
+		log.Warn("Activating delayed validators, none left", "epoch", epoch, "validators", len(next.Operators))
+		return next, qualifying
+	}
+	return active, qualifying
+}
+
+// setValidators replaces the validators of the snapshot by the committed set.
+func (s *Snapshot) setValidators(commit *setCommit) {
+	s.Validators = make(map[common.Address]*big.Int, len(commit.validators.Operators))
+	for i, operator := range commit.validators.Operators {
+		s.Validators[operator] = commit.validators.Stakes[i]
+	}
+	if commit.tracked {
+		s.SetChanged, s.Qualifying = commit.since, commit.qualifying
+	}
+}
+
+// sameOperators reports whether both results hold the same operators, whatever
+// their order.
+func sameOperators(a, b *getNextValidatorsResult) bool {
+	if len(a.Operators) != len(b.Operators) {
+		return false
+	}
+	operators := make(map[common.Address]bool, len(a.Operators))
+	for _, operator := range a.Operators {
+		operators[operator] = true
+	}
+	for _, operator := range b.Operators {
+		if !operators[operator] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package oasys
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// nextValidatorsOf returns the first n test validators as next validators.
+func nextValidatorsOf(n int, stakes []*big.Int) *getNextValidatorsResult {
+	return &getNextValidatorsResult{
+		Owners:    append([]common.Address{}, validators[:n]...),
+		Operators: append([]common.Address{}, validators[:n]...),
+		Stakes:    append([]*big.Int{}, stakes[:n]...),
+	}
+}
+
+func TestMinEpochsBetweenSetChanges(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 10, MinEpochsBetweenSetChanges: 3, MinEpochsBetweenSetChangesBlock: big.NewInt(10)}
+	snap := newSnapshot(config, nil, nil, 0, common.Hash{}, nil, getInitialEnvironment(config))
+
+	// The fourth validator qualifies at epoch 3, two epochs after the set of
+	// epoch 1 was committed. The third one, jailed at epoch 5, and the second
+	// one, withdrawn at epoch 6, are dropped from the deferred set, the third
+	// one's return being deferred. Set changes aren't tracked before the fork.
+	for _, tt := range []struct {
+		epoch uint64
+		next  []common.Address
+		want  []common.Address
+		since uint64
+	}{
+		{0, validators[:3], validators[:3], 0},
+		{1, validators[:3], validators[:3], 1},
+		{2, validators[:3], validators[:3], 1},
+		{3, validators, validators[:3], 1},
+		{4, validators, validators, 4},
+		{5, []common.Address{validators[0], validators[1], validators[3]}, []common.Address{validators[0], validators[1], validators[3]}, 4},
+		{6, []common.Address{validators[0], validators[2], validators[3]}, []common.Address{validators[0], validators[3]}, 4},
+	} {
+		next := &getNextValidatorsResult{Owners: tt.next, Operators: tt.next}
+		for range tt.next {
+			next.Stakes = append(next.Stakes, stakes[0])
+		}
+		commit := snap.commitSet(tt.epoch*config.Epoch, tt.epoch, next, next)
+		if !sameOperators(commit.validators, &getNextValidatorsResult{Operators: tt.want}) {
+			t.Errorf("epoch %d: validators, got %v, want %v", tt.epoch, commit.validators.Operators, tt.want)
+		}
+		if commit.since != tt.since {
+			t.Errorf("epoch %d: last change, got %d, want %d", tt.epoch, commit.since, tt.since)
+		}
+
+		// Later commits on the same snapshot agree with the first
+		again := snap.commitSet(tt.epoch*config.Epoch, tt.epoch, next, next)
+		if !sameOperators(again.validators, commit.validators) || again.since != commit.since {
+			t.Errorf("epoch %d: repeated commit, got %v since %d, want %v since %d", tt.epoch, again.validators.Operators, again.since, commit.validators.Operators, commit.since)
+		}
+
+		snap = snap.copy()
+		snap.setValidators(commit)
+	}
+}
+
+func TestActivationDelayEpochs(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 10, ActivationDelayEpochs: 2, ActivationDelayBlock: big.NewInt(10)}
+	snap := newSnapshot(config, nil, nil, 0, common.Hash{}, nil, getInitialEnvironment(config))
+
+	// The fourth validator qualifies once the threshold is lowered at epoch 3,
+	// activations not being delayed before the fork
+	for _, tt := range []struct {
+		epoch uint64
+		next  int
+		want  []common.Address
+	}{
+		{0, 4, validators},
+		{1, 3, validators[:3]},
+		{2, 3, validators[:3]},
+		{3, 4, validators[:3]},
+		{4, 4, validators[:3]},
+		{5, 4, validators},
+		{6, 4, validators},
+	} {
+		next := nextValidatorsOf(tt.next, stakes)
+		commit := snap.commitSet(tt.epoch*config.Epoch, tt.epoch, next, next)
+		if !sameOperators(commit.validators, &getNextValidatorsResult{Operators: tt.want}) {
+			t.Errorf("epoch %d: validators, got %v, want %v", tt.epoch, commit.validators.Operators, tt.want)
+		}
+		snap = snap.copy()
+		snap.setValidators(commit)
+
+		// The qualifying epochs survive a restart
+		snap.Hash = common.BigToHash(new(big.Int).SetUint64(tt.epoch))
+		db := rawdb.NewMemoryDatabase()
+		if err := snap.store(db); err != nil {
+			t.Fatalf("epoch %d: failed to store snapshot: %v", tt.epoch, err)
+		}
+		loaded, err := loadSnapshot(config, nil, nil, db, snap.Hash)
+		if err != nil {
+			t.Fatalf("epoch %d: failed to load snapshot: %v", tt.epoch, err)
+		}
+		if loaded.SetChanged != snap.SetChanged || len(loaded.Qualifying) != len(snap.Qualifying) {
+			t.Errorf("epoch %d: loaded set changes, got %d %v, want %d %v", tt.epoch, loaded.SetChanged, loaded.Qualifying, snap.SetChanged, snap.Qualifying)
+		}
+		snap = loaded
+	}
+}
@@ -4,28 +4,33 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
-	lru "github.com/hashicorp/golang-lru"
 )
 
 // Snapshot is the state of the authorization voting at a given point in time.
 type Snapshot struct {
 	config   *params.OasysConfig // Consensus engine parameters to fine tune behavior
-	sigcache *lru.ARCCache       // Cache of recent block signatures to speed up ecrecover
-	ethAPI   *ethapi.PublicBlockChainAPI
+	sigcache *countingCache      // Cache of recent block signatures to speed up ecrecover
+	ethAPI   blockchainAPI
+	tunables *tunables // Runtime settings of the engine, the config ones if nil
 
-	Number     uint64                      `json:"number"`     // Block number where the snapshot was created
-	Hash       common.Hash                 `json:"hash"`       // Block hash where the snapshot was created
-	Validators map[common.Address]*big.Int `json:"validators"` // Set of authorized validators and stakes at this moment
+	Number     uint64                          `json:"number"`               // Block number where the snapshot was created
+	Hash       common.Hash                     `json:"hash"`                 // Block hash where the snapshot was created
+	Validators map[common.Address]*big.Int     `json:"validators"`           // Set of authorized validators and stakes at this moment
+	Recents    map[uint64]common.Address       `json:"recents"`              // Set of recent validators for signer diversity
+	Slashes    map[common.Address][]slashEntry `json:"slashes,omitempty"`    // Recent blocks each operator missed its turn at, oldest first
+	SetChanged uint64                          `json:"setChanged,omitempty"` // Epoch the validator set last changed at, if changes are deferred
+	Qualifying map[common.Address]uint64       `json:"qualifying,omitempty"` // Epoch the validators delayed from activation qualify since
 
 	Environment *environmentValue `json:"environment"`
 }
@@ -40,7 +45,7 @@ func (s validatorsAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 // newSnapshot creates a new snapshot with the specified startup parameters. This
 // method does not initialize the set of recent validators, so only ever use if for
 // the genesis block.
-func newSnapshot(config *params.OasysConfig, sigcache *lru.ARCCache, ethAPI *ethapi.PublicBlockChainAPI,
+func newSnapshot(config *params.OasysConfig, sigcache *countingCache, ethAPI blockchainAPI,
 	number uint64, hash common.Hash, validators []common.Address, environment *environmentValue) *Snapshot {
 	snap := &Snapshot{
 		config:      config,
@@ -49,6 +54,8 @@ func newSnapshot(config *params.OasysConfig, sigcache *lru.ARCCache, ethAPI *eth
 		Number:      number,
 		Hash:        hash,
 		Validators:  make(map[common.Address]*big.Int),
+		Recents:     make(map[uint64]common.Address),
+		Slashes:     make(map[common.Address][]slashEntry),
 		Environment: environment.Copy(),
 	}
 	for _, address := range validators {
@@ -58,20 +65,32 @@ func newSnapshot(config *params.OasysConfig, sigcache *lru.ARCCache, ethAPI *eth
 }
 
 // loadSnapshot loads an existing snapshot from the database.
-func loadSnapshot(config *params.OasysConfig, sigcache *lru.ARCCache, ethAPI *ethapi.PublicBlockChainAPI,
+func loadSnapshot(config *params.OasysConfig, sigcache *countingCache, ethAPI blockchainAPI,
 	db ethdb.Database, hash common.Hash) (*Snapshot, error) {
-	blob, err := db.Get(append([]byte("oasys-"), hash[:]...))
+	blob, err := db.Get(snapshotKey(hash))
 	if err != nil {
 		return nil, err
 	}
 	snap := new(Snapshot)
 	if err := json.Unmarshal(blob, snap); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
+	}
+	if err := snap.validate(hash); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
 	}
 	snap.config = config
 	snap.sigcache = sigcache
 	snap.ethAPI = ethAPI
 
+	// Snapshots stored before signer diversity tracking have no recents
+	if snap.Recents == nil {
+		snap.Recents = make(map[uint64]common.Address)
+	}
+	// Nor do the ones stored before slash tracking have any slashes
+	if snap.Slashes == nil {
+		snap.Slashes = make(map[common.Address][]slashEntry)
+	}
+
 	return snap, nil
 }
 
@@ -81,7 +100,47 @@ func (s *Snapshot) store(db ethdb.Database) error {
 	if err != nil {
 		return err
 	}
-	return db.Put(append([]byte("oasys-"), s.Hash[:]...), blob)
+	return db.Put(snapshotKey(s.Hash), blob)
+}
+
+// snapshotKey returns the database key of the snapshot at the given block.
+func snapshotKey(hash common.Hash) []byte {
+	return append([]byte("oasys-"), hash[:]...)
+}
+
+// validate checks that a decoded snapshot is complete, so that a truncated or
+// otherwise damaged entry is never used in place of the real one.
+func (s *Snapshot) validate(hash common.Hash) error {
+	if s.Hash != hash {
+		return fmt.Errorf("hash mismatch: have %x, want %x", s.Hash, hash)
+	}
+	for address, stake := range s.Validators {
+		if stake == nil {
+			return fmt.Errorf("missing stake of validator %v", address)
+		}
+	}
+	env := s.Environment
+	if env == nil {
+		return errors.New("missing environment")
+	}
+	for _, value := range []*big.Int{env.StartBlock, env.StartEpoch, env.BlockPeriod, env.EpochPeriod, env.RewardRate,
+		env.CommissionRate, env.ValidatorThreshold, env.JailThreshold, env.JailPeriod} {
+		if value == nil {
+			return errors.New("incomplete environment")
+		}
+	}
+	if env.EpochPeriod.Sign() <= 0 {
+		return errors.New("invalid epoch period")
+	}
+	return nil
+}
+
+// settings returns the runtime settings of the engine.
+func (s *Snapshot) settings() *tunables {
+	if s.tunables == nil {
+		return newTunables(s.config)
+	}
+	return s.tunables
 }
 
 // copy creates a deep copy of the snapshot, though not the individual votes.
@@ -90,14 +149,30 @@ func (s *Snapshot) copy() *Snapshot {
 		config:      s.config,
 		sigcache:    s.sigcache,
 		ethAPI:      s.ethAPI,
+		tunables:    s.tunables,
 		Number:      s.Number,
 		Hash:        s.Hash,
 		Validators:  make(map[common.Address]*big.Int),
+		Recents:     make(map[uint64]common.Address),
+		Slashes:     make(map[common.Address][]slashEntry, len(s.Slashes)),
 		Environment: s.Environment.Copy(),
 	}
 	for address, stake := range s.Validators {
 		cpy.Validators[address] = new(big.Int).Set(stake)
 	}
+	for block, validator := range s.Recents {
+		cpy.Recents[block] = validator
+	}
+	for operator, slashes := range s.Slashes {
+		cpy.Slashes[operator] = append([]slashEntry(nil), slashes...)
+	}
+	cpy.SetChanged = s.SetChanged
+	if s.Qualifying != nil {
+		cpy.Qualifying = make(map[common.Address]uint64, len(s.Qualifying))
+		for operator, since := range s.Qualifying {
+			cpy.Qualifying[operator] = since
+		}
+	}
 	return cpy
 }
 
@@ -119,42 +194,74 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 	}
 	// Iterate through the headers and create a new snapshot
 	snap := s.copy()
+	prefetched := s.prefetchTransitions(headers)
 
+	var schedule map[uint64]common.Address // Schedule of the current epoch, computed on its first out-of-turn block
 	for _, header := range headers {
 		number := header.Number.Uint64()
 
-		validator, err := ecrecover(header, s.sigcache)
+		// Legacy blocks are verified against the genesis validators, kept as is
+		if !s.config.IsOasys(header.Number) {
+			continue
+		}
+		validator, err := ecrecover(s.config, header, s.sigcache)
 		if err != nil {
 			return nil, err
 		}
 
 		var exists bool
 		if number > 0 && number%snap.Environment.EpochPeriod.Uint64() == 0 {
-			nextValidator, err := getNextValidators(s.ethAPI, header.ParentHash, snap.Environment.Epoch(number))
-			if err != nil {
-				log.Error("Failed to get validators", "in", "Snapshot.apply", "hash", header.ParentHash, "number", number, "err", err)
-				return nil, err
+			epoch := snap.Environment.Epoch(number)
+			transition, ok := prefetched[header.Hash()]
+			if !ok || transition.epoch != epoch || transition.fallback {
+				transition = s.fetchEpochTransition(header, epoch, snap.Environment)
 			}
-			nextEnv, err := getNextEnvironmentValue(s.ethAPI, header.ParentHash)
-			if err != nil {
-				log.Error("Failed to get environment value", "in", "Snapshot.apply", "hash", header.ParentHash, "number", number, "err", err)
-				return nil, err
+			if transition.err != nil {
+				return nil, transition.err
 			}
 
-			snap.Environment = nextEnv.Copy()
-			snap.Validators = map[common.Address]*big.Int{}
-			for i, address := range nextValidator.Operators {
-				snap.Validators[address] = nextValidator.Stakes[i]
-			}
+			commit := snap.commitSet(number, epoch, transition.candidates, transition.validators)
+			committed := commit.validators
 
-			exists = nextValidator.Exists(validator)
+			// From the boundary signer fork on, the outgoing validators seal the
+			// epoch block
+			schedule = nil
+			if s.config.IsBoundarySigner(header.Number) {
+				exists = snap.exists(validator)
+				if snap.outOfTurn(header) {
+					snap.recordSlash(snap.getValidatorSchedule(chain, transition.env, number)[number], validator, number, epoch)
+				}
+			} else {
+				exists = committed.Exists(validator)
+			}
+			snap.Environment = transition.env.Copy()
+			snap.setValidators(commit)
+			if !s.config.IsBoundarySigner(header.Number) && snap.outOfTurn(header) {
+				schedule = snap.getValidatorSchedule(chain, snap.Environment, number)
+				snap.recordSlash(schedule[number], validator, number, epoch)
+			}
 		} else {
 			exists = snap.exists(validator)
+			if snap.outOfTurn(header) {
+				if schedule == nil {
+					schedule = snap.getValidatorSchedule(chain, snap.Environment, number)
+				}
+				snap.recordSlash(schedule[number], validator, number, snap.Environment.Epoch(number))
+			}
 		}
 
 		if !exists {
 			return nil, errUnauthorizedValidator
 		}
+
+		// Track the validator and forget the ones out of the recency window
+		snap.Recents[number] = validator
+		limit := uint64(len(snap.Validators)/2 + 1)
+		for block := range snap.Recents {
+			if block+limit <= number {
+				delete(snap.Recents, block)
+			}
+		}
 	}
 	snap.Number += uint64(len(headers))
 	snap.Hash = headers[len(headers)-1].Hash()
@@ -162,6 +269,153 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 	return snap, nil
 }
 
+// recentSlashes is the minimum number of slashes remembered per operator.
+const recentSlashes = 16
+
+// slashEntry is a block an operator was slashed at, along with its epoch.
+type slashEntry struct {
+	Number uint64 `json:"number"`
+	Epoch  uint64 `json:"epoch"`
+}
+
+// outOfTurn reports whether the header was sealed out-of-turn past the first
+// epoch, in which case the validator scheduled for it is slashed unless it
+// sealed the block itself.
+func (s *Snapshot) outOfTurn(header *types.Header) bool {
+	return header.Number.Uint64() >= s.config.Epoch && header.Difficulty.Cmp(diffInTurn) != 0
+}
+
+// recordSlash tracks the block and epoch the scheduled validator missed its turn
+// at, if sealed by another one. Slashing being paused on a node doesn't change
+// the tracked slashes, so that they stay the same on every node.
+func (s *Snapshot) recordSlash(scheduled, signer common.Address, number, epoch uint64) {
+	if scheduled == signer {
+		return
+	}
+	limit := s.config.SlashEscalationMax
+	if limit < recentSlashes {
+		limit = recentSlashes
+	}
+	slashes := append(s.Slashes[scheduled], slashEntry{Number: number, Epoch: epoch})
+	if uint64(len(slashes)) > limit {
+		slashes = slashes[uint64(len(slashes))-limit:]
+	}
+	s.Slashes[scheduled] = slashes
+}
+
+// slashEscalation returns the multiplier of the blocks the operator is slashed
+// for at the block following the snapshot: one more than the number of times it
+// was slashed since the escalation fork and its last clean epoch, capped at the
+// configured maximum.
+func (s *Snapshot) slashEscalation(operator common.Address, epoch uint64) uint64 {
+	if s.config.SlashEscalationMax <= 1 || !s.config.IsSlashEscalation(new(big.Int).SetUint64(s.Number+1)) {
+		return 1
+	}
+	multiplier := uint64(1)
+	slashes := s.Slashes[operator]
+	for i := len(slashes) - 1; i >= 0 && multiplier < s.config.SlashEscalationMax; i-- {
+		if !s.config.IsSlashEscalation(new(big.Int).SetUint64(slashes[i].Number)) || slashes[i].Epoch+1 < epoch {
+			break // A clean epoch resets the escalation
+		}
+		epoch = slashes[i].Epoch
+		multiplier++
+	}
+	return multiplier
+}
+
+// epochTransition is the validator set and environment value which take effect
+// at an epoch boundary block.
+type epochTransition struct {
+	epoch      uint64
+	candidates *getNextValidatorsResult // Candidates the validators were selected from
+	validators *getNextValidatorsResult
+	env        *environmentValue
+	fallback   bool // Whether env is the previous value, the next one being future dated
+	err        error
+}
+
+// fetchEpochTransition retrieves the epoch transition taking effect at the given
+// header from the system contracts. The current environment value is kept if the
+// next one isn't in effect yet.
+func (s *Snapshot) fetchEpochTransition(header *types.Header, epoch uint64, current *environmentValue) *epochTransition {
+	number := header.Number.Uint64()
+	transition := &epochTransition{epoch: epoch}
+
+	next, err := getNextEnvironmentValue(s.ethAPI, header.ParentHash)
+	if err != nil {
+		log.Error("Failed to get environment value", "in", "Snapshot.apply", "hash", header.ParentHash, "number", number, "err", err)
+		transition.err = err
+		return transition
+	}
+	transition.env = activeEnvironment(current, next, number)
+	transition.fallback = transition.env != next
+
+	validators, err := getNextValidatorsPaged(s.ethAPI, header.ParentHash, epoch, validatorThreshold(s.config, transition.env, number), s.settings().pageSize())
+	if err != nil {
+		log.Error("Failed to get validators", "in", "Snapshot.apply", "hash", header.ParentHash, "number", number, "err", err)
+		transition.err = err
+		return transition
+	}
+	if validators, err = withAllowlist(s.ethAPI, s.config, number, header.ParentHash, withUniqueOperators(s.config, number, validators)); err != nil {
+		log.Error("Failed to get allowlist", "in", "Snapshot.apply", "hash", header.ParentHash, "number", number, "err", err)
+		transition.err = err
+		return transition
+	}
+	transition.candidates = validators
+	transition.validators = selectValidators(s.config, number, validators)
+	return transition
+}
+
+// prefetchTransitions concurrently retrieves the epoch transitions of the headers
+// which are epoch boundaries under the current environment, bounded by the number
+// of configured workers. The results are keyed by header hash so they can never
+// leak across forks; boundaries shifted by an environment change in between are
+// left for apply to retrieve in order. In archive mode, no workers are started.
+func (s *Snapshot) prefetchTransitions(headers []*types.Header) map[common.Hash]*epochTransition {
+	workers := s.settings().workers()
+	if workers <= 1 || s.config.ArchiveMode {
+		return nil
+	}
+	var (
+		period     = s.Environment.EpochPeriod.Uint64()
+		boundaries []*types.Header
+	)
+	for _, header := range headers {
+		if number := header.Number.Uint64(); number > 0 && number%period == 0 && s.config.IsOasys(header.Number) {
+			boundaries = append(boundaries, header)
+		}
+	}
+	if len(boundaries) < 2 {
+		return nil
+	}
+
+	var (
+		results = make([]*epochTransition, len(boundaries))
+		limit   = make(chan struct{}, workers)
+		wg      sync.WaitGroup
+	)
+	for i, header := range boundaries {
+		i, header := i, header
+
+		wg.Add(1)
+		limit <- struct{}{}
+		goWithLabel("oasys-snapshot", func() {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			results[i] = s.fetchEpochTransition(header, s.Environment.Epoch(header.Number.Uint64()), s.Environment)
+		})
+	}
+	wg.Wait()
+
+	prefetched := make(map[common.Hash]*epochTransition, len(boundaries))
+	for i, header := range boundaries {
+		prefetched[header.Hash()] = results[i]
+	}
+	return prefetched
+}
+
 // validators retrieves the list of authorized validators in ascending order.
 func (s *Snapshot) validators() []common.Address {
 	validators := make([]common.Address, 0, len(s.Validators))
@@ -172,6 +426,18 @@ func (s *Snapshot) validators() []common.Address {
 	return validators
 }
 
+// recentlySigned reports whether the validator sealed any of the len(active)/2+1
+// blocks preceding the given one.
+func (s *Snapshot) recentlySigned(validator common.Address, number uint64, active int) bool {
+	limit := uint64(active/2 + 1)
+	for block, recent := range s.Recents {
+		if recent == validator && block+limit > number {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Snapshot) exists(validator common.Address) bool {
 	_, ok := s.Validators[validator]
 	return ok
@@ -179,7 +445,7 @@ func (s *Snapshot) exists(validator common.Address) bool {
 
 func (s *Snapshot) getValidatorSchedule(chain consensus.ChainHeaderReader, env *environmentValue, number uint64) map[uint64]common.Address {
 	validators, stakes := s.validatorsToTuple()
-	return getValidatorSchedule(chain, validators, stakes, env, number)
+	return getValidatorSchedule(chain, s.config, validators, stakes, env, number)
 }
 
 func (s *Snapshot) backOffTime(chain consensus.ChainHeaderReader, env *environmentValue, number uint64, validator common.Address) uint64 {
@@ -187,7 +453,7 @@ func (s *Snapshot) backOffTime(chain consensus.ChainHeaderReader, env *environme
 		return 0
 	}
 	validators, stakes := s.validatorsToTuple()
-	return backOffTime(chain, validators, stakes, env, number, validator)
+	return jitteredBackoff(chain, s.config, validators, stakes, env, number, validator)
 }
 
 func (s *Snapshot) validatorsToTuple() ([]common.Address, []*big.Int) {
@@ -0,0 +1,455 @@
+package oasys
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestSnapshotParallelApply(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSnapshotTestChain(key, 200)
+
+	serial, err := applySnapshotTestChain(key, headers, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to apply headers serially: %v", err)
+	}
+	parallel, err := applySnapshotTestChain(key, headers, 4, 0)
+	if err != nil {
+		t.Fatalf("failed to apply headers in parallel: %v", err)
+	}
+
+	want, _ := json.Marshal(serial)
+	got, _ := json.Marshal(parallel)
+	if !bytes.Equal(got, want) {
+		t.Errorf("snapshot mismatch\ngot:  %s\nwant: %s", got, want)
+	}
+	if serial.Number != 200 {
+		t.Errorf("snapshot number, got %v, want 200", serial.Number)
+	}
+	if stake := serial.Validators[crypto.PubkeyToAddress(key.PublicKey)]; stake == nil || stake.Uint64() != 21 {
+		t.Errorf("validator stake, got %v, want 21", stake)
+	}
+}
+
+func BenchmarkSnapshotApplySerial(b *testing.B)   { benchmarkSnapshotApply(b, 0) }
+func BenchmarkSnapshotApplyParallel(b *testing.B) { benchmarkSnapshotApply(b, 8) }
+
+func benchmarkSnapshotApply(b *testing.B, workers int) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSnapshotTestChain(key, 400)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := applySnapshotTestChain(key, headers, workers, time.Millisecond); err != nil {
+			b.Fatalf("failed to apply headers: %v", err)
+		}
+	}
+}
+
+func TestSnapshotBootstrapValidators(t *testing.T) {
+	bootstrapKey, _ := crypto.GenerateKey()
+	validatorKey, _ := crypto.GenerateKey()
+
+	var (
+		bootstrap = crypto.PubkeyToAddress(bootstrapKey.PublicKey)
+		validator = crypto.PubkeyToAddress(validatorKey.PublicKey)
+		config    = &params.OasysConfig{Period: 0, Epoch: 10, BootstrapValidators: []common.Address{bootstrap}}
+		ethAPI    = &testEpochBlockchainAPI{validator: validator, activation: 4}
+		sigcache  *countingCache
+	)
+	sigcache = newCountingCache(inmemorySignatures)
+
+	// The bootstrap validator seals until the StakeManager reports the real
+	// validator at epoch 4 (block 30)
+	parent := &types.Header{Number: common.Big0, Difficulty: diffInTurn}
+	headers := make([]*types.Header, 40)
+	for i := range headers {
+		key := bootstrapKey
+		if i+1 >= 30 {
+			key = validatorKey
+		}
+		headers[i] = makeSignedTestHeader(parent, diffInTurn, key)
+		parent = headers[i]
+	}
+	genesis := newSnapshot(config, sigcache, ethAPI, 0, headers[0].ParentHash, config.BootstrapValidators, getInitialEnvironment(config))
+
+	snap, err := genesis.apply(headers[:29], nil)
+	if err != nil {
+		t.Fatalf("failed to apply bootstrap headers: %v", err)
+	}
+	if !snap.exists(bootstrap) || snap.exists(validator) {
+		t.Errorf("bootstrap validators, got %v, want %v", snap.validators(), []common.Address{bootstrap})
+	}
+
+	snap, err = genesis.apply(headers, nil)
+	if err != nil {
+		t.Fatalf("failed to apply headers: %v", err)
+	}
+	if snap.exists(bootstrap) || !snap.exists(validator) {
+		t.Errorf("validators, got %v, want %v", snap.validators(), []common.Address{validator})
+	}
+
+	// Once the real validator took over, the bootstrap validator can't seal anymore
+	late := makeSignedTestHeader(headers[len(headers)-1], diffInTurn, bootstrapKey)
+	if _, err := snap.apply([]*types.Header{late}, nil); err != errUnauthorizedValidator {
+		t.Errorf("bootstrap validator after takeover, got %v, want %v", err, errUnauthorizedValidator)
+	}
+}
+
+func TestGenesisSignerBootstrap(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// No validator registers before epoch 3 (block 20), the genesis signer alone
+	// seals the blocks before
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(3, validators, stakes)
+
+	// The genesis signers are read from the database the engine is created with
+	db := rawdb.NewMemoryDatabase()
+	rawdb.WriteHeader(db, headers[0])
+	rawdb.WriteCanonicalHash(db, headers[0].Hash(), 0)
+	engine := New(chain.Config(), config, db, nil)
+	engine.ethAPI = backend
+	if want := []common.Address{crypto.PubkeyToAddress(key.PublicKey)}; !reflect.DeepEqual(engine.config.BootstrapValidators, want) {
+		t.Fatalf("bootstrap validators, got %v, want %v", engine.config.BootstrapValidators, want)
+	}
+	if len(config.BootstrapValidators) != 0 {
+		t.Errorf("config modified, got bootstrap validators %v", config.BootstrapValidators)
+	}
+
+	for _, header := range headers[1:20] {
+		if err := engine.verifySeal(chain, header, nil); err != nil {
+			t.Fatalf("block %d: failed to verify: %v", header.Number, err)
+		}
+	}
+
+	// The registered validators take over at epoch 3
+	if err := engine.verifySeal(chain, headers[20], nil); err != errUnauthorizedValidator {
+		t.Errorf("genesis signer after takeover, got %v, want %v", err, errUnauthorizedValidator)
+	}
+}
+
+func TestGenesisStakeManagerValidators(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	stake := new(big.Int).Mul(big.NewInt(10_000_000), ether)
+
+	// The genesis carries no validator list, the StakeManager alloc does
+	genesis := &types.Header{
+		Number:     common.Big0,
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis})
+
+	config := &params.OasysConfig{Period: 1, Epoch: 10}
+	backend := newTestStakeManager(getInitialEnvironment(config))
+	backend.register(1, []common.Address{validator}, []*big.Int{stake})
+
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	engine.Authorize(validator, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}, nil)
+
+	snap, err := engine.snapshot(chain, 0, genesis.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to get genesis snapshot: %v", err)
+	}
+	if got := snap.Validators[validator]; got == nil || got.Cmp(stake) != 0 {
+		t.Errorf("genesis validator stake, got %v, want %v", got, stake)
+	}
+
+	// The registered validator seals block 1
+	block := types.NewBlockWithHeader(makeSignedTestHeader(genesis, diffInTurn, key))
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, block, results, make(chan struct{})); err != nil {
+		t.Fatalf("failed to seal block 1: %v", err)
+	}
+	if sealed := <-results; sealed.Coinbase() != validator {
+		t.Errorf("block 1 sealer, got %v, want %v", sealed.Coinbase(), validator)
+	}
+}
+
+func TestLoadCorruptSnapshot(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+
+	genesis := &types.Header{
+		Number:     common.Big0,
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+common.AddressLength+extraSeal),
+	}
+	copy(genesis.Extra[extraVanity:], validator.Bytes())
+	chain := newTestChainReaderWithHeaders([]*types.Header{genesis})
+
+	config := &params.OasysConfig{Period: 0, Epoch: 10}
+	valid, _ := json.Marshal(newSnapshot(config, nil, nil, 0, genesis.Hash(), []common.Address{validator}, getInitialEnvironment(config)))
+
+	testCases := map[string][]byte{
+		"garbage":        {0xde, 0xad, 0xbe, 0xef},
+		"truncated":      valid[:len(valid)/2],
+		"empty":          []byte("{}"),
+		"no environment": bytes.Replace(valid, []byte(`"environment"`), []byte(`"unknown"`), 1),
+	}
+	for name, blob := range testCases {
+		db := rawdb.NewMemoryDatabase()
+		if err := db.Put(snapshotKey(genesis.Hash()), blob); err != nil {
+			t.Fatalf("%s: failed to write snapshot: %v", name, err)
+		}
+		if _, err := loadSnapshot(config, nil, nil, db, genesis.Hash()); !errors.Is(err, errCorruptSnapshot) {
+			t.Errorf("%s: load error, got %v, want %v", name, err, errCorruptSnapshot)
+		}
+
+		// The engine rebuilds the snapshot and replaces the corrupt entry
+		engine := New(chain.Config(), config, db, nil)
+		snap, err := engine.snapshot(chain, 0, genesis.Hash(), nil)
+		if err != nil {
+			t.Fatalf("%s: failed to rebuild snapshot: %v", name, err)
+		}
+		if !snap.exists(validator) {
+			t.Errorf("%s: validators, got %v, want %v", name, snap.validators(), []common.Address{validator})
+		}
+		if _, err := loadSnapshot(config, nil, nil, db, genesis.Hash()); err != nil {
+			t.Errorf("%s: failed to load rebuilt snapshot: %v", name, err)
+		}
+	}
+}
+
+func TestSnapshotSlashes(t *testing.T) {
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 2)
+		addrs = make([]common.Address, 2)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+
+	// Only the second validator has any stake, so every block is its turn
+	config := &params.OasysConfig{Period: 0, Epoch: 100}
+	base := &types.Header{Number: big.NewInt(100), Difficulty: diffInTurn}
+	chain := newTestChainReaderWithHeaders([]*types.Header{base})
+	snap := newSnapshot(config, newCountingCache(inmemorySignatures), nil, 100, base.Hash(), addrs, getInitialEnvironment(config))
+	snap.Validators[addrs[1]] = new(big.Int).Mul(big.NewInt(10), ether)
+
+	// The first validator sealing out-of-turn slashes the second one
+	block101 := makeSignedTestHeader(base, diffNoTurn, keys[0])
+	block102 := makeSignedTestHeader(block101, diffInTurn, keys[1])
+	block103 := makeSignedTestHeader(block102, diffNoTurn, keys[0])
+	canonical, err := snap.apply([]*types.Header{block101, block102, block103}, chain)
+	if err != nil {
+		t.Fatalf("failed to apply canonical headers: %v", err)
+	}
+	want := []slashEntry{{Number: 101, Epoch: 2}, {Number: 103, Epoch: 2}}
+	if got := canonical.Slashes[addrs[1]]; !reflect.DeepEqual(got, want) {
+		t.Errorf("canonical slashes, got %v, want %v", got, want)
+	}
+	if len(snap.Slashes) != 0 {
+		t.Errorf("parent snapshot slashes, got %v, want none", snap.Slashes)
+	}
+
+	// A fork replacing block 103 by an in-turn block keeps the first slash only
+	fork, err := snap.apply([]*types.Header{block101, block102, makeSignedTestHeader(block102, diffInTurn, keys[1])}, chain)
+	if err != nil {
+		t.Fatalf("failed to apply fork headers: %v", err)
+	}
+	if got := fork.Slashes[addrs[1]]; !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("fork slashes, got %v, want %v", got, want[:1])
+	}
+
+	// The slashes survive a restart
+	db := rawdb.NewMemoryDatabase()
+	if err := canonical.store(db); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	loaded, err := loadSnapshot(config, nil, nil, db, canonical.Hash)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if got := loaded.Slashes[addrs[1]]; !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded slashes, got %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotFutureEnvironment(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 25)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	// The value returned at block 10 only starts at block 30
+	config := &params.OasysConfig{Period: 3, Epoch: 10}
+	engine := New(chain.Config(), config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = &testEpochBlockchainAPI{
+		validator: validator,
+		nextValues: map[common.Hash]func(env *environmentValue){
+			headers[9].Hash(): func(env *environmentValue) {
+				env.StartBlock, env.StartEpoch, env.BlockPeriod = big.NewInt(30), big.NewInt(4), big.NewInt(7)
+			},
+		},
+	}
+
+	for _, number := range []uint64{10, 15, 19} {
+		env, err := engine.environment(chain, headers[number], nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to get environment: %v", number, err)
+		}
+		if env.StartBlock.Uint64() != 0 || env.BlockPeriod.Uint64() != config.Period {
+			t.Errorf("block %d: environment, got start %v period %v, want start 0 period %v", number, env.StartBlock, env.BlockPeriod, config.Period)
+		}
+		if epoch := env.Epoch(number); epoch != 2 {
+			t.Errorf("block %d: epoch, got %v, want 2", number, epoch)
+		}
+	}
+
+	// The next boundary picks up the contract value again
+	env, err := engine.environment(chain, headers[20], nil)
+	if err != nil {
+		t.Fatalf("block 20: failed to get environment: %v", err)
+	}
+	if env.BlockPeriod.Uint64() != 0 {
+		t.Errorf("block 20: period, got %v, want 0", env.BlockPeriod)
+	}
+}
+
+// countingDatabase is a database counting the values written to it.
+type countingDatabase struct {
+	ethdb.Database
+	puts int
+}
+
+func (db *countingDatabase) Put(key []byte, value []byte) error {
+	db.puts++
+	return db.Database.Put(key, value)
+}
+
+func TestArchiveMode(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	headers := makeSignedTestChain(key, 5)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	for _, archive := range []bool{false, true} {
+		db := &countingDatabase{Database: rawdb.NewMemoryDatabase()}
+		engine := New(chain.Config(), &params.OasysConfig{Period: 0, Epoch: 10, ArchiveMode: archive}, db, nil)
+		for _, header := range headers[1:] {
+			if err := engine.verifySeal(chain, header, nil); err != nil {
+				t.Fatalf("archive %v: block %d: failed to verify: %v", archive, header.Number, err)
+			}
+		}
+		if archive && db.puts != 0 {
+			t.Errorf("snapshot writes in archive mode, got %d, want 0", db.puts)
+		}
+		if !archive && db.puts == 0 {
+			t.Error("genesis snapshot not stored outside of archive mode")
+		}
+	}
+}
+
+// makeSnapshotTestChain creates a chain of headers sealed by the given key, on
+// top of an empty genesis.
+func makeSnapshotTestChain(key *ecdsa.PrivateKey, length int) []*types.Header {
+	parent := &types.Header{Number: common.Big0, Difficulty: diffInTurn}
+	headers := make([]*types.Header, length)
+	for i := range headers {
+		headers[i] = makeSignedTestHeader(parent, diffInTurn, key)
+		parent = headers[i]
+	}
+	return headers
+}
+
+// applySnapshotTestChain rebuilds the snapshot of the given headers from a genesis
+// snapshot with an epoch period of 10 blocks.
+func applySnapshotTestChain(key *ecdsa.PrivateKey, headers []*types.Header, workers int, delay time.Duration) (*Snapshot, error) {
+	var (
+		validator = crypto.PubkeyToAddress(key.PublicKey)
+		config    = &params.OasysConfig{Period: 0, Epoch: 10, SnapshotWorkers: workers}
+		ethAPI    = &testEpochBlockchainAPI{validator: validator, delay: delay}
+		sigcache  *countingCache
+	)
+	sigcache = newCountingCache(inmemorySignatures)
+
+	snap := newSnapshot(config, sigcache, ethAPI, 0, headers[0].ParentHash, []common.Address{validator}, getInitialEnvironment(config))
+	return snap.apply(headers, nil)
+}
+
+// testEpochBlockchainAPI is a stateless system contract backend, returning the
+// given validator with a stake equal to the requested epoch, starting from the
+// activation epoch. The validator may be owned by another address and rotate to
+// another operator from a given epoch. The next environment value can be modified
+// per block hash.
+type testEpochBlockchainAPI struct {
+	validator  common.Address
+	activation uint64
+	delay      time.Duration
+	nextValues map[common.Hash]func(env *environmentValue)
+
+	owner    common.Address
+	rotation uint64
+	rotated  common.Address
+}
+
+func (p *testEpochBlockchainAPI) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	time.Sleep(p.delay)
+
+	data := *args.Data
+	switch {
+	case bytes.Equal(data[:4], stakeManager.abi.Methods["getValidators"].ID):
+		method := stakeManager.abi.Methods["getValidators"]
+		inputs, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			return nil, err
+		}
+		epoch, cursor := inputs[0].(*big.Int), inputs[1].(*big.Int)
+		if cursor.Sign() > 0 || epoch.Uint64() < p.activation {
+			return method.Outputs.Pack([]common.Address{}, []common.Address{}, []*big.Int{}, []bool{}, cursor)
+		}
+		owner, operator := p.validator, p.validator
+		if p.owner != (common.Address{}) {
+			owner = p.owner
+		}
+		if p.rotation > 0 && epoch.Uint64() >= p.rotation {
+			operator = p.rotated
+		}
+		return method.Outputs.Pack([]common.Address{owner}, []common.Address{operator}, []*big.Int{epoch}, []bool{true}, common.Big1)
+
+	case bytes.Equal(data[:4], environment.abi.Methods["nextValue"].ID):
+		uint256Ty, _ := abi.NewType("uint256", "", nil)
+		arguments := abi.Arguments{}
+		for i := 0; i < 9; i++ {
+			arguments = append(arguments, abi.Argument{Type: uint256Ty})
+		}
+		env := getInitialEnvironment(&params.OasysConfig{Period: 0, Epoch: 10})
+		env.ValidatorThreshold = common.Big0
+		if hash, ok := blockNrOrHash.Hash(); ok {
+			if modify, ok := p.nextValues[hash]; ok {
+				modify(env)
+			}
+		}
+		return arguments.Pack(env.StartBlock, env.StartEpoch, env.BlockPeriod, env.EpochPeriod, env.RewardRate,
+			env.CommissionRate, env.ValidatorThreshold, env.JailThreshold, env.JailPeriod)
+	}
+	return nil, errors.New("unexpected call")
+}
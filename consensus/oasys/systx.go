@@ -0,0 +1,156 @@
+package oasys
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Order of the built-in system transaction kinds within a block.
+const (
+	systemTxOrderInit   = 100
+	systemTxOrderReward = 200
+	systemTxOrderSlash  = 300
+)
+
+// systemTxBlock is the block whose system transactions are being applied, either
+// verified against the ones it carries or assembled by the local signer.
+type systemTxBlock struct {
+	chain    consensus.ChainHeaderReader
+	header   *types.Header
+	state    *state.StateDB
+	cx       core.ChainContext
+	env      *environmentValue
+	schedule map[uint64]common.Address
+
+	txs       *[]*types.Transaction
+	receipts  *[]*types.Receipt
+	systemTxs *[]*types.Transaction // System transactions carried by the block, nil if mining
+	usedGas   *uint64
+	mining    bool
+	in        string // Engine method applying them, for the logs
+}
+
+// systemTxKind is a kind of system transaction the engine issues, applied to
+// every block in the given order, then by name. Kinds apply nothing to the
+// blocks they don't concern.
+type systemTxKind struct {
+	name  string
+	order int
+	apply func(c *Oasys, block *systemTxBlock) error
+}
+
+// defaultSystemTxKinds returns the system transaction kinds of the protocol: the
+// initialization of the system contracts, the rewards of the epoch and the
+// slash of the validator missing its turn.
+func defaultSystemTxKinds() []*systemTxKind {
+	return []*systemTxKind{
+		{name: "init", order: systemTxOrderInit, apply: (*Oasys).applyInitSystemTxs},
+		{name: "reward", order: systemTxOrderReward, apply: (*Oasys).applyRewardSystemTx},
+		{name: "slash", order: systemTxOrderSlash, apply: (*Oasys).applySlashSystemTx},
+	}
+}
+
+// registerSystemTxKind adds a kind of system transaction to the ones applied to
+// every block. As the system transactions are part of consensus, all the nodes
+// of a network must register the same kinds.
+func (c *Oasys) registerSystemTxKind(kind *systemTxKind) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, known := range c.systemTxKinds {
+		if known.name == kind.name {
+			return fmt.Errorf("system transaction kind %q already registered", kind.name)
+		}
+	}
+	kinds := append(append([]*systemTxKind{}, c.systemTxKinds...), kind)
+	sort.SliceStable(kinds, func(i, j int) bool {
+		if kinds[i].order != kinds[j].order {
+			return kinds[i].order < kinds[j].order
+		}
+		return kinds[i].name < kinds[j].name
+	})
+	c.systemTxKinds = kinds
+	return nil
+}
+
+// applySystemTxs applies the system transactions of every registered kind to the
+// block, stopping at the first failing kind.
+func (c *Oasys) applySystemTxs(block *systemTxBlock) error {
+	c.lock.RLock()
+	kinds := c.systemTxKinds
+	c.lock.RUnlock()
+
+	for _, kind := range kinds {
+		if err := kind.apply(c, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyInitSystemTxs initializes the system contracts at the first Oasys block.
+func (c *Oasys) applyInitSystemTxs(block *systemTxBlock) error {
+	number := block.header.Number.Uint64()
+	if !c.isFirstOasysBlock(number) {
+		return nil
+	}
+	err := c.initializeSystemContracts(block.state, block.header, block.cx, block.txs, block.receipts, block.systemTxs, block.usedGas, block.mining)
+	if err != nil {
+		log.Error("Failed to initialize system contracts", "in", block.in, "hash", block.header.Hash(), "number", number, "err", err)
+	}
+	return err
+}
+
+// applyRewardSystemTx credits the rewards of the epoch just ended to the
+// StakeManager at epoch blocks, without any transaction.
+func (c *Oasys) applyRewardSystemTx(block *systemTxBlock) error {
+	number := block.header.Number.Uint64()
+	if !block.env.IsEpoch(number) || block.env.Epoch(number) <= 2 {
+		return nil
+	}
+	err := c.addBalanceToStakeManager(block.chain, block.state, block.header)
+	if err != nil {
+		log.Error("Failed to add balance to staking contract", "in", block.in, "hash", block.header.ParentHash, "number", number, "err", err)
+	}
+	return err
+}
+
+// applySlashSystemTx slashes the scheduled validator of an out-of-turn block. A
+// failed slash is only logged, leaving the slash transaction of a verified block
+// unexpected.
+func (c *Oasys) applySlashSystemTx(block *systemTxBlock) error {
+	header, number := block.header, block.header.Number.Uint64()
+	if number < c.config.Epoch || header.Difficulty.Cmp(diffInTurn) == 0 {
+		return nil
+	}
+	validator := header.Coinbase
+	if !block.mining {
+		var err error
+		if validator, err = ecrecover(c.config, header, c.signatures); err != nil {
+			return err
+		}
+	}
+	expected := block.schedule[number]
+	if validator == expected {
+		return nil
+	}
+	if c.SlashingPaused() {
+		log.Warn("Skipping slash while slashing is paused", "in", block.in, "hash", header.Hash(), "number", number, "address", expected)
+		return nil
+	}
+	snap, err := c.snapshot(block.chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if err := c.slash(expected, snap, block.schedule, block.env, block.state, header, block.cx, block.txs, block.receipts, block.systemTxs, block.usedGas, block.mining); err != nil {
+		log.Error("Failed to slash validator", "in", block.in, "hash", header.Hash(), "number", number, "address", expected, "err", err)
+	}
+	return nil
+}
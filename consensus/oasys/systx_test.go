@@ -0,0 +1,60 @@
+package oasys
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSystemTxKinds(t *testing.T) {
+	wallets, accounts, err := makeWallets(1)
+	if err != nil {
+		t.Fatalf("failed to create test wallets: %v", err)
+	}
+
+	env, err := makeEnv(*wallets[0], *accounts[0])
+	if err != nil {
+		t.Fatalf("failed to create test env: %v", err)
+	}
+
+	// Custom kinds around the initialization record the system transactions
+	// applied before them
+	var applied []string
+	record := func(name string) func(c *Oasys, block *systemTxBlock) error {
+		return func(c *Oasys, block *systemTxBlock) error {
+			applied = append(applied, fmt.Sprintf("%s mining=%v txs=%d", name, block.mining, len(*block.txs)))
+			return nil
+		}
+	}
+	for _, kind := range []*systemTxKind{
+		{name: "late", order: systemTxOrderInit + 1, apply: record("late")},
+		{name: "early", order: systemTxOrderInit - 1, apply: record("early")},
+	} {
+		if err := env.engine.registerSystemTxKind(kind); err != nil {
+			t.Fatalf("failed to register %s: %v", kind.name, err)
+		}
+	}
+	if err := env.engine.registerSystemTxKind(&systemTxKind{name: "slash", apply: record("slash")}); err == nil {
+		t.Error("duplicate kind registered")
+	}
+
+	var names []string
+	for _, kind := range env.engine.systemTxKinds {
+		names = append(names, kind.name)
+	}
+	if want := []string{"early", "init", "late", "reward", "slash"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("kinds, got %v, want %v", names, want)
+	}
+
+	// Block 1 initializes the system contracts, both when assembled and imported
+	if _, err := env.generateBlock(*wallets[0], *accounts[0], true); err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+	want := []string{
+		"early mining=true txs=0", "late mining=true txs=2",
+		"early mining=false txs=0", "late mining=false txs=2",
+	}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied, got %v, want %v", applied, want)
+	}
+}
@@ -0,0 +1,91 @@
+package oasys
+
+import (
+	"sort"
+	"sync"
+)
+
+// sealTimingSamples is the number of recent blocks the seal timing statistics
+// are computed over at most.
+const sealTimingSamples = 1024
+
+// sealTiming is a verified block along with the number of seconds it was sealed
+// after its slot opened.
+type sealTiming struct {
+	number uint64
+	delay  uint64
+}
+
+// sealTimingMonitor keeps the delay between the opening of the slot of the
+// recent blocks, backoff included, and their timestamp.
+type sealTimingMonitor struct {
+	lock    sync.Mutex
+	samples []sealTiming // Ring buffer of the recent delays
+	next    int          // Index of the oldest sample once the buffer is full
+	last    int          // Index of the latest sample
+}
+
+// observe records the delay of the given block. Blocks verified again right
+// after their first verification are only counted once.
+func (m *sealTimingMonitor) observe(number, delay uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.samples) > 0 && m.samples[m.last].number == number {
+		m.samples[m.last].delay = delay
+		return
+	}
+	sample := sealTiming{number: number, delay: delay}
+	if len(m.samples) < sealTimingSamples {
+		m.samples = append(m.samples, sample)
+		m.last = len(m.samples) - 1
+	} else {
+		m.samples[m.next] = sample
+		m.last = m.next
+		m.next = (m.next + 1) % sealTimingSamples
+	}
+}
+
+type sealTimingStats struct {
+	Samples int    `json:"samples"`
+	P50     uint64 `json:"p50"`
+	P90     uint64 `json:"p90"`
+	P99     uint64 `json:"p99"`
+	Max     uint64 `json:"max"`
+}
+
+// stats returns the percentiles of the delays of the given number of most recent
+// blocks, or all the recorded ones if zero.
+func (m *sealTimingMonitor) stats(window int) *sealTimingStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if window <= 0 || window > len(m.samples) {
+		window = len(m.samples)
+	}
+	delays := make([]uint64, 0, window)
+	for i := 0; i < window; i++ {
+		index := (m.last - i + len(m.samples)) % len(m.samples)
+		delays = append(delays, m.samples[index].delay)
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	stats := &sealTimingStats{Samples: len(delays)}
+	if len(delays) == 0 {
+		return stats
+	}
+	stats.P50 = percentile(delays, 50)
+	stats.P90 = percentile(delays, 90)
+	stats.P99 = percentile(delays, 99)
+	stats.Max = delays[len(delays)-1]
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []uint64, p int) uint64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
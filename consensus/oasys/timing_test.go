@@ -0,0 +1,47 @@
+package oasys
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSealTimingStats(t *testing.T) {
+	engine := New(params.AllOasysProtocolChanges, &params.OasysConfig{Period: 15, Epoch: 40}, rawdb.NewMemoryDatabase(), nil)
+	api := &API{oasys: engine}
+
+	if stats := api.GetSealTimingStats(0); stats.Samples != 0 {
+		t.Errorf("no blocks, got %+v", stats)
+	}
+
+	// A hundred blocks sealed 0 to 99 seconds late, in shuffled order
+	for i := uint64(0); i < 100; i++ {
+		engine.timing.observe(i+1, (i*37)%100)
+	}
+	// Verifying the latest block again replaces its sample
+	engine.timing.observe(100, 63)
+
+	stats := api.GetSealTimingStats(0)
+	want := sealTimingStats{Samples: 100, P50: 49, P90: 89, P99: 98, Max: 99}
+	if *stats != want {
+		t.Errorf("all blocks, got %+v, want %+v", *stats, want)
+	}
+
+	// The window only covers the latest blocks, sealed 63, 26 and 89 seconds late
+	stats = api.GetSealTimingStats(3)
+	want = sealTimingStats{Samples: 3, P50: 63, P90: 89, P99: 89, Max: 89}
+	if *stats != want {
+		t.Errorf("latest blocks, got %+v, want %+v", *stats, want)
+	}
+
+	// Old blocks are dropped once the buffer is full
+	for i := uint64(0); i < sealTimingSamples; i++ {
+		engine.timing.observe(1000+i, 5)
+	}
+	stats = api.GetSealTimingStats(0)
+	want = sealTimingStats{Samples: sealTimingSamples, P50: 5, P90: 5, P99: 5, Max: 5}
+	if *stats != want {
+		t.Errorf("after wrapping, got %+v, want %+v", *stats, want)
+	}
+}
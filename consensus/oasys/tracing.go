@@ -0,0 +1,65 @@
+package oasys
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tracer creates spans around the consensus operations, so that they can be
+// exported to a distributed tracing system such as OpenTelemetry by wrapping
+// its tracer.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced consensus operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+// Span attributes set by the engine
+const (
+	traceNumber    = "oasys.number"
+	traceSigner    = "oasys.signer"
+	traceInTurn    = "oasys.in_turn"
+	traceSystemTxs = "oasys.system_txs"
+)
+
+// noopTracer is the default Tracer, discarding all spans.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End()                                       {}
+
+// SetTracer sets the tracer the seal and finalize operations are reported to.
+// A nil tracer disables tracing.
+func (c *Oasys) SetTracer(tracer Tracer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	c.tracer = tracer
+}
+
+// startSpan starts a span of the given consensus operation on the header.
+func (c *Oasys) startSpan(name string, header *types.Header) Span {
+	c.lock.RLock()
+	tracer := c.tracer
+	c.lock.RUnlock()
+
+	_, span := tracer.Start(context.Background(), name)
+	span.SetAttribute(traceNumber, header.Number.Uint64())
+	span.SetAttribute(traceSigner, header.Coinbase)
+	span.SetAttribute(traceInTurn, header.Difficulty != nil && header.Difficulty.Cmp(diffInTurn) == 0)
+	return span
+}
@@ -0,0 +1,84 @@
+package oasys
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSealSpan(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	headers := makeSignedTestChain(key, 0)
+	chain := newTestChainReaderWithHeaders(headers)
+
+	engine := New(chain.Config(), &params.OasysConfig{Period: 1, Epoch: 10}, rawdb.NewMemoryDatabase(), nil)
+	engine.Authorize(signer, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}, nil)
+	tracer := new(testTracer)
+	engine.SetTracer(tracer)
+
+	block := types.NewBlockWithHeader(makeSignedTestHeader(headers[0], diffInTurn, key))
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, block, results, make(chan struct{})); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	<-results
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("spans, got %d, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.name != "oasys.Seal" || !span.ended {
+		t.Errorf("span, got %q (ended %v), want ended oasys.Seal", span.name, span.ended)
+	}
+	want := map[string]interface{}{
+		traceNumber:    uint64(1),
+		traceSigner:    signer,
+		traceInTurn:    true,
+		traceSystemTxs: 0,
+	}
+	for key, value := range want {
+		if span.attrs[key] != value {
+			t.Errorf("attribute %s, got %v, want %v", key, span.attrs[key], value)
+		}
+	}
+
+	// Disabling tracing stops recording spans
+	engine.SetTracer(nil)
+	engine.Seal(chain, block, results, make(chan struct{}))
+	if len(tracer.spans) != 1 {
+		t.Errorf("spans after disabling tracing, got %d, want 1", len(tracer.spans))
+	}
+}
+
+// testTracer is a Tracer recording the spans in memory.
+type testTracer struct {
+	lock  sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	span := &testSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	ended bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) End()                                       { s.ended = true }
@@ -0,0 +1,92 @@
+package oasys
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// defaultValidatorPageSize is the number of validators read per StakeManager
+// call unless configured otherwise.
+const defaultValidatorPageSize = 200
+
+// errConsensusTunable is returned when trying to change a consensus-critical
+// field of the configuration at runtime.
+var errConsensusTunable = errors.New("consensus-critical field can't be changed at runtime")
+
+// consensusFields are the fields of the configuration every node of a network
+// must agree on, refused by setTunable.
+var consensusFields = map[string]bool{
+	"period":                          true,
+	"epoch":                           true,
+	"oasysBlock":                      true,
+	"sealScheme":                      true,
+	"sealSchemeBlock":                 true,
+	"chainIdSealBlock":                true,
+	"validatorRootBlock":              true,
+	"compressedExtraBlock":            true,
+	"signerDiversityBlock":            true,
+	"backoffJitter":                   true,
+	"backoffJitterBlock":              true,
+	"backoffTieBreakBlock":            true,
+	"boundarySignerBlock":             true,
+	"scheduleV2Block":                 true,
+	"validatorThresholdBlock":         true,
+	"uniqueOperatorsBlock":            true,
+	"slashEscalationMax":              true,
+	"slashEscalationBlock":            true,
+	"minEpochsBetweenSetChanges":      true,
+	"minEpochsBetweenSetChangesBlock": true,
+	"activationDelayEpochs":           true,
+	"activationDelayBlock":            true,
+	"maxValidators":                   true,
+	"maxValidatorsBlock":              true,
+	"permissionedValidatorsBlock":     true,
+	"minEpochPeriod":                  true,
+	"maxEpochPeriod":                  true,
+	"trustedCheckpoint":               true,
+}
+
+// tunables are the settings of the engine which don't affect consensus, so can
+// be changed at runtime through oasys_setTunable. The fields are accessed
+// atomically.
+type tunables struct {
+	validatorPageSize uint64 // Number of validators read per StakeManager call
+	snapshotWorkers   uint64 // Number of concurrent epoch lookups while rebuilding snapshots
+}
+
+// newTunables returns the tunables initially set in the config.
+func newTunables(config *params.OasysConfig) *tunables {
+	t := &tunables{validatorPageSize: config.ValidatorPageSize}
+	if t.validatorPageSize == 0 {
+		t.validatorPageSize = defaultValidatorPageSize
+	}
+	if config.SnapshotWorkers > 0 {
+		t.snapshotWorkers = uint64(config.SnapshotWorkers)
+	}
+	return t
+}
+
+func (t *tunables) pageSize() uint64 { return atomic.LoadUint64(&t.validatorPageSize) }
+func (t *tunables) workers() uint64  { return atomic.LoadUint64(&t.snapshotWorkers) }
+
+// set changes the tunable with the given configuration name.
+func (t *tunables) set(name string, value uint64) error {
+	switch name {
+	case "validatorPageSize":
+		if value == 0 {
+			return errors.New("validator page size must be positive")
+		}
+		atomic.StoreUint64(&t.validatorPageSize, value)
+	case "snapshotWorkers":
+		atomic.StoreUint64(&t.snapshotWorkers, value)
+	default:
+		if consensusFields[name] {
+			return fmt.Errorf("%w: %s", errConsensusTunable, name)
+		}
+		return fmt.Errorf("unknown tunable %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package oasys
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSetTunable(t *testing.T) {
+	config := &params.OasysConfig{Period: 0, Epoch: 40}
+	env := getInitialEnvironment(config)
+	backend := newTestStakeManager(env)
+	backend.register(1, validators, stakes)
+
+	engine := New(params.AllOasysProtocolChanges, config, rawdb.NewMemoryDatabase(), nil)
+	engine.ethAPI = backend
+	api := &API{oasys: engine}
+
+	if _, err := engine.getNextValidators(nil, common.Hash{}, env, 0, nil); err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if want := []int64{defaultValidatorPageSize, defaultValidatorPageSize}; !reflect.DeepEqual(backend.pageSizes, want) {
+		t.Errorf("default page sizes, got %v, want %v", backend.pageSizes, want)
+	}
+
+	// The next read pages by the new size
+	if err := api.SetTunable("validatorPageSize", 3); err != nil {
+		t.Fatalf("failed to set the validator page size: %v", err)
+	}
+	backend.pageSizes = nil
+	got, err := engine.getNextValidators(nil, common.Hash{}, env, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to call getNextValidators: %v", err)
+	}
+	if want := []int64{3, 3, 3}; !reflect.DeepEqual(backend.pageSizes, want) {
+		t.Errorf("page sizes, got %v, want %v", backend.pageSizes, want)
+	}
+	if !reflect.DeepEqual(got.Operators, validators) {
+		t.Errorf("validators read by pages of 3, got %v, want %v", got.Operators, validators)
+	}
+
+	// Consensus-critical, unknown and invalid settings are refused
+	if err := api.SetTunable("epoch", 100); !errors.Is(err, errConsensusTunable) {
+		t.Errorf("changing the epoch, got %v, want %v", err, errConsensusTunable)
+	}
+	if err := api.SetTunable("unknown", 1); err == nil {
+		t.Error("unknown tunable accepted")
+	}
+	if err := api.SetTunable("validatorPageSize", 0); err == nil {
+		t.Error("empty page size accepted")
+	}
+	if size := engine.tunables.pageSize(); size != 3 {
+		t.Errorf("page size after refused changes, got %d, want 3", size)
+	}
+}
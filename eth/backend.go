@@ -504,6 +504,7 @@ func (s *Ethereum) StartMining(threads int) error {
 				return fmt.Errorf("signer missing: %v", err)
 			}
 			oas.Authorize(eb, wallet.SignData, wallet.SignTx)
+			oas.CheckAuthorization(s.blockchain, s.blockchain.CurrentHeader())
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
@@ -570,6 +571,14 @@ func (s *Ethereum) Start() error {
 	// Regularly update shutdown marker
 	s.shutdownTracker.Start()
 
+	// Report the validators missing their slot when the chain stalls once synced,
+	// and hold off sealing without enough peers
+	if o, ok := s.engine.(*oasys.Oasys); ok {
+		o.SetSyncStatus(func() bool { return s.Synced() && !s.handler.downloader.Synchronising() })
+		o.StartLivenessMonitor(s.blockchain)
+		o.SetPeerCounter(s.handler.peers.len)
+	}
+
 	// Figure out a max peers count based on the server limits
 	maxPeers := s.p2pServer.MaxPeers
 	if s.config.LightServ > 0 {
@@ -427,6 +427,90 @@ func (c *CliqueConfig) String() string {
 type OasysConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	MaxReorgDepth        uint64 `json:"maxReorgDepth,omitempty"`        // Maximum number of blocks a reorg may unwind (0 = unlimited)
+	SnapshotWorkers      int    `json:"snapshotWorkers,omitempty"`      // Number of concurrent epoch lookups while rebuilding snapshots (0 = serial)
+	ArchiveMode          bool   `json:"archiveMode,omitempty"`          // Keep snapshots in memory only and run no background workers, for deep replays (restarts rebuild them from the genesis)
+	ValidatorPageSize    uint64 `json:"validatorPageSize,omitempty"`    // Number of validators read per StakeManager call (0 = 200)
+	FutureBlockTolerance uint64 `json:"futureBlockTolerance,omitempty"` // Seconds ahead of the local clock a header is queued for, rejected beyond (0 = unlimited)
+	CheckpointInterval   uint64 `json:"checkpointInterval,omitempty"`   // Number of blocks between the validator set checkpoints served to light clients (0 = none)
+	MinSealPeers         uint64 `json:"minSealPeers,omitempty"`         // Connected peers required to seal a block, to not seal in isolation (0 = none)
+
+	MinEpochPeriod uint64 `json:"minEpochPeriod,omitempty"` // Smallest epoch period accepted in environment proposals (0 = no minimum)
+	MaxEpochPeriod uint64 `json:"maxEpochPeriod,omitempty"` // Largest epoch period accepted in environment proposals (0 = no maximum)
+
+	PermissionedValidatorsBlock *big.Int `json:"permissionedValidatorsBlock,omitempty"` // Block only the validators whose operator is in the StakeManager's allowlist are selected from (nil = never)
+
+	// MaxValidators, if set, limits the validators sealing an epoch from
+	// MaxValidatorsBlock on to the ones staking the most. The other candidates
+	// stand by and are promoted at the next epoch in stake order as active
+	// validators are jailed or leave.
+	MaxValidators      uint64   `json:"maxValidators,omitempty"`
+	MaxValidatorsBlock *big.Int `json:"maxValidatorsBlock,omitempty"` // Block the validators are limited to MaxValidators from (nil = never)
+
+	TrustedCheckpoint *OasysCheckpoint `json:"trustedCheckpoint,omitempty"` // Block the chain must pass through, along with its validators (nil = none)
+
+	BootstrapValidators []common.Address `json:"bootstrapValidators,omitempty"` // Validators sealing until the StakeManager reports any (empty = genesis signers)
+	OasysBlock          *big.Int         `json:"oasysBlock,omitempty"`          // Block the Oasys rules apply from, sealed in-turn by the genesis validators before (nil = genesis)
+
+	SealScheme      string   `json:"sealScheme,omitempty"`      // Signature scheme of the block seals from SealSchemeBlock on (empty = secp256k1)
+	SealSchemeBlock *big.Int `json:"sealSchemeBlock,omitempty"` // Block the SealScheme applies from (nil = genesis)
+
+	ChainIDSealBlock *big.Int `json:"chainIdSealBlock,omitempty"` // Block seals commit to the chain ID from, so they can't be replayed on another chain (nil = never)
+
+	ValidatorRootBlock *big.Int `json:"validatorRootBlock,omitempty"` // Block epoch headers commit to the Merkle root of their validators from, in the vanity (nil = never)
+
+	CompressedExtraBlock *big.Int `json:"compressedExtraBlock,omitempty"` // Block epoch headers embed their validators compressed against the previous epoch's from (nil = never)
+
+	SignerDiversityBlock *big.Int `json:"signerDiversityBlock,omitempty"` // Block out-of-turn blocks by validators who sealed one of the last len(validators)/2+1 blocks are rejected from (nil = never)
+
+	BackoffJitter uint64 `json:"backoffJitter,omitempty"` // Maximum number of seconds added to out-of-turn backoffs from BackoffJitterBlock on, derived from signer and block (0 = none)
+
+	BackoffJitterBlock *big.Int `json:"backoffJitterBlock,omitempty"` // Block out-of-turn backoffs are jittered from (nil = never)
+
+	BackoffTieBreakBlock *big.Int `json:"backoffTieBreakBlock,omitempty"` // Block jittered backoffs are made unique across the validators from (nil = never)
+
+	BoundarySignerBlock *big.Int `json:"boundarySignerBlock,omitempty"` // Block epoch blocks are sealed in-turn by the outgoing validators rather than the incoming ones from (nil = never)
+
+	ScheduleV2Block *big.Int `json:"scheduleV2Block,omitempty"` // Block epochs starting from are scheduled by stake-weighted round-robin rather than weighted random draws (nil = never)
+
+	ValidatorThresholdBlock *big.Int `json:"validatorThresholdBlock,omitempty"` // Block validators must stake at least the validator threshold of the environment to be selected from (nil = never)
+
+	UniqueOperatorsBlock *big.Int `json:"uniqueOperatorsBlock,omitempty"` // Block operators reported twice by the StakeManager are only kept once from, with their first stake (nil = never)
+
+	// SlashEscalationMax, if above one, multiplies the blocks a validator is
+	// slashed for from SlashEscalationBlock on by the number of times it was
+	// slashed since that block and its last clean epoch, up to this maximum. The
+	// slashes are tracked by the validator snapshots, derived from the headers.
+	SlashEscalationMax   uint64   `json:"slashEscalationMax,omitempty"`
+	SlashEscalationBlock *big.Int `json:"slashEscalationBlock,omitempty"` // Block slashes are escalated from (nil = never)
+
+	// MinEpochsBetweenSetChanges, if set, keeps the validator set of the previous
+	// epoch from MinEpochsBetweenSetChangesBlock on until this many epochs elapsed
+	// since it last changed, even if the StakeManager reports another one. The
+	// epoch of the last change is tracked by the validator snapshots.
+	MinEpochsBetweenSetChanges      uint64   `json:"minEpochsBetweenSetChanges,omitempty"`
+	MinEpochsBetweenSetChangesBlock *big.Int `json:"minEpochsBetweenSetChangesBlock,omitempty"` // Block validator set changes are deferred from (nil = never)
+
+	// ActivationDelayEpochs, if set, keeps the validators joining the set from
+	// ActivationDelayBlock on out of it until they qualified for this many epochs
+	// in a row, so that lowering the validator threshold phases the newly
+	// qualifying validators in. It's tracked by the validator snapshots like
+	// MinEpochsBetweenSetChanges.
+	ActivationDelayEpochs uint64   `json:"activationDelayEpochs,omitempty"`
+	ActivationDelayBlock  *big.Int `json:"activationDelayBlock,omitempty"` // Block validator activations are delayed from (nil = never)
+
+	// ChainID is the chain ID the seals commit to from ChainIDSealBlock on. It's
+	// set by the engine from the chain configuration.
+	ChainID *big.Int `json:"-"`
+}
+
+// OasysCheckpoint is a block trusted to be part of the canonical chain, along
+// with the validators active at it.
+type OasysCheckpoint struct {
+	Number     uint64           `json:"number"`
+	Hash       common.Hash      `json:"hash"`
+	Validators []common.Address `json:"validators"`
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -434,6 +518,111 @@ func (o *OasysConfig) String() string {
 	return "oasys"
 }
 
+// IsOasys returns whether num is either equal to the Oasys activation block or
+// greater. Without an activation block, the Oasys rules apply from genesis.
+func (o *OasysConfig) IsOasys(num *big.Int) bool {
+	return o.OasysBlock == nil || isForked(o.OasysBlock, num)
+}
+
+// IsChainIDSeal returns whether num is either equal to the chain ID seal
+// activation block or greater.
+func (o *OasysConfig) IsChainIDSeal(num *big.Int) bool {
+	return isForked(o.ChainIDSealBlock, num)
+}
+
+// IsValidatorRoot returns whether num is either equal to the validator root
+// activation block or greater.
+func (o *OasysConfig) IsValidatorRoot(num *big.Int) bool {
+	return isForked(o.ValidatorRootBlock, num)
+}
+
+// IsCompressedExtra returns whether num is either equal to the compressed
+// extra-data activation block or greater.
+func (o *OasysConfig) IsCompressedExtra(num *big.Int) bool {
+	return isForked(o.CompressedExtraBlock, num)
+}
+
+// IsBackoffJitter returns whether num is either equal to the backoff jitter
+// activation block or greater.
+func (o *OasysConfig) IsBackoffJitter(num *big.Int) bool {
+	return isForked(o.BackoffJitterBlock, num)
+}
+
+// IsBackoffTieBreak returns whether num is either equal to the backoff
+// tie-break activation block or greater.
+func (o *OasysConfig) IsBackoffTieBreak(num *big.Int) bool {
+	return isForked(o.BackoffTieBreakBlock, num)
+}
+
+// IsPermissionedValidators returns whether num is either equal to the
+// permissioned validators activation block or greater.
+func (o *OasysConfig) IsPermissionedValidators(num *big.Int) bool {
+	return isForked(o.PermissionedValidatorsBlock, num)
+}
+
+// IsSignerDiversity returns whether num is either equal to the signer diversity
+// activation block or greater.
+func (o *OasysConfig) IsSignerDiversity(num *big.Int) bool {
+	return isForked(o.SignerDiversityBlock, num)
+}
+
+// IsMaxValidators returns whether num is either equal to the max validators
+// activation block or greater.
+func (o *OasysConfig) IsMaxValidators(num *big.Int) bool {
+	return isForked(o.MaxValidatorsBlock, num)
+}
+
+// IsMinEpochsBetweenSetChanges returns whether num is either equal to the set
+// change deferral activation block or greater.
+func (o *OasysConfig) IsMinEpochsBetweenSetChanges(num *big.Int) bool {
+	return isForked(o.MinEpochsBetweenSetChangesBlock, num)
+}
+
+// IsActivationDelay returns whether num is either equal to the activation delay
+// activation block or greater.
+func (o *OasysConfig) IsActivationDelay(num *big.Int) bool {
+	return isForked(o.ActivationDelayBlock, num)
+}
+
+// IsValidatorThreshold returns whether num is either equal to the validator
+// threshold activation block or greater.
+func (o *OasysConfig) IsValidatorThreshold(num *big.Int) bool {
+	return isForked(o.ValidatorThresholdBlock, num)
+}
+
+// IsUniqueOperators returns whether num is either equal to the unique
+// operators activation block or greater.
+func (o *OasysConfig) IsUniqueOperators(num *big.Int) bool {
+	return isForked(o.UniqueOperatorsBlock, num)
+}
+
+// IsBoundarySigner returns whether num is either equal to the boundary signer
+// activation block or greater.
+func (o *OasysConfig) IsBoundarySigner(num *big.Int) bool {
+	return isForked(o.BoundarySignerBlock, num)
+}
+
+// IsScheduleV2 returns whether num is either equal to the schedule v2
+// activation block or greater.
+func (o *OasysConfig) IsScheduleV2(num *big.Int) bool {
+	return isForked(o.ScheduleV2Block, num)
+}
+
+// IsSlashEscalation returns whether num is either equal to the slash escalation
+// activation block or greater.
+func (o *OasysConfig) IsSlashEscalation(num *big.Int) bool {
+	return isForked(o.SlashEscalationBlock, num)
+}
+
+// ScheduleAlgoVersion returns the version of the algorithm scheduling the epoch
+// starting at num.
+func (o *OasysConfig) ScheduleAlgoVersion(num *big.Int) uint64 {
+	if o.IsScheduleV2(num) {
+		return 2
+	}
+	return 1
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
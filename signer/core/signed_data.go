@@ -29,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/oasys"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
@@ -180,10 +181,18 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		if err != nil {
 			return nil, useEthereumV, err
 		}
-		header := &types.Header{}
-		if err := rlp.DecodeBytes(oasysData, header); err != nil {
+		header, chainID, err := oasys.DecodeOasysRLP(oasysData)
+		if err != nil {
 			return nil, useEthereumV, err
 		}
+		// From the chain ID seal fork on, the seal commits to the chain ID
+		config := &params.OasysConfig{}
+		if chainID != nil {
+			if chainID.Cmp(api.chainID) != 0 {
+				return nil, useEthereumV, fmt.Errorf("oasys header for chain id %v, configured %v", chainID, api.chainID)
+			}
+			config.ChainIDSealBlock, config.ChainID = common.Big0, chainID
+		}
 		// The incoming oasys header is already truncated, sent to us with a extradata already shortened
 		if len(header.Extra) < 65 {
 			// Need to add it back, to get a suitable length for hashing
@@ -192,7 +201,7 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 			header.Extra = newExtra
 		}
 		// Get back the rlp data, encoded by us
-		sighash, oasysRlp, err := oasysHeaderHashAndRlp(header)
+		sighash, oasysRlp, err := oasysHeaderHashAndRlp(header, config)
 		if err != nil {
 			return nil, useEthereumV, err
 		}
@@ -258,13 +267,16 @@ func cliqueHeaderHashAndRlp(header *types.Header) (hash, rlp []byte, err error)
 	return hash, rlp, err
 }
 
-func oasysHeaderHashAndRlp(header *types.Header) (hash, rlp []byte, err error) {
+// oasysHeaderHashAndRlp returns the hash and the rlp bytes signed for the
+// proof-of-stake sealing, committing to the chain ID of the config from its
+// chain ID seal fork on.
+func oasysHeaderHashAndRlp(header *types.Header, config *params.OasysConfig) (hash, rlp []byte, err error) {
 	if len(header.Extra) < 65 {
 		err = fmt.Errorf("oasys header extradata too short, %d < 65", len(header.Extra))
 		return
 	}
-	rlp = oasys.OasysRLP(header)
-	hash = oasys.SealHash(header).Bytes()
+	rlp = oasys.OasysRLP(header, config)
+	hash = oasys.SealHash(header, config).Bytes()
 	return hash, rlp, err
 }
 